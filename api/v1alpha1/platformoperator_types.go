@@ -18,28 +18,300 @@ package v1alpha1
 
 import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	PlatformOperatorKind = "PlatformOperator"
 )
 
 var (
-	TypeSourced = "Sourced"
-	TypeApplied = "Applied"
+	TypeSourced               = "Sourced"
+	TypeApplied               = "Applied"
+	TypeImageDrifted          = "ImageDrifted"
+	TypeVerified              = "Verified"
+	TypeUpgradeable           = "Upgradeable"
+	TypeDeprecated            = "Deprecated"
+	TypeUpgradeBlocked        = "UpgradeBlocked"
+	TypeAvailable             = "Available"
+	TypeDrifted               = "Drifted"
+	TypeHooksSucceeded        = "HooksSucceeded"
+	TypeDependenciesInstalled = "DependenciesInstalled"
+	TypeApplyConflict         = "ApplyConflict"
+
+	ReasonSourceFailed          = "SourceFailed"
+	ReasonSourceSuccessful      = "SourceSuccessful"
+	ReasonImageResolutionFailed = "ImageResolutionFailed"
+	ReasonApplyFailed           = "ApplyFailed"
+	ReasonApplySuccessful       = "ApplySuccessful"
+	ReasonDigestChanged         = "DigestChanged"
+	ReasonDigestUnchanged       = "DigestUnchanged"
+	ReasonSignatureVerified     = "SignatureVerified"
+	ReasonUnsigned              = "Unsigned"
+	ReasonUntrusted             = "Untrusted"
+	ReasonVerificationFailed    = "VerificationFailed"
+	ReasonAsExpected            = "AsExpected"
+	ReasonIncompatibleVersion   = "IncompatibleOperatorVersion"
+	ReasonDeprecated            = "Deprecated"
+	ReasonNotDeprecated         = "NotDeprecated"
+	ReasonIncompatibleCRDChange = "IncompatibleCRDChange"
+	ReasonResourcesUnchecked    = "ResourcesUnchecked"
+	ReasonUnavailable           = "Unavailable"
+	ReasonNoWorkloads           = "NoWorkloads"
+	ReasonHealthCheckFailed     = "HealthCheckFailed"
+	ReasonDriftDetected         = "DriftDetected"
+	ReasonDriftRemediated       = "DriftRemediated"
+	ReasonNoDrift               = "NoDrift"
+	ReasonDriftCheckFailed      = "DriftCheckFailed"
+	ReasonHookPending           = "HookPending"
+	ReasonHookFailed            = "HookFailed"
+	ReasonHookRunFailed         = "HookRunFailed"
+	ReasonDependencyPending     = "DependencyPending"
+	ReasonDependencyCycle       = "DependencyCycle"
+	ReasonDependencyCheckFailed = "DependencyCheckFailed"
+	ReasonFieldManagerConflict  = "FieldManagerConflict"
+)
+
+// DriftPolicy determines what happens when the objects installed for a
+// PlatformOperator drift from its olm.bundle content.
+// +kubebuilder:validation:Enum=Report;Remediate
+type DriftPolicy string
+
+const (
+	// DriftPolicyReport reports the drifted objects in the Drifted condition,
+	// leaving them as they are.
+	DriftPolicyReport DriftPolicy = "Report"
+	// DriftPolicyRemediate reports the drifted objects in the Drifted condition,
+	// and re-applies the olm.bundle content to restore them.
+	DriftPolicyRemediate DriftPolicy = "Remediate"
+)
+
+// HookPhase is the point of a rollout at which a hook runs.
+// +kubebuilder:validation:Enum=PreApply;PostInstall
+type HookPhase string
 
-	ReasonSourceFailed     = "SourceFailed"
-	ReasonSourceSuccessful = "SourceSuccessful"
-	ReasonApplyFailed      = "ApplyFailed"
-	ReasonApplySuccessful  = "ApplySuccessful"
+const (
+	// HookPhasePreApply hooks run before a new olm.bundle version is applied,
+	// which is held until they succeed.
+	HookPhasePreApply HookPhase = "PreApply"
+	// HookPhasePostInstall hooks run once a new olm.bundle version is applied
+	// and its workloads are available.
+	HookPhasePostInstall HookPhase = "PostInstall"
 )
 
+// Hook is a Job that runs when a new olm.bundle version is rolled out, e.g. to
+// migrate data before it's applied or to smoke test it afterwards.
+type Hook struct {
+	// Name identifies the hook among the hooks of its phase. A hook declared by
+	// the olm.bundle is replaced by the one with the same name and phase.
+	Name string `json:"name"`
+	// Phase is the point of the rollout at which the hook runs.
+	Phase HookPhase `json:"phase"`
+	// Job is the batch/v1 Job manifest to run, which must set its namespace.
+	// +kubebuilder:pruning:PreserveUnknownFields
+	// +kubebuilder:validation:EmbeddedResource
+	Job runtime.RawExtension `json:"job"`
+}
+
+// Dependency is a PlatformOperator that must be installed before another one is
+// rolled out.
+type Dependency struct {
+	// Name is the name of the prerequisite PlatformOperator.
+	Name string `json:"name"`
+	// Version is the semver range the prerequisite's installed version must be
+	// in, e.g. ">=4.12.0". Any installed version is accepted when unset.
+	// +optional
+	Version string `json:"version,omitempty"`
+}
+
 // PlatformOperatorSpec defines the desired state of PlatformOperator
 type PlatformOperatorSpec struct {
 	// PackageName specifies the name of the package to be installed from the provided CatalogSource.
 	// PackageName is required and must equal the exact name of the package in the catalog.
 	PackageName string `json:"packageName"`
+	// AllowPrereleases determines whether pre-release versions of the package,
+	// e.g. 1.0.0-rc.1, may be selected. Pre-releases are excluded by default.
+	// +optional
+	AllowPrereleases bool `json:"allowPrereleases,omitempty"`
+	// Version pins the PlatformOperator to the olm.bundle with this exact version.
+	// The highest available version is selected when unset. Versions the catalog
+	// has deprecated are only selected for new installs when they're pinned.
+	// +optional
+	Version string `json:"version,omitempty"`
+	// DryRun previews upgrades rather than applying them. While set, the sourced
+	// olm.bundle content isn't applied, and how applying it would change the
+	// installed content is reported in status.diff instead. Unset it to approve
+	// the upgrade.
+	// +optional
+	DryRun bool `json:"dryRun,omitempty"`
+	// DriftPolicy determines whether the objects installed for the PlatformOperator
+	// are restored when they're modified or deleted out of band, or only reported
+	// in the Drifted condition. Defaults to Report. Drift is only detected for the
+	// objects the manager is allowed to read, and only restored for the objects
+	// it's allowed to patch.
+	// +optional
+	// +kubebuilder:default=Report
+	DriftPolicy DriftPolicy `json:"driftPolicy,omitempty"`
+	// Hooks are run as Jobs whenever a new olm.bundle version is rolled out, in
+	// addition to the ones the olm.bundle declares in its annotations.
+	// +optional
+	Hooks []Hook `json:"hooks,omitempty"`
+	// DependsOn lists the PlatformOperators that must be installed before this
+	// one is rolled out. Installs and upgrades are held until each of them has
+	// applied a version in the required range.
+	// +optional
+	DependsOn []Dependency `json:"dependsOn,omitempty"`
+	// ForceConflicts takes over the fields of the BundleDeployment that other
+	// field managers have changed. Otherwise, the conflicting changes are kept
+	// and reported in the ApplyConflict condition, and the olm.bundle content
+	// isn't applied until they're reverted.
+	// +optional
+	ForceConflicts bool `json:"forceConflicts,omitempty"`
 }
 
 // PlatformOperatorStatus defines the observed state of PlatformOperator
 type PlatformOperatorStatus struct {
 	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// RequeueAfter is the delay after which the PlatformOperator will next be reconciled,
+	// as chosen from the outcome of the last reconciliation. RequeueAfter is unset when
+	// no reconciliation has been scheduled, or when the retry is left to the controller's
+	// default exponential backoff.
+	RequeueAfter *metav1.Duration `json:"requeueAfter,omitempty"`
+	// ActiveBundle is the olm.bundle content that was last successfully applied.
+	ActiveBundle *ActiveBundle `json:"activeBundle,omitempty"`
+	// ExcludedBundles are the candidate olm.bundles that were excluded when the
+	// olm.bundle content was last sourced, e.g. because their version is invalid.
+	ExcludedBundles []ExcludedBundle `json:"excludedBundles,omitempty"`
+	// AppliedObjects are the objects applied for the active olm.bundle when its
+	// content is applied directly rather than through a rukpak BundleDeployment.
+	// Objects that are dropped between versions are pruned.
+	AppliedObjects []AppliedObject `json:"appliedObjects,omitempty"`
+	// BundleDeployments are the names of the rukpak BundleDeployments owned by the
+	// platform operator, starting with the one that installs it. The following
+	// ones are being retired, and their objects handed over to the first one.
+	BundleDeployments []string `json:"bundleDeployments,omitempty"`
+	// Diff summarizes how applying the sourced olm.bundle would change the
+	// live objects on the cluster, and is only reported while spec.dryRun is set.
+	Diff *BundleDiff `json:"diff,omitempty"`
+	// Hooks are the outcomes of the hooks run for the olm.bundle version that
+	// was last rolled out.
+	Hooks []HookStatus `json:"hooks,omitempty"`
+}
+
+// HookState is the state of a hook's Job.
+type HookState string
+
+const (
+	HookStateRunning   HookState = "Running"
+	HookStateSucceeded HookState = "Succeeded"
+	HookStateFailed    HookState = "Failed"
+)
+
+// HookStatus describes the outcome of a hook.
+type HookStatus struct {
+	// Name is the name of the hook.
+	Name string `json:"name"`
+	// Phase is the point of the rollout at which the hook ran.
+	Phase HookPhase `json:"phase"`
+	// Version is the olm.bundle version the hook ran for.
+	Version string `json:"version"`
+	// Namespace and Job identify the Job the hook ran as. The Job is deleted
+	// once it finishes.
+	Namespace string `json:"namespace"`
+	Job       string `json:"job"`
+	// State is the state of the hook's Job.
+	State HookState `json:"state"`
+	// Message explains why the hook failed.
+	Message string `json:"message,omitempty"`
+	// LogsConfigMap is the name of the ConfigMap in the hook's namespace that
+	// holds the logs of the Job's pods once it finished.
+	LogsConfigMap string `json:"logsConfigMap,omitempty"`
+}
+
+// BundleDiff summarizes the differences between the live objects installed for
+// the platform operator and the content of the sourced olm.bundle.
+type BundleDiff struct {
+	// FromVersion is the version of the installed olm.bundle, if any.
+	FromVersion string `json:"fromVersion,omitempty"`
+	// ToVersion is the version of the sourced olm.bundle.
+	ToVersion string `json:"toVersion"`
+	// Added are the objects applying the olm.bundle would create.
+	Added []AppliedObject `json:"added,omitempty"`
+	// Removed are the objects applying the olm.bundle would prune.
+	Removed []AppliedObject `json:"removed,omitempty"`
+	// Changed are the objects applying the olm.bundle would update.
+	Changed []AppliedObject `json:"changed,omitempty"`
+	// CRDChanges summarize the changes to the versions and schemas of the
+	// CustomResourceDefinitions that would be updated.
+	CRDChanges []CRDChange `json:"crdChanges,omitempty"`
+}
+
+// CRDChange summarizes the changes to a CustomResourceDefinition.
+type CRDChange struct {
+	// Name is the name of the CustomResourceDefinition.
+	Name string `json:"name"`
+	// Changes describe each change, e.g. "v1: added property spec.replicas".
+	Changes []string `json:"changes"`
+}
+
+// AppliedObject references an object that's applied for a PlatformOperator.
+type AppliedObject struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+}
+
+// ExcludedBundle describes a candidate olm.bundle that was excluded from selection.
+type ExcludedBundle struct {
+	// Name is the name of the olm.bundle.
+	Name string `json:"name"`
+	// Version is the version of the olm.bundle as declared in the catalog.
+	Version string `json:"version"`
+	// Catalog is the catalog the olm.bundle was sourced from.
+	Catalog string `json:"catalog,omitempty"`
+	// Reason explains why the olm.bundle was excluded.
+	Reason string `json:"reason"`
+}
+
+// ActiveBundle describes the olm.bundle content applied for a PlatformOperator.
+type ActiveBundle struct {
+	// Name is the name of the olm.bundle, e.g. the name of its ClusterServiceVersion.
+	Name string `json:"name,omitempty"`
+	// Version is the version of the olm.bundle.
+	Version string `json:"version"`
+	// Image is the olm.bundle image reference as published in the catalog, which
+	// is typically a mutable tag.
+	Image string `json:"image"`
+	// Digest is the digest the image was resolved to and pinned at. The image is
+	// only re-resolved when the catalog publishes a different olm.bundle.
+	Digest string `json:"digest"`
+	// MirroredImage is the reference the bundle content was applied from when the
+	// pinned image is mirrored to another location.
+	MirroredImage string `json:"mirroredImage,omitempty"`
+	// MaxOpenShiftVersion is the newest minor version of OpenShift the bundle is
+	// compatible with, as declared by its olm.maxOpenShiftVersion property.
+	MaxOpenShiftVersion string `json:"maxOpenShiftVersion,omitempty"`
+	// DisplayName is the human readable name of the operator, as declared by its
+	// ClusterServiceVersion.
+	DisplayName string `json:"displayName,omitempty"`
+	// Provider is the publisher of the operator, as declared by its
+	// ClusterServiceVersion.
+	Provider string `json:"provider,omitempty"`
+	// ProvidedAPIs are the APIs served by the olm.bundle.
+	ProvidedAPIs []metav1.GroupVersionKind `json:"providedAPIs,omitempty"`
+	// RelatedImages are the images the operator pulls at runtime, as published in
+	// the catalog. Together with Image, they list every image the platform operator
+	// pulls, e.g. for mirroring them to a disconnected registry.
+	RelatedImages []RelatedImage `json:"relatedImages,omitempty"`
+}
+
+// RelatedImage is an image that an installed operator pulls at runtime.
+type RelatedImage struct {
+	// Name identifies the image's purpose within the operator, e.g. "operand".
+	Name string `json:"name,omitempty"`
+	// Image is the image reference as published in the catalog.
+	Image string `json:"image"`
 }
 
 //+kubebuilder:object:root=true
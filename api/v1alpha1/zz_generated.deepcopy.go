@@ -23,15 +23,173 @@ package v1alpha1
 
 import (
 	"k8s.io/apimachinery/pkg/apis/meta/v1"
-	runtime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ActiveBundle) DeepCopyInto(out *ActiveBundle) {
+	*out = *in
+	if in.ProvidedAPIs != nil {
+		in, out := &in.ProvidedAPIs, &out.ProvidedAPIs
+		*out = make([]v1.GroupVersionKind, len(*in))
+		copy(*out, *in)
+	}
+	if in.RelatedImages != nil {
+		in, out := &in.RelatedImages, &out.RelatedImages
+		*out = make([]RelatedImage, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ActiveBundle.
+func (in *ActiveBundle) DeepCopy() *ActiveBundle {
+	if in == nil {
+		return nil
+	}
+	out := new(ActiveBundle)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AppliedObject) DeepCopyInto(out *AppliedObject) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AppliedObject.
+func (in *AppliedObject) DeepCopy() *AppliedObject {
+	if in == nil {
+		return nil
+	}
+	out := new(AppliedObject)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BundleDiff) DeepCopyInto(out *BundleDiff) {
+	*out = *in
+	if in.Added != nil {
+		in, out := &in.Added, &out.Added
+		*out = make([]AppliedObject, len(*in))
+		copy(*out, *in)
+	}
+	if in.Removed != nil {
+		in, out := &in.Removed, &out.Removed
+		*out = make([]AppliedObject, len(*in))
+		copy(*out, *in)
+	}
+	if in.Changed != nil {
+		in, out := &in.Changed, &out.Changed
+		*out = make([]AppliedObject, len(*in))
+		copy(*out, *in)
+	}
+	if in.CRDChanges != nil {
+		in, out := &in.CRDChanges, &out.CRDChanges
+		*out = make([]CRDChange, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BundleDiff.
+func (in *BundleDiff) DeepCopy() *BundleDiff {
+	if in == nil {
+		return nil
+	}
+	out := new(BundleDiff)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CRDChange) DeepCopyInto(out *CRDChange) {
+	*out = *in
+	if in.Changes != nil {
+		in, out := &in.Changes, &out.Changes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CRDChange.
+func (in *CRDChange) DeepCopy() *CRDChange {
+	if in == nil {
+		return nil
+	}
+	out := new(CRDChange)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Dependency) DeepCopyInto(out *Dependency) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Dependency.
+func (in *Dependency) DeepCopy() *Dependency {
+	if in == nil {
+		return nil
+	}
+	out := new(Dependency)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExcludedBundle) DeepCopyInto(out *ExcludedBundle) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExcludedBundle.
+func (in *ExcludedBundle) DeepCopy() *ExcludedBundle {
+	if in == nil {
+		return nil
+	}
+	out := new(ExcludedBundle)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Hook) DeepCopyInto(out *Hook) {
+	*out = *in
+	in.Job.DeepCopyInto(&out.Job)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Hook.
+func (in *Hook) DeepCopy() *Hook {
+	if in == nil {
+		return nil
+	}
+	out := new(Hook)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HookStatus) DeepCopyInto(out *HookStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HookStatus.
+func (in *HookStatus) DeepCopy() *HookStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(HookStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PlatformOperator) DeepCopyInto(out *PlatformOperator) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
+	in.Spec.DeepCopyInto(&out.Spec)
 	in.Status.DeepCopyInto(&out.Status)
 }
 
@@ -88,6 +246,18 @@ func (in *PlatformOperatorList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PlatformOperatorSpec) DeepCopyInto(out *PlatformOperatorSpec) {
 	*out = *in
+	if in.Hooks != nil {
+		in, out := &in.Hooks, &out.Hooks
+		*out = make([]Hook, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.DependsOn != nil {
+		in, out := &in.DependsOn, &out.DependsOn
+		*out = make([]Dependency, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlatformOperatorSpec.
@@ -110,6 +280,41 @@ func (in *PlatformOperatorStatus) DeepCopyInto(out *PlatformOperatorStatus) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.RequeueAfter != nil {
+		in, out := &in.RequeueAfter, &out.RequeueAfter
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.ActiveBundle != nil {
+		in, out := &in.ActiveBundle, &out.ActiveBundle
+		*out = new(ActiveBundle)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ExcludedBundles != nil {
+		in, out := &in.ExcludedBundles, &out.ExcludedBundles
+		*out = make([]ExcludedBundle, len(*in))
+		copy(*out, *in)
+	}
+	if in.AppliedObjects != nil {
+		in, out := &in.AppliedObjects, &out.AppliedObjects
+		*out = make([]AppliedObject, len(*in))
+		copy(*out, *in)
+	}
+	if in.BundleDeployments != nil {
+		in, out := &in.BundleDeployments, &out.BundleDeployments
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Diff != nil {
+		in, out := &in.Diff, &out.Diff
+		*out = new(BundleDiff)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Hooks != nil {
+		in, out := &in.Hooks, &out.Hooks
+		*out = make([]HookStatus, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlatformOperatorStatus.
@@ -121,3 +326,18 @@ func (in *PlatformOperatorStatus) DeepCopy() *PlatformOperatorStatus {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RelatedImage) DeepCopyInto(out *RelatedImage) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RelatedImage.
+func (in *RelatedImage) DeepCopy() *RelatedImage {
+	if in == nil {
+		return nil
+	}
+	out := new(RelatedImage)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -17,29 +17,59 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
 	operatorsv1alpha1 "github.com/operator-framework/api/pkg/operators/v1alpha1"
 	rukpakv1alpha1 "github.com/operator-framework/rukpak/api/v1alpha1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/kubernetes"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
 	platformv1alpha1 "github.com/openshift/platform-operators/api/v1alpha1"
 	"github.com/openshift/platform-operators/controllers"
 	"github.com/openshift/platform-operators/internal/applier"
+	"github.com/openshift/platform-operators/internal/clusterversion"
+	"github.com/openshift/platform-operators/internal/health"
+	"github.com/openshift/platform-operators/internal/hooks"
+	"github.com/openshift/platform-operators/internal/mirror"
+	"github.com/openshift/platform-operators/internal/resolver"
 	"github.com/openshift/platform-operators/internal/sourcer"
+	"github.com/openshift/platform-operators/internal/tracing"
+	"github.com/openshift/platform-operators/internal/util"
+	"github.com/openshift/platform-operators/internal/verifier"
 	//+kubebuilder:scaffold:imports
 )
 
+const (
+	sourcerCatalogSource = "catalogsource"
+	sourcerFBCDir        = "fbc-dir"
+	sourcerFBCConfigMap  = "fbc-configmap"
+	sourcerCatalogImage  = "catalog-image"
+
+	applierBundleDeployment = "bundledeployment"
+	applierDirect           = "direct"
+)
+
 var (
 	scheme   = runtime.NewScheme()
 	setupLog = ctrl.Log.WithName("setup")
@@ -62,14 +92,59 @@ func main() {
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	requeuePolicy := util.DefaultRequeuePolicy()
+	flag.DurationVar(&requeuePolicy.ResyncPeriod, "resync-period", requeuePolicy.ResyncPeriod,
+		"The interval at which successfully reconciled platform operators are re-checked against their catalogs. "+
+			"Setting this to zero disables periodic resyncs.")
+	flag.DurationVar(&requeuePolicy.PackageNotFoundBackoff, "package-not-found-backoff", requeuePolicy.PackageNotFoundBackoff,
+		"The delay before retrying a platform operator whose package could not be found in any catalog.")
+	var sourcerNames, sourcerPolicy string
+	var sourcerOpts sourcerOptions
+	flag.StringVar(&sourcerNames, "sourcer", sourcerCatalogSource,
+		fmt.Sprintf("A comma-separated, ordered list of the backends olm.bundle content is sourced from. Each one of: %s, %s, %s, %s. "+
+			"The file-based catalog backends don't require OLM to be installed.", sourcerCatalogSource, sourcerFBCDir, sourcerFBCConfigMap, sourcerCatalogImage))
+	flag.StringVar(&sourcerPolicy, "sourcer-policy", string(sourcer.MergePolicyFirstWins),
+		fmt.Sprintf("How the results of multiple sourcers are combined. One of: %s, %s.", sourcer.MergePolicyFirstWins, sourcer.MergePolicyHighestVersion))
+	flag.StringVar(&sourcerOpts.fbcDir, "fbc-dir", "", "The directory containing the file-based catalog, when using the fbc-dir sourcer.")
+	flag.StringVar(&sourcerOpts.fbcConfigMap, "fbc-configmap", "", "The namespace/name of the ConfigMap containing the file-based catalog, when using the fbc-configmap sourcer.")
+	flag.StringVar(&sourcerOpts.catalogImages, "catalog-images", "", "A comma-separated list of catalog image references, when using the catalog-image sourcer.")
+	flag.StringVar(&sourcerOpts.catalogCacheDir, "catalog-cache-dir", filepath.Join(os.TempDir(), "platform-operators", "catalogs"),
+		"The directory catalog images are extracted to, when using the catalog-image sourcer.")
+	var imageMirrors string
+	flag.StringVar(&imageMirrors, "image-mirrors", "",
+		"The path to a file listing additional source and mirrors mappings to honor, along with the cluster's "+
+			"ImageContentSourcePolicies and ImageDigestMirrorSets, when verifying and applying bundle images pinned to a digest.")
+	var signaturePolicy string
+	flag.StringVar(&signaturePolicy, "signature-policy", "",
+		"The path to the file configuring the keys trusted to sign bundle images. Signatures aren't verified when unset.")
+	var applierName string
+	flag.StringVar(&applierName, "applier", applierBundleDeployment,
+		fmt.Sprintf("How olm.bundle content is applied. One of: %s, which delegates to rukpak BundleDeployments, or %s, "+
+			"which applies the bundle's manifests with server-side apply and doesn't require rukpak. "+
+			"The %s applier requires the manager to be allowed to create every object the installed bundles contain, "+
+			"e.g. by binding it to the platform-operators-manager-content-role ClusterRole.",
+			applierBundleDeployment, applierDirect, applierDirect))
 	opts := zap.Options{
 		Development: true,
 	}
 	opts.BindFlags(flag.CommandLine)
+	var tracingOpts tracing.Options
+	tracingOpts.BindFlags(flag.CommandLine)
 	flag.Parse()
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
+	shutdownTracing, err := tracing.Setup(context.Background(), tracingOpts)
+	if err != nil {
+		setupLog.Error(err, "unable to set up tracing")
+		os.Exit(1)
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			setupLog.Error(err, "failed to flush traces")
+		}
+	}()
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:                 scheme,
 		MetricsBindAddress:     metricsAddr,
@@ -77,21 +152,110 @@ func main() {
 		HealthProbeBindAddress: probeAddr,
 		LeaderElection:         enableLeaderElection,
 		LeaderElectionID:       "ffdf93bc.openshift.io",
+		// Only the Jobs and ConfigMaps of hooks are read through the cache.
+		NewCache: cache.BuilderWithOptions(cache.Options{SelectorsByObject: hooks.CacheSelectors()}),
 	})
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
 
+	packageIndex := sourcer.NewPackageIndex()
+	names := splitList(sourcerNames)
+	// The catalog ConfigMap is read directly, rather than caching every ConfigMap.
+	sourcerOpts.apiReader = mgr.GetAPIReader()
+	s, err := newCompositeSourcer(mgr.GetClient(), packageIndex, names, sourcer.MergePolicy(sourcerPolicy), sourcerOpts)
+	if err != nil {
+		setupLog.Error(err, "unable to configure the sourcer")
+		os.Exit(1)
+	}
+
+	dc, err := discovery.NewDiscoveryClientForConfig(mgr.GetConfig())
+	if err != nil {
+		setupLog.Error(err, "unable to create discovery client")
+		os.Exit(1)
+	}
+	// The ClusterVersion is read as an unstructured object, which the manager's
+	// client reads from the API server rather than from its cache, so it's read
+	// from the cache directly instead of on every reconciliation.
+	versions := clusterversion.NewGetter(mgr.GetCache(), dc)
+	s = sourcer.NewFilteredSourcer(s, sourcer.NewCompatibilityFilter(versions), sourcer.NewDeprecationFilter())
+
+	keychain := remote.WithAuthFromKeychain(authn.DefaultKeychain)
+	var mirrors []mirror.Mirror
+	if imageMirrors != "" {
+		if mirrors, err = mirror.LoadConfig(imageMirrors); err != nil {
+			setupLog.Error(err, "unable to load the image mirror configuration")
+			os.Exit(1)
+		}
+	}
+
+	// Images pinned to a digest are verified and applied from their mirrors, so
+	// they can be rolled out when only the mirrors can be reached. Tags are
+	// resolved against their source. As with the ClusterVersion, the mirror APIs
+	// are listed from the cache.
+	rewriter := mirror.NewClusterRewriter(mgr.GetCache(), mirrors)
+
+	var v verifier.Verifier
+	if signaturePolicy != "" {
+		policy, err := verifier.LoadPolicy(signaturePolicy)
+		if err != nil {
+			setupLog.Error(err, "unable to load the signature policy")
+			os.Exit(1)
+		}
+		if v, err = verifier.NewCosignVerifier(policy, rewriter, keychain); err != nil {
+			setupLog.Error(err, "unable to configure signature verification")
+			os.Exit(1)
+		}
+	}
+
+	applierOpts := []applier.Option{
+		applier.WithImageMirrors(rewriter),
+		applier.WithRemoteOptions(keychain),
+	}
+	var a applier.Applier
+	switch applierName {
+	case applierBundleDeployment:
+		a = applier.NewBundleDeploymentHandler(mgr.GetClient(), applierOpts...)
+	case applierDirect:
+		a = applier.NewDirectHandler(mgr.GetClient(), applierOpts...)
+	default:
+		setupLog.Error(fmt.Errorf("unknown applier %q", applierName), "unable to configure the applier")
+		os.Exit(1)
+	}
+
+	cs, err := kubernetes.NewForConfig(mgr.GetConfig())
+	if err != nil {
+		setupLog.Error(err, "unable to create clientset")
+		os.Exit(1)
+	}
+
 	if err = (&controllers.PlatformOperatorReconciler{
-		Client:  mgr.GetClient(),
-		Scheme:  mgr.GetScheme(),
-		Sourcer: sourcer.NewCatalogSourceHandler(mgr.GetClient()),
-		Applier: applier.NewBundleDeploymentHandler(mgr.GetClient()),
+		Client:                 mgr.GetClient(),
+		Scheme:                 mgr.GetScheme(),
+		Sourcer:                s,
+		Resolver:               resolver.NewRegistryResolver(keychain),
+		Verifier:               v,
+		ClusterVersion:         versions,
+		Health:                 health.NewEvaluator(mgr.GetClient()),
+		Hooks:                  hooks.NewRunner(mgr.GetClient(), cs.CoreV1()),
+		Applier:                a,
+		RequeuePolicy:          requeuePolicy,
+		PackageIndex:           packageIndex,
+		WatchCatalogSources:    sets.NewString(names...).Has(sourcerCatalogSource),
+		WatchBundleDeployments: applierName == applierBundleDeployment,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "PlatformOperator")
 		os.Exit(1)
 	}
+	if applierName == applierBundleDeployment {
+		if err = (&controllers.BundleGCReconciler{
+			Client: mgr.GetClient(),
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "BundleGC")
+			os.Exit(1)
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -109,3 +273,63 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+type sourcerOptions struct {
+	fbcDir          string
+	fbcConfigMap    string
+	catalogImages   string
+	catalogCacheDir string
+	apiReader       client.Reader
+}
+
+// newCompositeSourcer chains the named sourcers together, unless only a single
+// sourcer is configured.
+func newCompositeSourcer(c client.Client, index *sourcer.PackageIndex, names []string, policy sourcer.MergePolicy, opts sourcerOptions) (sourcer.Sourcer, error) {
+	if len(names) == 1 {
+		return newSourcer(c, index, names[0], opts)
+	}
+	var sourcers []sourcer.NamedSourcer
+	for _, name := range names {
+		s, err := newSourcer(c, index, name, opts)
+		if err != nil {
+			return nil, err
+		}
+		sourcers = append(sourcers, sourcer.NamedSourcer{Name: name, Sourcer: s})
+	}
+	return sourcer.NewCompositeSourcer(policy, sourcers...)
+}
+
+func newSourcer(c client.Client, index *sourcer.PackageIndex, name string, opts sourcerOptions) (sourcer.Sourcer, error) {
+	switch name {
+	case sourcerCatalogSource:
+		return sourcer.NewCatalogSourceHandler(c, index), nil
+	case sourcerFBCDir:
+		if opts.fbcDir == "" {
+			return nil, fmt.Errorf("the --fbc-dir flag is required when using the %s sourcer", name)
+		}
+		return sourcer.NewFileBasedCatalogHandler(opts.fbcDir), nil
+	case sourcerFBCConfigMap:
+		parts := strings.Split(opts.fbcConfigMap, "/")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("the --fbc-configmap flag must be specified as namespace/name when using the %s sourcer", name)
+		}
+		return sourcer.NewConfigMapCatalogHandler(opts.apiReader, types.NamespacedName{Namespace: parts[0], Name: parts[1]}), nil
+	case sourcerCatalogImage:
+		images := splitList(opts.catalogImages)
+		if len(images) == 0 {
+			return nil, fmt.Errorf("the --catalog-images flag is required when using the %s sourcer", name)
+		}
+		return sourcer.NewCatalogImageHandler(images, opts.catalogCacheDir, remote.WithAuthFromKeychain(authn.DefaultKeychain)), nil
+	}
+	return nil, fmt.Errorf("unknown sourcer %q", name)
+}
+
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	rukpakv1alpha1 "github.com/operator-framework/rukpak/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerror "k8s.io/apimachinery/pkg/util/errors"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logr "sigs.k8s.io/controller-runtime/pkg/log"
+
+	platformv1alpha1 "github.com/openshift/platform-operators/api/v1alpha1"
+	"github.com/openshift/platform-operators/internal/metrics"
+)
+
+const (
+	// The labels rukpak sets on the Bundles it creates for a BundleDeployment.
+	ownerKindLabel = "core.rukpak.io/owner-kind"
+	ownerNameLabel = "core.rukpak.io/owner-name"
+)
+
+// BundleGCReconciler garbage collects the Bundles rukpak unpacked for the
+// BundleDeployments managed by PlatformOperators that were superseded before
+// they could be installed.
+//
+// No previous Bundles are retained for rollback: as of v0.7.0, rukpak deletes
+// every Bundle of a BundleDeployment but the installed one as soon as it's
+// installed, so any Bundle kept here would be deleted by rukpak right after the
+// next successful install. Rukpak doesn't delete anything while the installation
+// fails though, so every template rolled out in the meantime leaves a Bundle
+// behind, and rukpak stops creating Bundles for a BundleDeployment once it has
+// more than four of them.
+type BundleGCReconciler struct {
+	client.Client
+}
+
+// Reconcile deletes the Bundles of the BundleDeployment besides its active Bundle
+// and the Bundle unpacked for its current template, which rukpak installs next.
+func (r *BundleGCReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := logr.FromContext(ctx)
+
+	bd := &rukpakv1alpha1.BundleDeployment{}
+	if err := r.Get(ctx, req.NamespacedName, bd); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	owner := platformOperatorOwner(bd)
+	if owner == "" {
+		return ctrl.Result{}, nil
+	}
+
+	bundles := &rukpakv1alpha1.BundleList{}
+	if err := r.List(ctx, bundles, client.MatchingLabels{
+		ownerKindLabel: rukpakv1alpha1.BundleDeploymentKind,
+		ownerNameLabel: bd.GetName(),
+	}); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	var (
+		errs      []error
+		reclaimed int
+	)
+	for _, b := range supersededBundles(bd, bundles.Items) {
+		b := b
+		if err := r.Delete(ctx, &b); client.IgnoreNotFound(err) != nil {
+			errs = append(errs, fmt.Errorf("failed to delete the superseded %s Bundle: %w", b.GetName(), err))
+			continue
+		}
+		reclaimed++
+		log.V(1).Info("deleted superseded bundle", "bundle", b.GetName(), "bundleDeployment", bd.GetName())
+	}
+	if reclaimed > 0 {
+		metrics.RecordBundlesReclaimed(owner, reclaimed)
+		log.Info("reclaimed superseded bundles", "platformoperator", owner, "bundleDeployment", bd.GetName(), "count", reclaimed)
+	}
+	return ctrl.Result{}, utilerror.NewAggregate(errs)
+}
+
+// supersededBundles returns the Bundles controlled by the BundleDeployment that
+// are neither its active Bundle nor unpacked for its current template.
+func supersededBundles(bd *rukpakv1alpha1.BundleDeployment, bundles []rukpakv1alpha1.Bundle) []rukpakv1alpha1.Bundle {
+	var superseded []rukpakv1alpha1.Bundle
+	for _, b := range bundles {
+		if !metav1.IsControlledBy(&b, bd) || b.GetName() == bd.Status.ActiveBundle {
+			continue
+		}
+		if bd.Spec.Template != nil && equality.Semantic.DeepEqual(b.Spec, bd.Spec.Template.Spec) {
+			continue
+		}
+		superseded = append(superseded, b)
+	}
+	return superseded
+}
+
+// platformOperatorOwner returns the name of the PlatformOperator controlling the
+// object, if any.
+func platformOperatorOwner(obj metav1.Object) string {
+	ref := metav1.GetControllerOf(obj)
+	if ref == nil || ref.Kind != platformv1alpha1.PlatformOperatorKind || ref.APIVersion != platformv1alpha1.GroupVersion.String() {
+		return ""
+	}
+	return ref.Name
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *BundleGCReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("bundle-gc").
+		For(&rukpakv1alpha1.BundleDeployment{}).
+		Owns(&rukpakv1alpha1.Bundle{}).
+		Complete(r)
+}
@@ -0,0 +1,147 @@
+package controllers
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	rukpakv1alpha1 "github.com/operator-framework/rukpak/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	platformv1alpha1 "github.com/openshift/platform-operators/api/v1alpha1"
+)
+
+func TestBundleGC(t *testing.T) {
+	po := &platformv1alpha1.PlatformOperator{ObjectMeta: metav1.ObjectMeta{Name: "combo", UID: "po-uid"}}
+	newBD := func(owner *platformv1alpha1.PlatformOperator, image string) *rukpakv1alpha1.BundleDeployment {
+		bd := &rukpakv1alpha1.BundleDeployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "combo", UID: "bd-uid"},
+			Spec:       *buildTestBundleDeployment(image),
+		}
+		if owner != nil {
+			bd.SetOwnerReferences([]metav1.OwnerReference{*metav1.NewControllerRef(owner, platformv1alpha1.GroupVersion.WithKind(platformv1alpha1.PlatformOperatorKind))})
+		}
+		return bd
+	}
+	newBundle := func(bd *rukpakv1alpha1.BundleDeployment, name, image string) *rukpakv1alpha1.Bundle {
+		b := &rukpakv1alpha1.Bundle{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: name,
+				Labels: map[string]string{
+					ownerKindLabel: rukpakv1alpha1.BundleDeploymentKind,
+					ownerNameLabel: bd.GetName(),
+				},
+			},
+			Spec: buildTestBundleDeployment(image).Template.Spec,
+		}
+		b.SetOwnerReferences([]metav1.OwnerReference{*metav1.NewControllerRef(bd, rukpakv1alpha1.GroupVersion.WithKind(rukpakv1alpha1.BundleDeploymentKind))})
+		return b
+	}
+
+	for _, tt := range []struct {
+		name   string
+		bd     *rukpakv1alpha1.BundleDeployment
+		active string
+		want   []string
+	}{
+		{
+			name:   "keeps the active bundle and the bundle of the current template",
+			bd:     newBD(po, "quay.io/combo/bundle:v0.0.3"),
+			active: "combo-1",
+			want:   []string{"combo-1", "combo-3"},
+		},
+		{
+			name: "keeps the bundle of the current template until one is active",
+			bd:   newBD(po, "quay.io/combo/bundle:v0.0.3"),
+			want: []string{"combo-3"},
+		},
+		{
+			name:   "keeps the bundle of a template that was rolled back to",
+			bd:     newBD(po, "quay.io/combo/bundle:v0.0.2"),
+			active: "combo-1",
+			want:   []string{"combo-1", "combo-2"},
+		},
+		{
+			name:   "ignores bundle deployments not managed by a platform operator",
+			bd:     newBD(nil, "quay.io/combo/bundle:v0.0.3"),
+			active: "combo-1",
+			want:   []string{"combo-1", "combo-2", "combo-3"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.bd.Status.ActiveBundle = tt.active
+			unrelated := newBundle(tt.bd, "unrelated", "quay.io/combo/bundle:v0.0.0")
+			unrelated.SetOwnerReferences(nil)
+			objs := []client.Object{
+				tt.bd,
+				// combo-2 and combo-3 were unpacked for templates that haven't
+				// been installed yet, so rukpak hasn't deleted any of them.
+				newBundle(tt.bd, "combo-1", "quay.io/combo/bundle:v0.0.1"),
+				newBundle(tt.bd, "combo-2", "quay.io/combo/bundle:v0.0.2"),
+				newBundle(tt.bd, "combo-3", "quay.io/combo/bundle:v0.0.3"),
+				unrelated,
+			}
+
+			scheme := runtime.NewScheme()
+			if err := rukpakv1alpha1.AddToScheme(scheme); err != nil {
+				t.Fatal(err)
+			}
+			c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
+			r := &BundleGCReconciler{Client: c}
+			if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(tt.bd)}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			bundles := &rukpakv1alpha1.BundleList{}
+			if err := c.List(context.Background(), bundles); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, b := range bundles.Items {
+				if b.GetName() != "unrelated" {
+					got = append(got, b.GetName())
+				}
+			}
+			sort.Strings(got)
+			if !equalStrings(got, tt.want) {
+				t.Errorf("expected the remaining bundles to be %v, got %v", tt.want, got)
+			}
+			if len(got)+1 != len(bundles.Items) {
+				t.Errorf("expected bundles not controlled by the bundle deployment to be kept")
+			}
+		})
+	}
+}
+
+// buildTestBundleDeployment returns the spec of a BundleDeployment rolling out
+// the image, as rukpak copies its template's spec to the Bundles it unpacks.
+func buildTestBundleDeployment(image string) *rukpakv1alpha1.BundleDeploymentSpec {
+	return &rukpakv1alpha1.BundleDeploymentSpec{
+		ProvisionerClassName: "core.rukpak.io/plain",
+		Template: &rukpakv1alpha1.BundleTemplate{
+			Spec: rukpakv1alpha1.BundleSpec{
+				ProvisionerClassName: "core.rukpak.io/registry",
+				Source: rukpakv1alpha1.BundleSource{
+					Type:  rukpakv1alpha1.SourceTypeImage,
+					Image: &rukpakv1alpha1.ImageSource{Ref: image},
+				},
+			},
+		},
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
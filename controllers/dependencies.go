@@ -0,0 +1,129 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/blang/semver/v4"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	platformv1alpha1 "github.com/openshift/platform-operators/api/v1alpha1"
+	"github.com/openshift/platform-operators/internal/util"
+)
+
+// checkDependencies reports whether the PlatformOperator's prerequisites are
+// installed on the required versions, naming the prerequisite that blocks its
+// rollout otherwise. Dependency cycles block the rollout of every
+// PlatformOperator that's part of, or depends on, the cycle.
+func checkDependencies(ctx context.Context, c client.Reader, po *platformv1alpha1.PlatformOperator) (metav1.Condition, error) {
+	cond := metav1.Condition{Type: platformv1alpha1.TypeDependenciesInstalled}
+	cycle, err := findCycle(ctx, c, po)
+	if err != nil {
+		return failedDependencyCheck(cond, err), err
+	}
+	if len(cycle) != 0 {
+		cond.Status = metav1.ConditionFalse
+		cond.Reason = platformv1alpha1.ReasonDependencyCycle
+		cond.Message = fmt.Sprintf("The %s dependency cycle can't be rolled out", strings.Join(cycle, " -> "))
+		return cond, nil
+	}
+
+	for _, d := range po.Spec.DependsOn {
+		var versions semver.Range
+		if d.Version != "" {
+			if versions, err = semver.ParseRange(d.Version); err != nil {
+				err = util.NewPermanentError(fmt.Errorf("invalid version range %q for the %s dependency: %w", d.Version, d.Name, err))
+				return failedDependencyCheck(cond, err), err
+			}
+		}
+		message, err := unmetDependency(ctx, c, d, versions)
+		if err != nil {
+			return failedDependencyCheck(cond, err), err
+		}
+		if message != "" {
+			cond.Status = metav1.ConditionFalse
+			cond.Reason = platformv1alpha1.ReasonDependencyPending
+			cond.Message = message
+			return cond, nil
+		}
+	}
+	cond.Status = metav1.ConditionTrue
+	cond.Reason = platformv1alpha1.ReasonAsExpected
+	cond.Message = fmt.Sprintf("All %d prerequisite platform operators are installed", len(po.Spec.DependsOn))
+	return cond, nil
+}
+
+func failedDependencyCheck(cond metav1.Condition, err error) metav1.Condition {
+	cond.Status = metav1.ConditionUnknown
+	cond.Reason = platformv1alpha1.ReasonDependencyCheckFailed
+	cond.Message = err.Error()
+	return cond
+}
+
+// unmetDependency describes why the prerequisite isn't installed on a version in
+// the range, if it isn't.
+func unmetDependency(ctx context.Context, c client.Reader, d platformv1alpha1.Dependency, versions semver.Range) (string, error) {
+	prereq := &platformv1alpha1.PlatformOperator{}
+	if err := c.Get(ctx, client.ObjectKey{Name: d.Name}, prereq); err != nil {
+		if client.IgnoreNotFound(err) != nil {
+			return "", fmt.Errorf("failed to get the %s dependency: %w", d.Name, err)
+		}
+		return fmt.Sprintf("Waiting for the %s platform operator, which doesn't exist", d.Name), nil
+	}
+	active := prereq.Status.ActiveBundle
+	if active == nil || !meta.IsStatusConditionTrue(prereq.Status.Conditions, platformv1alpha1.TypeApplied) {
+		return fmt.Sprintf("Waiting for the %s platform operator to be installed", d.Name), nil
+	}
+	if versions == nil {
+		return "", nil
+	}
+	if v, err := semver.ParseTolerant(active.Version); err != nil || !versions(v) {
+		return fmt.Sprintf("Waiting for the %s platform operator to install a version in the %s range, while %s is installed", d.Name, d.Version, active.Version), nil
+	}
+	return "", nil
+}
+
+// findCycle returns the first dependency cycle that's reachable from the
+// PlatformOperator, as the names of the PlatformOperators along it.
+func findCycle(ctx context.Context, c client.Reader, po *platformv1alpha1.PlatformOperator) ([]string, error) {
+	var (
+		path    []string
+		onPath  = make(map[string]bool)
+		checked = make(map[string]bool)
+		visit   func(name string, deps []platformv1alpha1.Dependency) ([]string, error)
+	)
+	visit = func(name string, deps []platformv1alpha1.Dependency) ([]string, error) {
+		path = append(path, name)
+		onPath[name] = true
+		for _, d := range deps {
+			if onPath[d.Name] {
+				for i := range path {
+					if path[i] == d.Name {
+						return append(append([]string(nil), path[i:]...), d.Name), nil
+					}
+				}
+			}
+			if checked[d.Name] {
+				continue
+			}
+			prereq := &platformv1alpha1.PlatformOperator{}
+			if err := c.Get(ctx, client.ObjectKey{Name: d.Name}, prereq); err != nil {
+				if client.IgnoreNotFound(err) != nil {
+					return nil, fmt.Errorf("failed to get the %s dependency: %w", d.Name, err)
+				}
+				continue
+			}
+			if cycle, err := visit(prereq.Name, prereq.Spec.DependsOn); err != nil || cycle != nil {
+				return cycle, err
+			}
+		}
+		path = path[:len(path)-1]
+		onPath[name] = false
+		checked[name] = true
+		return nil, nil
+	}
+	return visit(po.Name, po.Spec.DependsOn)
+}
@@ -0,0 +1,197 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	platformv1alpha1 "github.com/openshift/platform-operators/api/v1alpha1"
+	"github.com/openshift/platform-operators/internal/resolver"
+	"github.com/openshift/platform-operators/internal/sourcer"
+)
+
+// newDependent returns a PlatformOperator that depends on the named ones, at any
+// version.
+func newDependent(name string, deps ...string) *platformv1alpha1.PlatformOperator {
+	po := &platformv1alpha1.PlatformOperator{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec:       platformv1alpha1.PlatformOperatorSpec{PackageName: name},
+	}
+	for _, d := range deps {
+		po.Spec.DependsOn = append(po.Spec.DependsOn, platformv1alpha1.Dependency{Name: d})
+	}
+	return po
+}
+
+// installed marks the PlatformOperator as having applied the version.
+func installed(po *platformv1alpha1.PlatformOperator, version string) *platformv1alpha1.PlatformOperator {
+	po.Status.ActiveBundle = &platformv1alpha1.ActiveBundle{Version: version}
+	po.Status.Conditions = []metav1.Condition{{Type: platformv1alpha1.TypeApplied, Status: metav1.ConditionTrue, Reason: platformv1alpha1.ReasonApplySuccessful}}
+	return po
+}
+
+func TestCheckDependencies(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		po      *platformv1alpha1.PlatformOperator
+		version string
+		objs    []client.Object
+		status  metav1.ConditionStatus
+		reason  string
+		message string
+	}{
+		{
+			name:    "installed prerequisites",
+			po:      newDependent("monitoring", "networking", "storage"),
+			version: ">=4.12.0",
+			objs:    []client.Object{installed(newDependent("networking"), "4.12.1"), installed(newDependent("storage"), "4.13.0")},
+			status:  metav1.ConditionTrue,
+			reason:  platformv1alpha1.ReasonAsExpected,
+			message: "All 2 prerequisite platform operators are installed",
+		},
+		{
+			name:    "missing prerequisite",
+			po:      newDependent("monitoring", "networking"),
+			status:  metav1.ConditionFalse,
+			reason:  platformv1alpha1.ReasonDependencyPending,
+			message: "Waiting for the networking platform operator, which doesn't exist",
+		},
+		{
+			name:    "prerequisite that isn't installed",
+			po:      newDependent("monitoring", "networking"),
+			objs:    []client.Object{newDependent("networking")},
+			status:  metav1.ConditionFalse,
+			reason:  platformv1alpha1.ReasonDependencyPending,
+			message: "Waiting for the networking platform operator to be installed",
+		},
+		{
+			name:    "prerequisite on an older version",
+			po:      newDependent("monitoring", "networking"),
+			version: ">=4.12.0",
+			objs:    []client.Object{installed(newDependent("networking"), "4.11.3")},
+			status:  metav1.ConditionFalse,
+			reason:  platformv1alpha1.ReasonDependencyPending,
+			message: "Waiting for the networking platform operator to install a version in the >=4.12.0 range, while 4.11.3 is installed",
+		},
+		{
+			name:    "invalid version range",
+			po:      newDependent("monitoring", "networking"),
+			version: "latest",
+			objs:    []client.Object{installed(newDependent("networking"), "4.12.0")},
+			status:  metav1.ConditionUnknown,
+			reason:  platformv1alpha1.ReasonDependencyCheckFailed,
+		},
+		{
+			name: "dependency cycle",
+			po:   newDependent("monitoring", "networking"),
+			objs: []client.Object{
+				installed(newDependent("networking", "storage"), "4.12.0"),
+				installed(newDependent("storage", "monitoring"), "4.12.0"),
+			},
+			status:  metav1.ConditionFalse,
+			reason:  platformv1alpha1.ReasonDependencyCycle,
+			message: "The monitoring -> networking -> storage -> monitoring dependency cycle can't be rolled out",
+		},
+		{
+			name:    "dependency cycle between prerequisites",
+			po:      newDependent("monitoring", "networking"),
+			objs:    []client.Object{installed(newDependent("networking", "networking"), "4.12.0")},
+			status:  metav1.ConditionFalse,
+			reason:  platformv1alpha1.ReasonDependencyCycle,
+			message: "The networking -> networking dependency cycle can't be rolled out",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := range tt.po.Spec.DependsOn {
+				tt.po.Spec.DependsOn[i].Version = tt.version
+			}
+			cond, err := checkDependencies(context.Background(), newFakeClient(t, tt.objs...), tt.po)
+			if (err != nil) != (tt.status == metav1.ConditionUnknown) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if cond.Status != tt.status || cond.Reason != tt.reason {
+				t.Fatalf("expected the condition to be %s with reason %s, got %+v", tt.status, tt.reason, cond)
+			}
+			if tt.message != "" && cond.Message != tt.message {
+				t.Errorf("expected the message %q, got %q", tt.message, cond.Message)
+			}
+		})
+	}
+}
+
+func TestReconcileDependencies(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		networking *platformv1alpha1.PlatformOperator
+		applied    bool
+		status     metav1.ConditionStatus
+	}{
+		{
+			name:       "holds the rollout until the prerequisite is installed",
+			networking: newDependent("networking"),
+			status:     metav1.ConditionFalse,
+		},
+		{
+			name:       "rolls out once the prerequisite is installed",
+			networking: installed(newDependent("networking"), "4.12.0"),
+			applied:    true,
+			status:     metav1.ConditionTrue,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			po := newDependent("monitoring", "networking")
+			c := &statusRecorder{Client: newFakeClient(t, po, tt.networking)}
+			a := &fakeApplier{}
+			r := &PlatformOperatorReconciler{
+				Client:   c,
+				Sourcer:  fakeSourcer{bundle: &sourcer.Bundle{Version: "0.0.1", Image: "quay.io/monitoring/bundle:v0.0.1"}},
+				Resolver: resolver.Fake{"quay.io/monitoring/bundle:v0.0.1": testDigest},
+				Applier:  a,
+			}
+			if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(po)}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if applied := a.applied != nil; applied != tt.applied {
+				t.Errorf("expected the bundle to be applied: %t, got %t", tt.applied, applied)
+			}
+			cond := meta.FindStatusCondition(c.status.Conditions, platformv1alpha1.TypeDependenciesInstalled)
+			if cond == nil || cond.Status != tt.status {
+				t.Errorf("expected the DependenciesInstalled condition to be %s, got %+v", tt.status, cond)
+			}
+		})
+	}
+}
+
+func TestReconcileDependencyCycleWhenInstalled(t *testing.T) {
+	// The monitoring platform operator was installed before the networking one
+	// started depending on it.
+	po := installed(newDependent("monitoring", "networking"), "0.0.1")
+	po.Status.ActiveBundle.Image = "quay.io/monitoring/bundle:v0.0.1"
+	po.Status.ActiveBundle.Digest = testDigest
+	c := &statusRecorder{Client: newFakeClient(t, po, installed(newDependent("networking", "monitoring"), "4.12.0"))}
+	a := &fakeApplier{}
+	r := &PlatformOperatorReconciler{
+		Client:   c,
+		Sourcer:  fakeSourcer{bundle: &sourcer.Bundle{Version: "0.0.1", Image: "quay.io/monitoring/bundle:v0.0.1"}},
+		Resolver: resolver.Fake{"quay.io/monitoring/bundle:v0.0.1": testDigest},
+		Applier:  a,
+	}
+	if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(po)}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cond := meta.FindStatusCondition(c.status.Conditions, platformv1alpha1.TypeDependenciesInstalled)
+	if cond == nil || cond.Status != metav1.ConditionFalse || cond.Reason != platformv1alpha1.ReasonDependencyCycle {
+		t.Fatalf("expected the dependency cycle to be reported, got %+v", cond)
+	}
+	if want := "The monitoring -> networking -> monitoring dependency cycle can't be rolled out"; cond.Message != want {
+		t.Errorf("expected the message %q, got %q", want, cond.Message)
+	}
+	if a.applied == nil {
+		t.Errorf("expected the installed content to be kept applied")
+	}
+}
@@ -18,13 +18,22 @@ package controllers
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strings"
 
+	"github.com/blang/semver/v4"
 	operatorsv1alpha1 "github.com/operator-framework/api/pkg/operators/v1alpha1"
 	rukpakv1alpha1 "github.com/operator-framework/rukpak/api/v1alpha1"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	batchv1 "k8s.io/api/batch/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	logr "sigs.k8s.io/controller-runtime/pkg/log"
@@ -32,31 +41,80 @@ import (
 
 	platformv1alpha1 "github.com/openshift/platform-operators/api/v1alpha1"
 	"github.com/openshift/platform-operators/internal/applier"
+	"github.com/openshift/platform-operators/internal/clusterversion"
+	"github.com/openshift/platform-operators/internal/health"
+	"github.com/openshift/platform-operators/internal/hooks"
+	"github.com/openshift/platform-operators/internal/metrics"
+	"github.com/openshift/platform-operators/internal/resolver"
 	"github.com/openshift/platform-operators/internal/sourcer"
+	"github.com/openshift/platform-operators/internal/tracing"
 	"github.com/openshift/platform-operators/internal/util"
+	"github.com/openshift/platform-operators/internal/verifier"
 )
 
 // PlatformOperatorReconciler reconciles a PlatformOperator object
 type PlatformOperatorReconciler struct {
 	client.Client
-	Sourcer sourcer.Sourcer
-	Applier applier.Applier
-	Scheme  *runtime.Scheme
+	Sourcer       sourcer.Sourcer
+	Resolver      resolver.Resolver
+	Applier       applier.Applier
+	Scheme        *runtime.Scheme
+	RequeuePolicy util.RequeuePolicy
+	// PackageIndex tracks the packages contained in each CatalogSource so that catalog
+	// events are only fanned out to the PlatformOperators referencing those packages.
+	PackageIndex util.PackageLister
+	// WatchCatalogSources determines whether CatalogSource events trigger reconciliations,
+	// and must be disabled when running without OLM installed.
+	WatchCatalogSources bool
+	// WatchBundleDeployments determines whether BundleDeployment events trigger
+	// reconciliations, and must be disabled when running without rukpak installed.
+	WatchBundleDeployments bool
+	// Verifier checks the signatures of bundle images before they're applied.
+	// Verification is skipped when no Verifier is configured.
+	Verifier verifier.Verifier
+	// ClusterVersion determines whether the installed bundles block the next minor
+	// OpenShift upgrade. The Upgradeable condition isn't reported when unset.
+	ClusterVersion clusterversion.Getter
+	// Health evaluates whether the workloads installed for the applied bundle are
+	// available. The Available condition isn't reported when unset.
+	Health health.Evaluator
+	// Hooks runs the hooks of the olm.bundle versions that are rolled out. Hooks
+	// aren't run when unset.
+	Hooks hooks.Runner
 }
 
 //+kubebuilder:rbac:groups=platform.openshift.io,resources=platformoperators,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=platform.openshift.io,resources=platformoperators/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=platform.openshift.io,resources=platformoperators/finalizers,verbs=update
 //+kubebuilder:rbac:groups=operators.coreos.com,resources=catalogsources,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch
+//+kubebuilder:rbac:groups=operator.openshift.io,resources=imagecontentsourcepolicies,verbs=get;list;watch
+//+kubebuilder:rbac:groups=config.openshift.io,resources=imagedigestmirrorsets,verbs=get;list;watch
+//+kubebuilder:rbac:groups=config.openshift.io,resources=clusterversions,verbs=get;list;watch
 //+kubebuilder:rbac:groups=core.rukpak.io,resources=bundledeployments,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=core.rukpak.io,resources=bundles,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=apiextensions.k8s.io,resources=customresourcedefinitions,verbs=get;list;watch
+//+kubebuilder:rbac:groups=apps,resources=deployments;daemonsets,verbs=get;list
+//+kubebuilder:rbac:groups=apiregistration.k8s.io,resources=apiservices,verbs=get;list
+//+kubebuilder:rbac:groups=admissionregistration.k8s.io,resources=validatingwebhookconfigurations;mutatingwebhookconfigurations,verbs=get;list
+//+kubebuilder:rbac:groups=core,resources=endpoints,verbs=get
+//+kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;delete
+//+kubebuilder:rbac:groups=core,resources=pods,verbs=list
+//+kubebuilder:rbac:groups=core,resources=pods/log,verbs=get
+//+kubebuilder:rbac:groups=core,resources=configmaps,verbs=create;update;delete
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
 //
 // For more details, check Reconcile and its Result here:
 // - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.10.0/pkg/reconcile
-func (r *PlatformOperatorReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+func (r *PlatformOperatorReconciler) Reconcile(ctx context.Context, req ctrl.Request) (res ctrl.Result, reterr error) {
+	ctx, span := tracing.StartSpan(ctx, "Reconcile", trace.WithAttributes(attribute.String("platformoperator", req.Name)))
+	defer func() {
+		tracing.RecordError(span, reterr)
+		span.End()
+	}()
+
 	log := logr.FromContext(ctx)
 	log.Info("reconciling request", "req", req.NamespacedName)
 	defer log.Info("finished reconciling request", "req", req.NamespacedName)
@@ -64,9 +122,18 @@ func (r *PlatformOperatorReconciler) Reconcile(ctx context.Context, req ctrl.Req
 	// TODO: flesh out status condition management
 	po := &platformv1alpha1.PlatformOperator{}
 	if err := r.Get(ctx, req.NamespacedName, po); err != nil {
+		if apierrors.IsNotFound(err) {
+			metrics.Forget(req.Name)
+			r.Applier.Forget(req.Name)
+		}
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 	defer func() {
+		if err := r.setUpgradeable(ctx, po); err != nil {
+			log.Error(err, "failed to determine whether the platform operator is upgradeable")
+		}
+		metrics.RecordConditions(po)
+
 		po := po.DeepCopy()
 		po.ObjectMeta.ManagedFields = nil
 		if err := r.Status().Patch(ctx, po, client.Apply, client.FieldOwner("platformoperator")); err != nil {
@@ -74,7 +141,7 @@ func (r *PlatformOperatorReconciler) Reconcile(ctx context.Context, req ctrl.Req
 		}
 	}()
 
-	desiredBundle, err := r.Sourcer.Source(ctx, po)
+	desiredBundle, err := r.source(ctx, po)
 	if err != nil {
 		meta.SetStatusCondition(&po.Status.Conditions, metav1.Condition{
 			Type:    platformv1alpha1.TypeSourced,
@@ -82,38 +149,555 @@ func (r *PlatformOperatorReconciler) Reconcile(ctx context.Context, req ctrl.Req
 			Reason:  platformv1alpha1.ReasonSourceFailed,
 			Message: err.Error(),
 		})
-		return ctrl.Result{}, err
+		return r.requeue(ctx, po, err)
+	}
+	po.Status.ExcludedBundles = nil
+	for _, e := range desiredBundle.Excluded {
+		po.Status.ExcludedBundles = append(po.Status.ExcludedBundles, platformv1alpha1.ExcludedBundle{
+			Name:    e.Bundle.Name,
+			Version: e.Bundle.Version,
+			Catalog: e.Bundle.Catalog,
+			Reason:  e.Reason,
+		})
 	}
+
+	active, err := r.pin(ctx, po, desiredBundle)
+	if err != nil {
+		meta.SetStatusCondition(&po.Status.Conditions, metav1.Condition{
+			Type:    platformv1alpha1.TypeSourced,
+			Status:  metav1.ConditionUnknown,
+			Reason:  platformv1alpha1.ReasonImageResolutionFailed,
+			Message: err.Error(),
+		})
+		return r.requeue(ctx, po, err)
+	}
+	pinnedBundle := *desiredBundle
+	if pinnedBundle.Image, err = resolver.Pin(active.Image, active.Digest); err != nil {
+		// The image reference or the digest it resolved to is malformed, which
+		// retrying won't fix.
+		meta.SetStatusCondition(&po.Status.Conditions, metav1.Condition{
+			Type:    platformv1alpha1.TypeSourced,
+			Status:  metav1.ConditionFalse,
+			Reason:  platformv1alpha1.ReasonImageResolutionFailed,
+			Message: fmt.Sprintf("Failed to pin the %s image to the %s digest: %v", active.Image, active.Digest, err),
+		})
+		return r.requeue(ctx, po, util.NewPermanentError(err))
+	}
+	metrics.RecordSourced(po, desiredBundle.Version)
 	meta.SetStatusCondition(&po.Status.Conditions, metav1.Condition{
 		Type:    platformv1alpha1.TypeSourced,
 		Status:  metav1.ConditionTrue,
 		Reason:  platformv1alpha1.ReasonSourceSuccessful,
 		Message: "Successfully sourced the desired olm.bundle content",
 	})
+	pinnedImage := pinnedBundle.Image
+	if r.Verifier != nil {
+		if err := r.verify(ctx, po, &pinnedBundle); err != nil {
+			cond := metav1.Condition{
+				Type:    platformv1alpha1.TypeVerified,
+				Status:  metav1.ConditionFalse,
+				Message: err.Error(),
+			}
+			switch {
+			case errors.Is(err, verifier.ErrUnsigned):
+				cond.Reason = platformv1alpha1.ReasonUnsigned
+			case errors.Is(err, verifier.ErrUntrusted):
+				cond.Reason = platformv1alpha1.ReasonUntrusted
+			default:
+				cond.Status = metav1.ConditionUnknown
+				cond.Reason = platformv1alpha1.ReasonVerificationFailed
+				meta.SetStatusCondition(&po.Status.Conditions, cond)
+				return r.requeue(ctx, po, err)
+			}
+			meta.SetStatusCondition(&po.Status.Conditions, cond)
+			// The bundle may still be signed by its publisher, so check again on
+			// the next resync rather than backing off.
+			log.Info("refusing to apply unverified bundle content", "image", pinnedBundle.Image, "reason", cond.Reason)
+			return r.requeue(ctx, po, nil)
+		}
+		meta.SetStatusCondition(&po.Status.Conditions, metav1.Condition{
+			Type:    platformv1alpha1.TypeVerified,
+			Status:  metav1.ConditionTrue,
+			Reason:  platformv1alpha1.ReasonSignatureVerified,
+			Message: fmt.Sprintf("The %s image is signed by a trusted key", pinnedBundle.Image),
+		})
+	}
+
+	po.Status.Diff = nil
+	if po.Spec.DryRun {
+		d, err := r.diff(ctx, po, &pinnedBundle)
+		if err != nil {
+			return r.requeue(ctx, po, err)
+		}
+		po.Status.Diff = d
+		log.Info("previewed the olm.bundle content rather than applying it", "version", desiredBundle.Version,
+			"added", len(d.Added), "removed", len(d.Removed), "changed", len(d.Changed))
+		return r.requeue(ctx, po, nil)
+	}
+
+	if len(po.Spec.DependsOn) == 0 {
+		meta.RemoveStatusCondition(&po.Status.Conditions, platformv1alpha1.TypeDependenciesInstalled)
+	} else {
+		// The dependencies are checked on every reconciliation, so cycles that
+		// are introduced once the content is installed are reported too. The
+		// installed content is kept as is though, and only rollouts are held.
+		cond, err := checkDependencies(ctx, r.Client, po)
+		meta.SetStatusCondition(&po.Status.Conditions, cond)
+		if isInstalled(po, active) {
+			if err != nil {
+				log.Error(err, "failed to check the dependencies of the installed olm.bundle content")
+			}
+		} else if err != nil || cond.Status != metav1.ConditionTrue {
+			if err == nil {
+				// The prerequisites requeue their dependents as they change.
+				log.Info("holding the olm.bundle content until its prerequisites are installed", "version", desiredBundle.Version, "reason", cond.Reason)
+			}
+			return r.requeue(ctx, po, err)
+		}
+	}
+
+	var drifted []applier.Drift
+	if isInstalled(po, active) {
+		drifted, err = r.drift(ctx, po, &pinnedBundle)
+		switch {
+		case err != nil:
+			log.Error(err, "failed to detect drift of the installed olm.bundle content")
+			meta.SetStatusCondition(&po.Status.Conditions, metav1.Condition{
+				Type:    platformv1alpha1.TypeDrifted,
+				Status:  metav1.ConditionUnknown,
+				Reason:  platformv1alpha1.ReasonDriftCheckFailed,
+				Message: err.Error(),
+			})
+		case len(drifted) == 0:
+			meta.SetStatusCondition(&po.Status.Conditions, metav1.Condition{
+				Type:    platformv1alpha1.TypeDrifted,
+				Status:  metav1.ConditionFalse,
+				Reason:  platformv1alpha1.ReasonNoDrift,
+				Message: "The installed objects match the olm.bundle content",
+			})
+		case po.Spec.DriftPolicy != platformv1alpha1.DriftPolicyRemediate:
+			meta.SetStatusCondition(&po.Status.Conditions, metav1.Condition{
+				Type:    platformv1alpha1.TypeDrifted,
+				Status:  metav1.ConditionTrue,
+				Reason:  platformv1alpha1.ReasonDriftDetected,
+				Message: fmt.Sprintf("%d objects have drifted from the olm.bundle content: %s", len(drifted), joinDrift(drifted)),
+			})
+			// Re-applying the unchanged bundle would restore the drifted
+			// objects, so it's only reported.
+			log.Info("installed objects have drifted from the olm.bundle content", "count", len(drifted))
+			if r.Health != nil {
+				r.setAvailable(ctx, po, desiredBundle)
+			}
+			return r.requeue(ctx, po, nil)
+		}
+	}
 
-	if err := r.Applier.Apply(ctx, po, desiredBundle); err != nil {
+	var declaredHooks []platformv1alpha1.Hook
+	if r.Hooks != nil {
+		if declaredHooks, err = r.declaredHooks(ctx, po, &pinnedBundle); err != nil {
+			meta.SetStatusCondition(&po.Status.Conditions, metav1.Condition{
+				Type:    platformv1alpha1.TypeHooksSucceeded,
+				Status:  metav1.ConditionUnknown,
+				Reason:  platformv1alpha1.ReasonHookRunFailed,
+				Message: err.Error(),
+			})
+			return r.requeue(ctx, po, err)
+		}
+	}
+	if len(declaredHooks) != 0 && !isInstalled(po, active) {
+		succeeded, err := r.runHooks(ctx, po, desiredBundle.Version, platformv1alpha1.HookPhasePreApply, declaredHooks)
+		if err != nil || !succeeded {
+			if err == nil {
+				log.Info("holding the olm.bundle content until its pre-apply hooks succeed", "version", desiredBundle.Version)
+			}
+			return r.requeue(ctx, po, err)
+		}
+	}
+
+	upgradeBlocked := metav1.Condition{
+		Type:    platformv1alpha1.TypeUpgradeBlocked,
+		Status:  metav1.ConditionFalse,
+		Reason:  platformv1alpha1.ReasonAsExpected,
+		Message: "The CRDs of the applied olm.bundle are compatible with the existing custom resources",
+	}
+	err = r.apply(ctx, po, &pinnedBundle)
+	if errors.Is(err, applier.ErrUpgradeUnverified) {
+		// The content was applied, but whether it broke the existing custom
+		// resources is unknown.
+		upgradeBlocked.Status = metav1.ConditionUnknown
+		upgradeBlocked.Reason = platformv1alpha1.ReasonResourcesUnchecked
+		upgradeBlocked.Message = err.Error()
+		err = nil
+	}
+	if err != nil {
+		if errors.Is(err, applier.ErrUpgradeBlocked) {
+			meta.SetStatusCondition(&po.Status.Conditions, metav1.Condition{
+				Type:    platformv1alpha1.TypeUpgradeBlocked,
+				Status:  metav1.ConditionTrue,
+				Reason:  platformv1alpha1.ReasonIncompatibleCRDChange,
+				Message: err.Error(),
+			})
+			// The existing custom resources may still be migrated by their
+			// owners, so check again on the next resync rather than backing off.
+			log.Info("refusing to apply olm.bundle content that would break existing custom resources", "version", desiredBundle.Version)
+			return r.requeue(ctx, po, nil)
+		}
+		if errors.Is(err, applier.ErrFieldConflict) {
+			meta.SetStatusCondition(&po.Status.Conditions, metav1.Condition{
+				Type:    platformv1alpha1.TypeApplyConflict,
+				Status:  metav1.ConditionTrue,
+				Reason:  platformv1alpha1.ReasonFieldManagerConflict,
+				Message: err.Error(),
+			})
+			// The conflicting changes are kept until they're reverted or
+			// spec.forceConflicts is set, which both trigger a reconciliation.
+			log.Info("refusing to overwrite conflicting changes to the applied olm.bundle content", "version", desiredBundle.Version)
+			return r.requeue(ctx, po, nil)
+		}
 		meta.SetStatusCondition(&po.Status.Conditions, metav1.Condition{
 			Type:    platformv1alpha1.TypeApplied,
 			Status:  metav1.ConditionUnknown,
 			Reason:  platformv1alpha1.ReasonApplyFailed,
 			Message: err.Error(),
 		})
-		return ctrl.Result{}, err
+		return r.requeue(ctx, po, err)
 	}
+	meta.SetStatusCondition(&po.Status.Conditions, upgradeBlocked)
+	meta.SetStatusCondition(&po.Status.Conditions, metav1.Condition{
+		Type:    platformv1alpha1.TypeApplyConflict,
+		Status:  metav1.ConditionFalse,
+		Reason:  platformv1alpha1.ReasonAsExpected,
+		Message: "The olm.bundle content was applied without conflicting with other field managers",
+	})
+	if len(drifted) != 0 {
+		meta.SetStatusCondition(&po.Status.Conditions, metav1.Condition{
+			Type:    platformv1alpha1.TypeDrifted,
+			Status:  metav1.ConditionFalse,
+			Reason:  platformv1alpha1.ReasonDriftRemediated,
+			Message: fmt.Sprintf("Restored %d objects that had drifted from the olm.bundle content: %s", len(drifted), joinDrift(drifted)),
+		})
+		log.Info("restored installed objects that had drifted from the olm.bundle content", "count", len(drifted))
+	}
+	if pinnedBundle.Image != pinnedImage {
+		active.MirroredImage = pinnedBundle.Image
+	}
+	if max, err := sourcer.MaxOpenShiftVersion(desiredBundle.Properties); err == nil && max != nil {
+		active.MaxOpenShiftVersion = fmt.Sprintf("%d.%d", max.Major, max.Minor)
+	}
+	active.Name = desiredBundle.Name
+	active.DisplayName = desiredBundle.CSV.DisplayName
+	active.Provider = desiredBundle.CSV.Provider
+	for _, gvk := range desiredBundle.ProvidedAPIs {
+		active.ProvidedAPIs = append(active.ProvidedAPIs, metav1.GroupVersionKind{Group: gvk.Group, Version: gvk.Version, Kind: gvk.Kind})
+	}
+	for _, ri := range desiredBundle.RelatedImages {
+		active.RelatedImages = append(active.RelatedImages, platformv1alpha1.RelatedImage{Name: ri.Name, Image: ri.Image})
+	}
+	po.Status.ActiveBundle = active
+	setDeprecated(po, desiredBundle)
+	metrics.RecordApplied(po, desiredBundle.Version, desiredBundle.Channel, desiredBundle.Catalog)
 	meta.SetStatusCondition(&po.Status.Conditions, metav1.Condition{
 		Type:    platformv1alpha1.TypeApplied,
 		Status:  metav1.ConditionTrue,
 		Reason:  platformv1alpha1.ReasonApplySuccessful,
 		Message: "Successfully applied the desired olm.bundle content",
 	})
-	return ctrl.Result{}, nil
+	if r.Health != nil {
+		r.setAvailable(ctx, po, desiredBundle)
+	}
+	// Post-install hooks wait for the workloads to be available, when their
+	// health is evaluated.
+	if len(declaredHooks) != 0 && (r.Health == nil || meta.IsStatusConditionTrue(po.Status.Conditions, platformv1alpha1.TypeAvailable)) {
+		if _, err := r.runHooks(ctx, po, desiredBundle.Version, platformv1alpha1.HookPhasePostInstall, declaredHooks); err != nil {
+			return r.requeue(ctx, po, err)
+		}
+	}
+	return r.requeue(ctx, po, nil)
+}
+
+// requeue determines when the PlatformOperator should be reconciled next based on
+// the error the reconciliation finished with, and records that decision in status.
+func (r *PlatformOperatorReconciler) requeue(ctx context.Context, po *platformv1alpha1.PlatformOperator, err error) (ctrl.Result, error) {
+	res, err := r.RequeuePolicy.Result(err)
+
+	po.Status.RequeueAfter = nil
+	if res.RequeueAfter > 0 {
+		po.Status.RequeueAfter = &metav1.Duration{Duration: res.RequeueAfter}
+		logr.FromContext(ctx).V(1).Info("requeueing request", "after", res.RequeueAfter.String())
+	}
+	return res, err
+}
+
+func (r *PlatformOperatorReconciler) source(ctx context.Context, po *platformv1alpha1.PlatformOperator) (*sourcer.Bundle, error) {
+	ctx, span := tracing.StartSpan(ctx, "Sourcer.Source", trace.WithAttributes(attribute.String("package", po.Spec.PackageName)))
+	defer span.End()
+
+	b, err := r.Sourcer.Source(ctx, po)
+	if err != nil {
+		tracing.RecordError(span, err)
+		return nil, err
+	}
+	span.SetAttributes(attribute.String("version", b.Version), attribute.String("catalog", b.Catalog), attribute.String("origin", b.Origin))
+	return b, nil
+}
+
+// pin resolves the bundle's image to a digest. The digest recorded in status is
+// kept for as long as the catalog publishes the same bundle, so a tag that's
+// re-pushed under an unchanged version is flagged instead of silently rolled out.
+func (r *PlatformOperatorReconciler) pin(ctx context.Context, po *platformv1alpha1.PlatformOperator, b *sourcer.Bundle) (*platformv1alpha1.ActiveBundle, error) {
+	ctx, span := tracing.StartSpan(ctx, "Resolver.Resolve", trace.WithAttributes(attribute.String("image", b.Image)))
+	defer span.End()
+
+	digest, err := r.Resolver.Resolve(ctx, b.Image)
+	if err != nil {
+		tracing.RecordError(span, err)
+		return nil, err
+	}
+	span.SetAttributes(attribute.String("digest", digest))
+
+	active := &platformv1alpha1.ActiveBundle{Version: b.Version, Image: b.Image, Digest: digest}
+	prev := po.Status.ActiveBundle
+	if prev == nil || prev.Version != b.Version || prev.Image != b.Image || prev.Digest == digest {
+		meta.SetStatusCondition(&po.Status.Conditions, metav1.Condition{
+			Type:    platformv1alpha1.TypeImageDrifted,
+			Status:  metav1.ConditionFalse,
+			Reason:  platformv1alpha1.ReasonDigestUnchanged,
+			Message: fmt.Sprintf("The %s image is pinned to %s", b.Image, digest),
+		})
+		return active, nil
+	}
+	meta.SetStatusCondition(&po.Status.Conditions, metav1.Condition{
+		Type:   platformv1alpha1.TypeImageDrifted,
+		Status: metav1.ConditionTrue,
+		Reason: platformv1alpha1.ReasonDigestChanged,
+		Message: fmt.Sprintf("The %s image now resolves to %s while the %s version is unchanged; continuing to use the pinned %s digest",
+			b.Image, digest, b.Version, prev.Digest),
+	})
+	active.Digest = prev.Digest
+	return active, nil
+}
+
+// isInstalled determines whether the bundle has already been applied, in which
+// case the installed objects are checked for drift.
+func isInstalled(po *platformv1alpha1.PlatformOperator, b *platformv1alpha1.ActiveBundle) bool {
+	prev := po.Status.ActiveBundle
+	return prev != nil && prev.Version == b.Version && prev.Digest == b.Digest &&
+		meta.IsStatusConditionTrue(po.Status.Conditions, platformv1alpha1.TypeApplied)
+}
+
+func joinDrift(drifted []applier.Drift) string {
+	refs := make([]string, 0, len(drifted))
+	for _, d := range drifted {
+		refs = append(refs, d.String())
+	}
+	return strings.Join(refs, "; ")
+}
+
+// setUpgradeable reports whether the installed bundle is compatible with the next
+// minor version of OpenShift, so that cluster upgrades it would break are blocked.
+func (r *PlatformOperatorReconciler) setUpgradeable(ctx context.Context, po *platformv1alpha1.PlatformOperator) error {
+	if r.ClusterVersion == nil || po.Status.ActiveBundle == nil {
+		return nil
+	}
+	versions, err := r.ClusterVersion.Get(ctx)
+	if err != nil {
+		return err
+	}
+	if versions.OpenShift == nil {
+		return nil
+	}
+
+	cond := metav1.Condition{
+		Type:    platformv1alpha1.TypeUpgradeable,
+		Status:  metav1.ConditionTrue,
+		Reason:  platformv1alpha1.ReasonAsExpected,
+		Message: "The installed olm.bundle is compatible with the next minor OpenShift version",
+	}
+	if active := po.Status.ActiveBundle; active.MaxOpenShiftVersion != "" {
+		max, err := semver.ParseTolerant(active.MaxOpenShiftVersion)
+		if err != nil {
+			return err
+		}
+		next := semver.Version{Major: versions.OpenShift.Major, Minor: versions.OpenShift.Minor + 1}
+		if !sourcer.SupportsOpenShiftVersion(max, next) {
+			cond.Status = metav1.ConditionFalse
+			cond.Reason = platformv1alpha1.ReasonIncompatibleVersion
+			cond.Message = fmt.Sprintf("The installed %s version supports OpenShift %s at most, which blocks upgrades to OpenShift %d.%d",
+				active.Version, active.MaxOpenShiftVersion, next.Major, next.Minor)
+		}
+	}
+	meta.SetStatusCondition(&po.Status.Conditions, cond)
+	return nil
+}
+
+// setDeprecated reports whether the catalog has deprecated the installed bundle,
+// its channel or its package, carrying the catalog's message along.
+func setDeprecated(po *platformv1alpha1.PlatformOperator, b *sourcer.Bundle) {
+	cond := metav1.Condition{
+		Type:    platformv1alpha1.TypeDeprecated,
+		Status:  metav1.ConditionFalse,
+		Reason:  platformv1alpha1.ReasonNotDeprecated,
+		Message: fmt.Sprintf("The installed %s version isn't deprecated", b.Version),
+	}
+	if len(b.Deprecations) != 0 {
+		cond.Status = metav1.ConditionTrue
+		cond.Reason = platformv1alpha1.ReasonDeprecated
+		cond.Message = b.DeprecationMessage()
+	}
+	meta.SetStatusCondition(&po.Status.Conditions, cond)
+}
+
+// setAvailable reports whether the workloads installed for the applied bundle are
+// available. Failing to evaluate their health doesn't fail the reconciliation, as
+// the bundle has been applied regardless.
+func (r *PlatformOperatorReconciler) setAvailable(ctx context.Context, po *platformv1alpha1.PlatformOperator, b *sourcer.Bundle) {
+	ctx, span := tracing.StartSpan(ctx, "Health.Evaluate")
+	defer span.End()
+
+	cond := metav1.Condition{Type: platformv1alpha1.TypeAvailable}
+	report, err := r.Health.Evaluate(ctx, po, b)
+	tracing.RecordError(span, err)
+	switch {
+	case err != nil:
+		logr.FromContext(ctx).Error(err, "failed to evaluate the health of the installed olm.bundle content")
+		cond.Status = metav1.ConditionUnknown
+		cond.Reason = platformv1alpha1.ReasonHealthCheckFailed
+		cond.Message = err.Error()
+	case report.Evaluated == 0:
+		cond.Status = metav1.ConditionUnknown
+		cond.Reason = platformv1alpha1.ReasonNoWorkloads
+		cond.Message = "No workloads were found for the installed olm.bundle content"
+	case len(report.Unhealthy) != 0:
+		cond.Status = metav1.ConditionFalse
+		cond.Reason = platformv1alpha1.ReasonUnavailable
+		cond.Message = fmt.Sprintf("%d of %d workloads are unavailable: %s", len(report.Unhealthy), report.Evaluated, strings.Join(report.Unhealthy, "; "))
+	default:
+		cond.Status = metav1.ConditionTrue
+		cond.Reason = platformv1alpha1.ReasonAsExpected
+		cond.Message = fmt.Sprintf("All %d workloads of the installed olm.bundle content are available", report.Evaluated)
+	}
+	if err == nil && len(report.Skipped) != 0 {
+		cond.Message += fmt.Sprintf("; %d health probes were skipped: %s", len(report.Skipped), strings.Join(report.Skipped, "; "))
+	}
+	meta.SetStatusCondition(&po.Status.Conditions, cond)
+}
+
+func (r *PlatformOperatorReconciler) verify(ctx context.Context, po *platformv1alpha1.PlatformOperator, b *sourcer.Bundle) error {
+	ctx, span := tracing.StartSpan(ctx, "Verifier.Verify", trace.WithAttributes(attribute.String("image", b.Image)))
+	defer span.End()
+
+	err := r.Verifier.Verify(ctx, po, b)
+	tracing.RecordError(span, err)
+	return err
+}
+
+func (r *PlatformOperatorReconciler) apply(ctx context.Context, po *platformv1alpha1.PlatformOperator, b *sourcer.Bundle) error {
+	ctx, span := tracing.StartSpan(ctx, "Applier.Apply", trace.WithAttributes(attribute.String("image", b.Image)))
+	defer span.End()
+
+	err := r.Applier.Apply(ctx, po, b)
+	tracing.RecordError(span, err)
+	return err
+}
+
+func (r *PlatformOperatorReconciler) diff(ctx context.Context, po *platformv1alpha1.PlatformOperator, b *sourcer.Bundle) (*platformv1alpha1.BundleDiff, error) {
+	ctx, span := tracing.StartSpan(ctx, "Applier.Diff", trace.WithAttributes(attribute.String("image", b.Image)))
+	defer span.End()
+
+	d, err := r.Applier.Diff(ctx, po, b)
+	tracing.RecordError(span, err)
+	return d, err
+}
+
+func (r *PlatformOperatorReconciler) drift(ctx context.Context, po *platformv1alpha1.PlatformOperator, b *sourcer.Bundle) ([]applier.Drift, error) {
+	ctx, span := tracing.StartSpan(ctx, "Applier.Drift", trace.WithAttributes(attribute.String("image", b.Image)))
+	defer span.End()
+
+	drifted, err := r.Applier.Drift(ctx, po, b)
+	tracing.RecordError(span, err)
+	return drifted, err
+}
+
+// declaredHooks returns the hooks declared by the bundle and the PlatformOperator.
+// A hook declared by the bundle is replaced by the PlatformOperator's hook with
+// the same name and phase.
+func (r *PlatformOperatorReconciler) declaredHooks(ctx context.Context, po *platformv1alpha1.PlatformOperator, b *sourcer.Bundle) ([]platformv1alpha1.Hook, error) {
+	ctx, span := tracing.StartSpan(ctx, "Applier.Hooks", trace.WithAttributes(attribute.String("image", b.Image)))
+	defer span.End()
+
+	bundled, err := r.Applier.Hooks(ctx, po, b)
+	if err != nil {
+		tracing.RecordError(span, err)
+		return nil, err
+	}
+	overridden := make(map[string]bool, len(po.Spec.Hooks))
+	for _, h := range po.Spec.Hooks {
+		overridden[string(h.Phase)+"/"+h.Name] = true
+	}
+	declared := make([]platformv1alpha1.Hook, 0, len(bundled)+len(po.Spec.Hooks))
+	for _, h := range bundled {
+		if !overridden[string(h.Phase)+"/"+h.Name] {
+			declared = append(declared, h)
+		}
+	}
+	return append(declared, po.Spec.Hooks...), nil
+}
+
+// runHooks runs the hooks of the phase, reporting their progress in the
+// HooksSucceeded condition, and returns whether each of them has succeeded. A
+// failed hook isn't an error, as it's only run again once its Job changes.
+func (r *PlatformOperatorReconciler) runHooks(ctx context.Context, po *platformv1alpha1.PlatformOperator, version string, phase platformv1alpha1.HookPhase, declared []platformv1alpha1.Hook) (bool, error) {
+	ctx, span := tracing.StartSpan(ctx, "Hooks.Run", trace.WithAttributes(attribute.String("phase", string(phase))))
+	defer span.End()
+
+	pending, err := r.Hooks.Run(ctx, po, version, phase, declared)
+	tracing.RecordError(span, err)
+	cond := metav1.Condition{Type: platformv1alpha1.TypeHooksSucceeded}
+	switch {
+	case errors.Is(err, hooks.ErrHookFailed):
+		cond.Status = metav1.ConditionFalse
+		cond.Reason = platformv1alpha1.ReasonHookFailed
+		cond.Message = err.Error()
+		err = nil
+	case err != nil:
+		cond.Status = metav1.ConditionUnknown
+		cond.Reason = platformv1alpha1.ReasonHookRunFailed
+		cond.Message = err.Error()
+	case pending != "":
+		cond.Status = metav1.ConditionFalse
+		cond.Reason = platformv1alpha1.ReasonHookPending
+		cond.Message = fmt.Sprintf("Waiting for the %s %s hook of the %s version to complete", pending, phase, version)
+	default:
+		cond.Status = metav1.ConditionTrue
+		cond.Reason = platformv1alpha1.ReasonAsExpected
+		cond.Message = fmt.Sprintf("The %s hooks of the %s version succeeded", phase, version)
+	}
+	meta.SetStatusCondition(&po.Status.Conditions, cond)
+	return cond.Status == metav1.ConditionTrue, err
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *PlatformOperatorReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &platformv1alpha1.PlatformOperator{}, util.PackageNameIndexKey, util.IndexPackageName); err != nil {
+		return err
+	}
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &platformv1alpha1.PlatformOperator{}, util.SourcedIndexKey, util.IndexSourced); err != nil {
+		return err
+	}
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &platformv1alpha1.PlatformOperator{}, util.DependsOnIndexKey, util.IndexDependsOn); err != nil {
+		return err
+	}
+	b := ctrl.NewControllerManagedBy(mgr).
 		For(&platformv1alpha1.PlatformOperator{}).
-		Watches(&source.Kind{Type: &operatorsv1alpha1.CatalogSource{}}, handler.EnqueueRequestsFromMapFunc(util.RequeuePlatformOperators(mgr.GetClient()))).
-		Watches(&source.Kind{Type: &rukpakv1alpha1.BundleDeployment{}}, handler.EnqueueRequestsFromMapFunc(util.RequeueBundleDeployment(mgr.GetClient()))).
-		Complete(r)
+		Watches(&source.Kind{Type: &platformv1alpha1.PlatformOperator{}}, handler.EnqueueRequestsFromMapFunc(util.RequeueDependents(mgr.GetClient())))
+	if r.WatchBundleDeployments {
+		b = b.Watches(&source.Kind{Type: &rukpakv1alpha1.BundleDeployment{}}, handler.EnqueueRequestsFromMapFunc(util.RequeueBundleDeployment(mgr.GetClient())), builder.WithPredicates(util.BundleDeploymentChanged()))
+	}
+	if r.Hooks != nil {
+		b = b.Owns(&batchv1.Job{})
+	}
+	if r.WatchCatalogSources {
+		b = b.Watches(&source.Kind{Type: &operatorsv1alpha1.CatalogSource{}}, handler.EnqueueRequestsFromMapFunc(util.RequeuePlatformOperators(mgr.GetClient(), r.PackageIndex)), builder.WithPredicates(util.CatalogSourceChanged()))
+	}
+	return b.Complete(r)
 }
@@ -0,0 +1,949 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/blang/semver/v4"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/operator-framework/operator-registry/alpha/property"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	platformv1alpha1 "github.com/openshift/platform-operators/api/v1alpha1"
+	"github.com/openshift/platform-operators/internal/applier"
+	"github.com/openshift/platform-operators/internal/clusterversion"
+	"github.com/openshift/platform-operators/internal/health"
+	"github.com/openshift/platform-operators/internal/hooks"
+	"github.com/openshift/platform-operators/internal/mirror"
+	"github.com/openshift/platform-operators/internal/resolver"
+	"github.com/openshift/platform-operators/internal/sourcer"
+	"github.com/openshift/platform-operators/internal/verifier"
+)
+
+type fakeSourcer struct {
+	bundle *sourcer.Bundle
+	err    error
+}
+
+func (f fakeSourcer) Source(context.Context, *platformv1alpha1.PlatformOperator) (*sourcer.Bundle, error) {
+	return f.bundle, f.err
+}
+
+type fakeApplier struct {
+	err     error
+	applied *sourcer.Bundle
+	// mirrors rewrites applied images, as the applier does for mirrored images.
+	mirrors []mirror.Mirror
+	diffed  *sourcer.Bundle
+	drifted []applier.Drift
+	hooks   []platformv1alpha1.Hook
+}
+
+func (f *fakeApplier) Apply(_ context.Context, _ *platformv1alpha1.PlatformOperator, b *sourcer.Bundle) error {
+	image, err := mirror.Rewrite(b.Image, f.mirrors)
+	if err != nil {
+		return err
+	}
+	b.Image = image
+	f.applied = b
+	return f.err
+}
+
+func (f *fakeApplier) Diff(_ context.Context, po *platformv1alpha1.PlatformOperator, b *sourcer.Bundle) (*platformv1alpha1.BundleDiff, error) {
+	f.diffed = b
+	d := &platformv1alpha1.BundleDiff{ToVersion: b.Version}
+	if po.Status.ActiveBundle != nil {
+		d.FromVersion = po.Status.ActiveBundle.Version
+	}
+	return d, f.err
+}
+
+func (f *fakeApplier) Hooks(context.Context, *platformv1alpha1.PlatformOperator, *sourcer.Bundle) ([]platformv1alpha1.Hook, error) {
+	return f.hooks, nil
+}
+
+func (f *fakeApplier) Drift(context.Context, *platformv1alpha1.PlatformOperator, *sourcer.Bundle) ([]applier.Drift, error) {
+	return f.drifted, nil
+}
+
+func (f *fakeApplier) Forget(string) {}
+
+// statusRecorder captures the status patched by the reconciler, as the fake
+// client doesn't support server-side apply.
+type statusRecorder struct {
+	client.Client
+	status *platformv1alpha1.PlatformOperatorStatus
+}
+
+func (r *statusRecorder) Status() client.StatusWriter {
+	return recordingStatusWriter{r}
+}
+
+type recordingStatusWriter struct {
+	*statusRecorder
+}
+
+func (w recordingStatusWriter) Update(context.Context, client.Object, ...client.UpdateOption) error {
+	return nil
+}
+
+func (w recordingStatusWriter) Patch(_ context.Context, obj client.Object, _ client.Patch, _ ...client.PatchOption) error {
+	w.status = obj.(*platformv1alpha1.PlatformOperator).Status.DeepCopy()
+	return nil
+}
+
+const (
+	testDigest     = "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+	repushedDigest = "sha256:2222222222222222222222222222222222222222222222222222222222222222"
+)
+
+func newFakeClient(t *testing.T, objs ...client.Object) client.Client {
+	t.Helper()
+
+	scheme := runtime.NewScheme()
+	if err := platformv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	return fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
+}
+
+func TestReconcileTracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+
+	po := &platformv1alpha1.PlatformOperator{
+		ObjectMeta: metav1.ObjectMeta{Name: "combo"},
+		Spec:       platformv1alpha1.PlatformOperatorSpec{PackageName: "combo"},
+	}
+	r := &PlatformOperatorReconciler{
+		Client:   newFakeClient(t, po),
+		Sourcer:  fakeSourcer{bundle: &sourcer.Bundle{Version: "0.0.1", Image: "quay.io/combo/bundle:v0.0.1"}},
+		Resolver: resolver.Fake{"quay.io/combo/bundle:v0.0.1": testDigest},
+		Applier:  &fakeApplier{},
+	}
+	if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(po)}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	spans := exporter.GetSpans()
+	byName := make(map[string]tracetest.SpanStub)
+	for _, span := range spans {
+		byName[span.Name] = span
+	}
+	root, ok := byName["Reconcile"]
+	if !ok {
+		t.Fatalf("expected a Reconcile span, got %v", spans)
+	}
+	for _, name := range []string{"Sourcer.Source", "Resolver.Resolve", "Applier.Apply"} {
+		span, ok := byName[name]
+		if !ok {
+			t.Fatalf("expected a %s span, got %v", name, spans)
+		}
+		if span.Parent.SpanID() != root.SpanContext.SpanID() {
+			t.Errorf("expected the %s span to be a child of the Reconcile span", name)
+		}
+	}
+}
+
+func TestReconcileImageDigestPinning(t *testing.T) {
+	const image = "quay.io/combo/bundle:v0.0.1"
+
+	for _, tt := range []struct {
+		name        string
+		active      *platformv1alpha1.ActiveBundle
+		bundle      sourcer.Bundle
+		wantApplied string
+		wantDrifted metav1.ConditionStatus
+	}{
+		{
+			name:        "first install pins the resolved digest",
+			bundle:      sourcer.Bundle{Version: "0.0.1", Image: image},
+			wantApplied: "quay.io/combo/bundle@" + repushedDigest,
+			wantDrifted: metav1.ConditionFalse,
+		},
+		{
+			name:        "re-pushed tag under an unchanged version keeps the pinned digest",
+			active:      &platformv1alpha1.ActiveBundle{Version: "0.0.1", Image: image, Digest: testDigest},
+			bundle:      sourcer.Bundle{Version: "0.0.1", Image: image},
+			wantApplied: "quay.io/combo/bundle@" + testDigest,
+			wantDrifted: metav1.ConditionTrue,
+		},
+		{
+			name:        "new version pins the newly resolved digest",
+			active:      &platformv1alpha1.ActiveBundle{Version: "0.0.0", Image: "quay.io/combo/bundle:v0.0.0", Digest: testDigest},
+			bundle:      sourcer.Bundle{Version: "0.0.1", Image: image},
+			wantApplied: "quay.io/combo/bundle@" + repushedDigest,
+			wantDrifted: metav1.ConditionFalse,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			po := &platformv1alpha1.PlatformOperator{
+				ObjectMeta: metav1.ObjectMeta{Name: "combo"},
+				Spec:       platformv1alpha1.PlatformOperatorSpec{PackageName: "combo"},
+				Status:     platformv1alpha1.PlatformOperatorStatus{ActiveBundle: tt.active},
+			}
+			c := &statusRecorder{Client: newFakeClient(t, po)}
+			a := &fakeApplier{}
+			r := &PlatformOperatorReconciler{
+				Client:   c,
+				Sourcer:  fakeSourcer{bundle: &tt.bundle},
+				Resolver: resolver.Fake{image: repushedDigest},
+				Applier:  a,
+			}
+			if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(po)}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if a.applied == nil || a.applied.Image != tt.wantApplied {
+				t.Fatalf("expected %s to be applied, got %v", tt.wantApplied, a.applied)
+			}
+			if c.status == nil || c.status.ActiveBundle == nil {
+				t.Fatal("expected the active bundle to be recorded in status")
+			}
+			if got := c.status.ActiveBundle; got.Image != image || "quay.io/combo/bundle@"+got.Digest != tt.wantApplied {
+				t.Errorf("unexpected active bundle %+v", got)
+			}
+			cond := meta.FindStatusCondition(c.status.Conditions, platformv1alpha1.TypeImageDrifted)
+			if cond == nil || cond.Status != tt.wantDrifted {
+				t.Errorf("expected the %s condition to be %s, got %v", platformv1alpha1.TypeImageDrifted, tt.wantDrifted, cond)
+			}
+		})
+	}
+}
+
+func TestReconcileImagePinningFailure(t *testing.T) {
+	const image = "quay.io/combo/bundle:v0.0.1"
+
+	po := &platformv1alpha1.PlatformOperator{
+		ObjectMeta: metav1.ObjectMeta{Name: "combo"},
+		Spec:       platformv1alpha1.PlatformOperatorSpec{PackageName: "combo"},
+	}
+	c := &statusRecorder{Client: newFakeClient(t, po)}
+	a := &fakeApplier{}
+	r := &PlatformOperatorReconciler{
+		Client:  c,
+		Sourcer: fakeSourcer{bundle: &sourcer.Bundle{Version: "0.0.1", Image: image}},
+		// The registry answered with a malformed digest.
+		Resolver: resolver.Fake{image: "sha256:invalid"},
+		Applier:  a,
+	}
+	res, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(po)})
+	if err != nil || res.RequeueAfter != 0 {
+		t.Fatalf("expected the failure not to be retried, got %+v and %v", res, err)
+	}
+	if a.applied != nil {
+		t.Errorf("expected nothing to be applied, got %v", a.applied)
+	}
+	cond := meta.FindStatusCondition(c.status.Conditions, platformv1alpha1.TypeSourced)
+	if cond == nil || cond.Status != metav1.ConditionFalse || cond.Reason != platformv1alpha1.ReasonImageResolutionFailed {
+		t.Fatalf("expected the %s condition to be False with the %s reason, got %v", platformv1alpha1.TypeSourced, platformv1alpha1.ReasonImageResolutionFailed, cond)
+	}
+	if !strings.Contains(cond.Message, "sha256:invalid") {
+		t.Errorf("expected the message to name the malformed digest, got %q", cond.Message)
+	}
+}
+
+type fakeVerifier struct {
+	err error
+}
+
+func (f fakeVerifier) Verify(context.Context, *platformv1alpha1.PlatformOperator, *sourcer.Bundle) error {
+	return f.err
+}
+
+func TestReconcileSignatureVerification(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		err         error
+		wantApplied bool
+		wantStatus  metav1.ConditionStatus
+		wantReason  string
+	}{
+		{
+			name:        "verified bundles are applied",
+			wantApplied: true,
+			wantStatus:  metav1.ConditionTrue,
+			wantReason:  platformv1alpha1.ReasonSignatureVerified,
+		},
+		{
+			name:       "unsigned bundles are blocked",
+			err:        verifier.ErrUnsigned,
+			wantStatus: metav1.ConditionFalse,
+			wantReason: platformv1alpha1.ReasonUnsigned,
+		},
+		{
+			name:       "untrusted bundles are blocked",
+			err:        verifier.ErrUntrusted,
+			wantStatus: metav1.ConditionFalse,
+			wantReason: platformv1alpha1.ReasonUntrusted,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			po := &platformv1alpha1.PlatformOperator{
+				ObjectMeta: metav1.ObjectMeta{Name: "combo"},
+				Spec:       platformv1alpha1.PlatformOperatorSpec{PackageName: "combo"},
+			}
+			c := &statusRecorder{Client: newFakeClient(t, po)}
+			a := &fakeApplier{}
+			r := &PlatformOperatorReconciler{
+				Client:   c,
+				Sourcer:  fakeSourcer{bundle: &sourcer.Bundle{Version: "0.0.1", Image: "quay.io/combo/bundle:v0.0.1"}},
+				Resolver: resolver.Fake{"quay.io/combo/bundle:v0.0.1": testDigest},
+				Verifier: fakeVerifier{err: tt.err},
+				Applier:  a,
+			}
+			if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(po)}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if applied := a.applied != nil; applied != tt.wantApplied {
+				t.Errorf("expected applied to be %t, got %t", tt.wantApplied, applied)
+			}
+			cond := meta.FindStatusCondition(c.status.Conditions, platformv1alpha1.TypeVerified)
+			if cond == nil || cond.Status != tt.wantStatus || cond.Reason != tt.wantReason {
+				t.Errorf("expected the %s condition to be %s with reason %s, got %v", platformv1alpha1.TypeVerified, tt.wantStatus, tt.wantReason, cond)
+			}
+		})
+	}
+}
+
+func TestReconcileImageMirrors(t *testing.T) {
+	po := &platformv1alpha1.PlatformOperator{
+		ObjectMeta: metav1.ObjectMeta{Name: "combo"},
+		Spec:       platformv1alpha1.PlatformOperatorSpec{PackageName: "combo"},
+	}
+	c := &statusRecorder{Client: newFakeClient(t, po)}
+	r := &PlatformOperatorReconciler{
+		Client:   c,
+		Sourcer:  fakeSourcer{bundle: &sourcer.Bundle{Version: "0.0.1", Image: "quay.io/combo/bundle:v0.0.1"}},
+		Resolver: resolver.Fake{"quay.io/combo/bundle:v0.0.1": testDigest},
+		Applier:  &fakeApplier{mirrors: []mirror.Mirror{{Source: "quay.io/combo", Mirrors: []string{"mirror.example.com/combo"}}}},
+	}
+	if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(po)}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := platformv1alpha1.ActiveBundle{
+		Version:       "0.0.1",
+		Image:         "quay.io/combo/bundle:v0.0.1",
+		Digest:        testDigest,
+		MirroredImage: "mirror.example.com/combo/bundle@" + testDigest,
+	}
+	if got := c.status.ActiveBundle; got == nil || !reflect.DeepEqual(*got, want) {
+		t.Errorf("expected the active bundle to be %+v, got %+v", want, got)
+	}
+}
+
+func TestReconcileImageMirrorsResolveTagsAtSource(t *testing.T) {
+	srv := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	defer srv.Close()
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	push := func(image string) string {
+		img, err := random.Image(64, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ref, err := name.ParseReference(image)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := remote.Write(ref, img); err != nil {
+			t.Fatal(err)
+		}
+		digest, err := img.Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return digest.String()
+	}
+	// The mirror lags behind its source, and still has an older image under the
+	// same tag.
+	image := u.Host + "/combo/bundle:v0.0.1"
+	digest := push(image)
+	push(u.Host + "/mirror/combo/bundle:v0.0.1")
+
+	mirrors := []mirror.Mirror{{Source: u.Host + "/combo", Mirrors: []string{u.Host + "/mirror/combo"}}}
+	po := &platformv1alpha1.PlatformOperator{
+		ObjectMeta: metav1.ObjectMeta{Name: "combo"},
+		Spec:       platformv1alpha1.PlatformOperatorSpec{PackageName: "combo"},
+	}
+	c := &statusRecorder{Client: newFakeClient(t, po)}
+	r := &PlatformOperatorReconciler{
+		Client:   c,
+		Sourcer:  fakeSourcer{bundle: &sourcer.Bundle{Version: "0.0.1", Image: image}},
+		Resolver: resolver.NewRegistryResolver(),
+		Applier:  &fakeApplier{mirrors: mirrors},
+	}
+	if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(po)}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := platformv1alpha1.ActiveBundle{
+		Version:       "0.0.1",
+		Image:         image,
+		Digest:        digest,
+		MirroredImage: u.Host + "/mirror/combo/bundle@" + digest,
+	}
+	if got := c.status.ActiveBundle; got == nil || !reflect.DeepEqual(*got, want) {
+		t.Errorf("expected the active bundle to be %+v, got %+v", want, got)
+	}
+	if cond := meta.FindStatusCondition(c.status.Conditions, platformv1alpha1.TypeImageDrifted); cond != nil && cond.Status == metav1.ConditionTrue {
+		t.Errorf("unexpected %s condition: %+v", platformv1alpha1.TypeImageDrifted, cond)
+	}
+}
+
+func TestReconcileBundleMetadata(t *testing.T) {
+	po := &platformv1alpha1.PlatformOperator{
+		ObjectMeta: metav1.ObjectMeta{Name: "combo"},
+		Spec:       platformv1alpha1.PlatformOperatorSpec{PackageName: "combo"},
+	}
+	c := &statusRecorder{Client: newFakeClient(t, po)}
+	r := &PlatformOperatorReconciler{
+		Client: c,
+		Sourcer: fakeSourcer{bundle: &sourcer.Bundle{
+			Name:          "combo.v0.0.1",
+			Version:       "0.0.1",
+			Image:         "quay.io/combo/bundle:v0.0.1",
+			ProvidedAPIs:  []schema.GroupVersionKind{{Group: "combo.example.com", Version: "v1", Kind: "Combo"}},
+			RelatedImages: []sourcer.RelatedImage{{Name: "operator", Image: "quay.io/combo/operator@" + testDigest}},
+			CSV:           sourcer.CSVMetadata{DisplayName: "Combo", Provider: "Example"},
+		}},
+		Resolver: resolver.Fake{"quay.io/combo/bundle:v0.0.1": testDigest},
+		Applier:  &fakeApplier{},
+	}
+	if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(po)}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := platformv1alpha1.ActiveBundle{
+		Name:          "combo.v0.0.1",
+		Version:       "0.0.1",
+		Image:         "quay.io/combo/bundle:v0.0.1",
+		Digest:        testDigest,
+		DisplayName:   "Combo",
+		Provider:      "Example",
+		ProvidedAPIs:  []metav1.GroupVersionKind{{Group: "combo.example.com", Version: "v1", Kind: "Combo"}},
+		RelatedImages: []platformv1alpha1.RelatedImage{{Name: "operator", Image: "quay.io/combo/operator@" + testDigest}},
+	}
+	if got := c.status.ActiveBundle; got == nil || !reflect.DeepEqual(*got, want) {
+		t.Errorf("expected the active bundle to be %+v, got %+v", want, got)
+	}
+}
+
+func TestReconcileUpgradeable(t *testing.T) {
+	ocp := semver.MustParse("4.12.3")
+	versions := clusterversion.Static{OpenShift: &ocp, Kube: semver.MustParse("1.25.4")}
+
+	for _, tt := range []struct {
+		name       string
+		max        string
+		wantStatus metav1.ConditionStatus
+	}{
+		{name: "no max OpenShift version", wantStatus: metav1.ConditionTrue},
+		{name: "compatible with the next minor version", max: `"4.13"`, wantStatus: metav1.ConditionTrue},
+		{name: "blocks the next minor version", max: `"4.12"`, wantStatus: metav1.ConditionFalse},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &sourcer.Bundle{Version: "0.0.1", Image: "quay.io/combo/bundle:v0.0.1"}
+			if tt.max != "" {
+				b.Properties = []property.Property{{Type: sourcer.TypeMaxOpenShiftVersion, Value: json.RawMessage(tt.max)}}
+			}
+			po := &platformv1alpha1.PlatformOperator{
+				ObjectMeta: metav1.ObjectMeta{Name: "combo"},
+				Spec:       platformv1alpha1.PlatformOperatorSpec{PackageName: "combo"},
+			}
+			c := &statusRecorder{Client: newFakeClient(t, po)}
+			r := &PlatformOperatorReconciler{
+				Client:         c,
+				Sourcer:        fakeSourcer{bundle: b},
+				Resolver:       resolver.Fake{"quay.io/combo/bundle:v0.0.1": testDigest},
+				Applier:        &fakeApplier{},
+				ClusterVersion: versions,
+			}
+			if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(po)}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			cond := meta.FindStatusCondition(c.status.Conditions, platformv1alpha1.TypeUpgradeable)
+			if cond == nil || cond.Status != tt.wantStatus {
+				t.Errorf("expected the %s condition to be %s, got %v", platformv1alpha1.TypeUpgradeable, tt.wantStatus, cond)
+			}
+		})
+	}
+}
+
+func TestReconcileDeprecated(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		bundle      *sourcer.Bundle
+		wantStatus  metav1.ConditionStatus
+		wantMessage string
+	}{
+		{
+			name:       "not deprecated",
+			bundle:     &sourcer.Bundle{Version: "0.0.1", Image: "quay.io/combo/bundle:v0.0.1"},
+			wantStatus: metav1.ConditionFalse,
+		},
+		{
+			name: "deprecated",
+			bundle: &sourcer.Bundle{Version: "0.0.1", Image: "quay.io/combo/bundle:v0.0.1", Deprecations: []sourcer.Deprecation{
+				{Schema: "olm.package", Message: "combo is no longer maintained"},
+			}},
+			wantStatus:  metav1.ConditionTrue,
+			wantMessage: "combo is no longer maintained",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			po := &platformv1alpha1.PlatformOperator{
+				ObjectMeta: metav1.ObjectMeta{Name: "combo"},
+				Spec:       platformv1alpha1.PlatformOperatorSpec{PackageName: "combo"},
+			}
+			c := &statusRecorder{Client: newFakeClient(t, po)}
+			r := &PlatformOperatorReconciler{
+				Client:   c,
+				Sourcer:  fakeSourcer{bundle: tt.bundle},
+				Resolver: resolver.Fake{"quay.io/combo/bundle:v0.0.1": testDigest},
+				Applier:  &fakeApplier{},
+			}
+			if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(po)}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			cond := meta.FindStatusCondition(c.status.Conditions, platformv1alpha1.TypeDeprecated)
+			if cond == nil || cond.Status != tt.wantStatus {
+				t.Fatalf("expected the %s condition to be %s, got %v", platformv1alpha1.TypeDeprecated, tt.wantStatus, cond)
+			}
+			if tt.wantMessage != "" && cond.Message != tt.wantMessage {
+				t.Errorf("expected the catalog's message %q, got %q", tt.wantMessage, cond.Message)
+			}
+		})
+	}
+}
+
+func TestReconcileDryRun(t *testing.T) {
+	installed := &platformv1alpha1.ActiveBundle{Version: "0.0.1", Image: "quay.io/combo/bundle:v0.0.1", Digest: testDigest}
+	po := &platformv1alpha1.PlatformOperator{
+		ObjectMeta: metav1.ObjectMeta{Name: "combo"},
+		Spec:       platformv1alpha1.PlatformOperatorSpec{PackageName: "combo", DryRun: true},
+		Status:     platformv1alpha1.PlatformOperatorStatus{ActiveBundle: installed},
+	}
+	c := &statusRecorder{Client: newFakeClient(t, po)}
+	a := &fakeApplier{}
+	r := &PlatformOperatorReconciler{
+		Client:   c,
+		Sourcer:  fakeSourcer{bundle: &sourcer.Bundle{Version: "0.0.2", Image: "quay.io/combo/bundle:v0.0.2"}},
+		Resolver: resolver.Fake{"quay.io/combo/bundle:v0.0.2": repushedDigest},
+		Applier:  a,
+	}
+	if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(po)}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if a.applied != nil {
+		t.Errorf("expected nothing to be applied during a dry run, got %v", a.applied)
+	}
+	if a.diffed == nil || a.diffed.Image != "quay.io/combo/bundle@"+repushedDigest {
+		t.Errorf("expected the pinned bundle to be diffed, got %v", a.diffed)
+	}
+	if d := c.status.Diff; d == nil || d.FromVersion != "0.0.1" || d.ToVersion != "0.0.2" {
+		t.Errorf("expected a diff from 0.0.1 to 0.0.2 in status, got %+v", d)
+	}
+	if got := c.status.ActiveBundle; !reflect.DeepEqual(got, installed) {
+		t.Errorf("expected the active bundle to be unchanged, got %+v", got)
+	}
+}
+
+func TestReconcileUpgradeBlocked(t *testing.T) {
+	installed := &platformv1alpha1.ActiveBundle{Version: "0.0.1", Image: "quay.io/combo/bundle:v0.0.1", Digest: testDigest}
+	po := &platformv1alpha1.PlatformOperator{
+		ObjectMeta: metav1.ObjectMeta{Name: "combo"},
+		Spec:       platformv1alpha1.PlatformOperatorSpec{PackageName: "combo"},
+		Status:     platformv1alpha1.PlatformOperatorStatus{ActiveBundle: installed},
+	}
+	c := &statusRecorder{Client: newFakeClient(t, po)}
+	r := &PlatformOperatorReconciler{
+		Client:   c,
+		Sourcer:  fakeSourcer{bundle: &sourcer.Bundle{Version: "0.0.2", Image: "quay.io/combo/bundle:v0.0.2"}},
+		Resolver: resolver.Fake{"quay.io/combo/bundle:v0.0.2": repushedDigest},
+		Applier:  &fakeApplier{err: fmt.Errorf("%w: combos.example.com stops serving the v1 version", applier.ErrUpgradeBlocked)},
+	}
+	res, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(po)})
+	if err != nil {
+		t.Fatalf("expected the blocked upgrade to be checked again on the next resync, got %v", err)
+	}
+	if res.Requeue || res.RequeueAfter != 0 {
+		t.Errorf("expected no requeue, got %+v", res)
+	}
+
+	cond := meta.FindStatusCondition(c.status.Conditions, platformv1alpha1.TypeUpgradeBlocked)
+	if cond == nil || cond.Status != metav1.ConditionTrue || cond.Reason != platformv1alpha1.ReasonIncompatibleCRDChange {
+		t.Fatalf("expected the upgrade to be blocked, got %+v", cond)
+	}
+	if !strings.Contains(cond.Message, "stops serving the v1 version") {
+		t.Errorf("expected the condition to explain why the upgrade is blocked, got %q", cond.Message)
+	}
+	if got := c.status.ActiveBundle; !reflect.DeepEqual(got, installed) {
+		t.Errorf("expected the active bundle to be unchanged, got %+v", got)
+	}
+}
+
+func TestReconcileUpgradeUnverified(t *testing.T) {
+	po := &platformv1alpha1.PlatformOperator{
+		ObjectMeta: metav1.ObjectMeta{Name: "combo"},
+		Spec:       platformv1alpha1.PlatformOperatorSpec{PackageName: "combo"},
+		Status: platformv1alpha1.PlatformOperatorStatus{
+			ActiveBundle: &platformv1alpha1.ActiveBundle{Version: "0.0.1", Image: "quay.io/combo/bundle:v0.0.1", Digest: testDigest},
+		},
+	}
+	c := &statusRecorder{Client: newFakeClient(t, po)}
+	r := &PlatformOperatorReconciler{
+		Client:   c,
+		Sourcer:  fakeSourcer{bundle: &sourcer.Bundle{Version: "0.0.2", Image: "quay.io/combo/bundle:v0.0.2"}},
+		Resolver: resolver.Fake{"quay.io/combo/bundle:v0.0.2": repushedDigest},
+		Applier:  &fakeApplier{err: fmt.Errorf("%w: not allowed to list the existing example.com/v1 Combo resources", applier.ErrUpgradeUnverified)},
+	}
+	if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(po)}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cond := meta.FindStatusCondition(c.status.Conditions, platformv1alpha1.TypeUpgradeBlocked)
+	if cond == nil || cond.Status != metav1.ConditionUnknown || cond.Reason != platformv1alpha1.ReasonResourcesUnchecked {
+		t.Fatalf("expected whether the upgrade breaks existing custom resources to be unknown, got %+v", cond)
+	}
+	if !strings.Contains(cond.Message, "example.com/v1 Combo") {
+		t.Errorf("expected the condition to name the unchecked resources, got %q", cond.Message)
+	}
+	if !meta.IsStatusConditionTrue(c.status.Conditions, platformv1alpha1.TypeApplied) {
+		t.Errorf("expected the upgrade to be applied, got %+v", meta.FindStatusCondition(c.status.Conditions, platformv1alpha1.TypeApplied))
+	}
+	if got := c.status.ActiveBundle; got == nil || got.Version != "0.0.2" {
+		t.Errorf("expected the active bundle to be upgraded, got %+v", got)
+	}
+}
+
+func TestReconcileApplyConflict(t *testing.T) {
+	po := &platformv1alpha1.PlatformOperator{
+		ObjectMeta: metav1.ObjectMeta{Name: "combo"},
+		Spec:       platformv1alpha1.PlatformOperatorSpec{PackageName: "combo"},
+	}
+	c := &statusRecorder{Client: newFakeClient(t, po)}
+	r := &PlatformOperatorReconciler{
+		Client:   c,
+		Sourcer:  fakeSourcer{bundle: &sourcer.Bundle{Version: "0.0.1", Image: "quay.io/combo/bundle:v0.0.1"}},
+		Resolver: resolver.Fake{"quay.io/combo/bundle:v0.0.1": testDigest},
+		Applier:  &fakeApplier{err: fmt.Errorf(`%w: conflict with "kubectl-edit": .spec.template.spec.source.image`, applier.ErrFieldConflict)},
+	}
+	res, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(po)})
+	if err != nil {
+		t.Fatalf("expected the conflict to be reported rather than retried, got %v", err)
+	}
+	if res.Requeue || res.RequeueAfter != 0 {
+		t.Errorf("expected no requeue, got %+v", res)
+	}
+
+	cond := meta.FindStatusCondition(c.status.Conditions, platformv1alpha1.TypeApplyConflict)
+	if cond == nil || cond.Status != metav1.ConditionTrue || cond.Reason != platformv1alpha1.ReasonFieldManagerConflict {
+		t.Fatalf("expected the conflict to be reported, got %+v", cond)
+	}
+	if !strings.Contains(cond.Message, `"kubectl-edit"`) {
+		t.Errorf("expected the condition to name the conflicting field manager, got %q", cond.Message)
+	}
+	if c.status.ActiveBundle != nil {
+		t.Errorf("expected no bundle to be recorded as active, got %+v", c.status.ActiveBundle)
+	}
+}
+
+type fakeEvaluator struct {
+	report *health.Report
+	err    error
+}
+
+func (f fakeEvaluator) Evaluate(context.Context, *platformv1alpha1.PlatformOperator, *sourcer.Bundle) (*health.Report, error) {
+	return f.report, f.err
+}
+
+func TestReconcileAvailable(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		evaluator fakeEvaluator
+		status    metav1.ConditionStatus
+		reason    string
+		message   string
+	}{
+		{
+			name:      "available",
+			evaluator: fakeEvaluator{report: &health.Report{Evaluated: 2}},
+			status:    metav1.ConditionTrue,
+			reason:    platformv1alpha1.ReasonAsExpected,
+			message:   "All 2 workloads of the installed olm.bundle content are available",
+		},
+		{
+			name:      "unavailable",
+			evaluator: fakeEvaluator{report: &health.Report{Evaluated: 2, Unhealthy: []string{"Deployment combo-system/combo-operator: 0 of 1 replicas are available"}}},
+			status:    metav1.ConditionFalse,
+			reason:    platformv1alpha1.ReasonUnavailable,
+			message:   "1 of 2 workloads are unavailable: Deployment combo-system/combo-operator: 0 of 1 replicas are available",
+		},
+		{
+			name:      "skipped health probes",
+			evaluator: fakeEvaluator{report: &health.Report{Evaluated: 2, Skipped: []string{"Combo combo-system/cluster: not allowed to get it"}}},
+			status:    metav1.ConditionTrue,
+			reason:    platformv1alpha1.ReasonAsExpected,
+			message:   "All 2 workloads of the installed olm.bundle content are available; 1 health probes were skipped: Combo combo-system/cluster: not allowed to get it",
+		},
+		{
+			name:      "no workloads",
+			evaluator: fakeEvaluator{report: &health.Report{}},
+			status:    metav1.ConditionUnknown,
+			reason:    platformv1alpha1.ReasonNoWorkloads,
+		},
+		{
+			name:      "failed evaluation",
+			evaluator: fakeEvaluator{err: errors.New("connection refused")},
+			status:    metav1.ConditionUnknown,
+			reason:    platformv1alpha1.ReasonHealthCheckFailed,
+			message:   "connection refused",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			po := &platformv1alpha1.PlatformOperator{
+				ObjectMeta: metav1.ObjectMeta{Name: "combo"},
+				Spec:       platformv1alpha1.PlatformOperatorSpec{PackageName: "combo"},
+			}
+			c := &statusRecorder{Client: newFakeClient(t, po)}
+			r := &PlatformOperatorReconciler{
+				Client:   c,
+				Sourcer:  fakeSourcer{bundle: &sourcer.Bundle{Version: "0.0.1", Image: "quay.io/combo/bundle:v0.0.1"}},
+				Resolver: resolver.Fake{"quay.io/combo/bundle:v0.0.1": testDigest},
+				Applier:  &fakeApplier{},
+				Health:   tt.evaluator,
+			}
+			if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(po)}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			cond := meta.FindStatusCondition(c.status.Conditions, platformv1alpha1.TypeAvailable)
+			if cond == nil || cond.Status != tt.status || cond.Reason != tt.reason {
+				t.Fatalf("expected the Available condition to be %s with reason %s, got %+v", tt.status, tt.reason, cond)
+			}
+			if tt.message != "" && cond.Message != tt.message {
+				t.Errorf("expected the message %q, got %q", tt.message, cond.Message)
+			}
+		})
+	}
+}
+
+func TestReconcileDrift(t *testing.T) {
+	drifted := []applier.Drift{
+		{Object: platformv1alpha1.AppliedObject{APIVersion: "apps/v1", Kind: "Deployment", Namespace: "combo-system", Name: "combo-operator"}, Fields: []string{"spec.replicas"}},
+		{Object: platformv1alpha1.AppliedObject{APIVersion: "v1", Kind: "ConfigMap", Namespace: "combo-system", Name: "combo-config"}},
+	}
+	for _, tt := range []struct {
+		name      string
+		policy    platformv1alpha1.DriftPolicy
+		drifted   []applier.Drift
+		upgrading bool
+		applied   bool
+		status    metav1.ConditionStatus
+		reason    string
+		message   string
+	}{
+		{
+			name:    "no drift",
+			applied: true,
+			status:  metav1.ConditionFalse,
+			reason:  platformv1alpha1.ReasonNoDrift,
+		},
+		{
+			name:    "reports drift",
+			drifted: drifted,
+			status:  metav1.ConditionTrue,
+			reason:  platformv1alpha1.ReasonDriftDetected,
+			message: "2 objects have drifted from the olm.bundle content: Deployment combo-system/combo-operator (spec.replicas); ConfigMap combo-system/combo-config (deleted)",
+		},
+		{
+			name:    "remediates drift",
+			policy:  platformv1alpha1.DriftPolicyRemediate,
+			drifted: drifted,
+			applied: true,
+			status:  metav1.ConditionFalse,
+			reason:  platformv1alpha1.ReasonDriftRemediated,
+			message: "Restored 2 objects that had drifted from the olm.bundle content: Deployment combo-system/combo-operator (spec.replicas); ConfigMap combo-system/combo-config (deleted)",
+		},
+		{
+			name:      "upgrades regardless of drift",
+			drifted:   drifted,
+			upgrading: true,
+			applied:   true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			po := &platformv1alpha1.PlatformOperator{
+				ObjectMeta: metav1.ObjectMeta{Name: "combo"},
+				Spec:       platformv1alpha1.PlatformOperatorSpec{PackageName: "combo", DriftPolicy: tt.policy},
+				Status: platformv1alpha1.PlatformOperatorStatus{
+					ActiveBundle: &platformv1alpha1.ActiveBundle{Version: "0.0.1", Image: "quay.io/combo/bundle:v0.0.1", Digest: testDigest},
+					Conditions: []metav1.Condition{{
+						Type:   platformv1alpha1.TypeApplied,
+						Status: metav1.ConditionTrue,
+						Reason: platformv1alpha1.ReasonApplySuccessful,
+					}},
+				},
+			}
+			desired := &sourcer.Bundle{Version: "0.0.1", Image: "quay.io/combo/bundle:v0.0.1"}
+			if tt.upgrading {
+				desired = &sourcer.Bundle{Version: "0.0.2", Image: "quay.io/combo/bundle:v0.0.2"}
+			}
+			c := &statusRecorder{Client: newFakeClient(t, po)}
+			a := &fakeApplier{drifted: tt.drifted}
+			r := &PlatformOperatorReconciler{
+				Client:   c,
+				Sourcer:  fakeSourcer{bundle: desired},
+				Resolver: resolver.Fake{desired.Image: testDigest},
+				Applier:  a,
+			}
+			if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(po)}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if applied := a.applied != nil; applied != tt.applied {
+				t.Errorf("expected the bundle to be applied: %t, got %t", tt.applied, applied)
+			}
+			cond := meta.FindStatusCondition(c.status.Conditions, platformv1alpha1.TypeDrifted)
+			if tt.status == "" {
+				if cond != nil {
+					t.Errorf("expected drift not to be checked while upgrading, got %+v", cond)
+				}
+				return
+			}
+			if cond == nil || cond.Status != tt.status || cond.Reason != tt.reason {
+				t.Fatalf("expected the Drifted condition to be %s with reason %s, got %+v", tt.status, tt.reason, cond)
+			}
+			if tt.message != "" && cond.Message != tt.message {
+				t.Errorf("expected the message %q, got %q", tt.message, cond.Message)
+			}
+		})
+	}
+}
+
+type fakeRunner struct {
+	// pending and err are the outcomes of running the hooks of each phase.
+	pending map[platformv1alpha1.HookPhase]string
+	err     map[platformv1alpha1.HookPhase]error
+	ran     []platformv1alpha1.HookPhase
+	hooks   []platformv1alpha1.Hook
+}
+
+func (f *fakeRunner) Run(_ context.Context, _ *platformv1alpha1.PlatformOperator, _ string, phase platformv1alpha1.HookPhase, declared []platformv1alpha1.Hook) (string, error) {
+	f.ran = append(f.ran, phase)
+	f.hooks = declared
+	return f.pending[phase], f.err[phase]
+}
+
+func TestReconcileHooks(t *testing.T) {
+	job := func(image string) runtime.RawExtension {
+		return runtime.RawExtension{Raw: []byte(`{"apiVersion":"batch/v1","kind":"Job","metadata":{"namespace":"combo-system"},"spec":{"template":{"spec":{"containers":[{"image":"` + image + `"}]}}}}`)}
+	}
+	bundled := []platformv1alpha1.Hook{
+		{Name: "migrate", Phase: platformv1alpha1.HookPhasePreApply, Job: job("quay.io/combo/migrate:v1")},
+		{Name: "smoke-test", Phase: platformv1alpha1.HookPhasePostInstall, Job: job("quay.io/combo/smoke-test:v1")},
+	}
+	override := platformv1alpha1.Hook{Name: "migrate", Phase: platformv1alpha1.HookPhasePreApply, Job: job("quay.io/combo/migrate:v2")}
+
+	for _, tt := range []struct {
+		name    string
+		runner  *fakeRunner
+		applied bool
+		ran     []platformv1alpha1.HookPhase
+		status  metav1.ConditionStatus
+		reason  string
+	}{
+		{
+			name:    "runs the hooks around the upgrade",
+			runner:  &fakeRunner{},
+			applied: true,
+			ran:     []platformv1alpha1.HookPhase{platformv1alpha1.HookPhasePreApply, platformv1alpha1.HookPhasePostInstall},
+			status:  metav1.ConditionTrue,
+			reason:  platformv1alpha1.ReasonAsExpected,
+		},
+		{
+			name:   "holds the upgrade while pre-apply hooks run",
+			runner: &fakeRunner{pending: map[platformv1alpha1.HookPhase]string{platformv1alpha1.HookPhasePreApply: "migrate"}},
+			ran:    []platformv1alpha1.HookPhase{platformv1alpha1.HookPhasePreApply},
+			status: metav1.ConditionFalse,
+			reason: platformv1alpha1.ReasonHookPending,
+		},
+		{
+			name:   "holds the upgrade when pre-apply hooks fail",
+			runner: &fakeRunner{err: map[platformv1alpha1.HookPhase]error{platformv1alpha1.HookPhasePreApply: fmt.Errorf("%w: migration failed", hooks.ErrHookFailed)}},
+			ran:    []platformv1alpha1.HookPhase{platformv1alpha1.HookPhasePreApply},
+			status: metav1.ConditionFalse,
+			reason: platformv1alpha1.ReasonHookFailed,
+		},
+		{
+			name:    "reports failed post-install hooks",
+			runner:  &fakeRunner{err: map[platformv1alpha1.HookPhase]error{platformv1alpha1.HookPhasePostInstall: fmt.Errorf("%w: smoke test failed", hooks.ErrHookFailed)}},
+			applied: true,
+			ran:     []platformv1alpha1.HookPhase{platformv1alpha1.HookPhasePreApply, platformv1alpha1.HookPhasePostInstall},
+			status:  metav1.ConditionFalse,
+			reason:  platformv1alpha1.ReasonHookFailed,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			po := &platformv1alpha1.PlatformOperator{
+				ObjectMeta: metav1.ObjectMeta{Name: "combo"},
+				Spec:       platformv1alpha1.PlatformOperatorSpec{PackageName: "combo", Hooks: []platformv1alpha1.Hook{override}},
+			}
+			c := &statusRecorder{Client: newFakeClient(t, po)}
+			a := &fakeApplier{hooks: bundled}
+			r := &PlatformOperatorReconciler{
+				Client:   c,
+				Sourcer:  fakeSourcer{bundle: &sourcer.Bundle{Version: "0.0.1", Image: "quay.io/combo/bundle:v0.0.1"}},
+				Resolver: resolver.Fake{"quay.io/combo/bundle:v0.0.1": testDigest},
+				Applier:  a,
+				Hooks:    tt.runner,
+			}
+			if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(po)}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if applied := a.applied != nil; applied != tt.applied {
+				t.Errorf("expected the bundle to be applied: %t, got %t", tt.applied, applied)
+			}
+			if !reflect.DeepEqual(tt.runner.ran, tt.ran) {
+				t.Errorf("expected the %v hooks to run, got %v", tt.ran, tt.runner.ran)
+			}
+			if want := []platformv1alpha1.Hook{bundled[1], override}; !reflect.DeepEqual(tt.runner.hooks, want) {
+				t.Errorf("expected the bundle's migrate hook to be overridden, got %+v", tt.runner.hooks)
+			}
+			cond := meta.FindStatusCondition(c.status.Conditions, platformv1alpha1.TypeHooksSucceeded)
+			if cond == nil || cond.Status != tt.status || cond.Reason != tt.reason {
+				t.Fatalf("expected the HooksSucceeded condition to be %s with reason %s, got %+v", tt.status, tt.reason, cond)
+			}
+		})
+	}
+}
@@ -7,6 +7,21 @@ import (
 	"github.com/openshift/platform-operators/internal/sourcer"
 )
 
+// Applier applies the sourced olm.bundle content to the cluster. Implementations
+// may rewrite the bundle's Image to the reference that was actually applied, e.g.
+// the location the image is mirrored to.
 type Applier interface {
 	Apply(context.Context, *v1alpha1.PlatformOperator, *sourcer.Bundle) error
+	// Diff summarizes how applying the bundle would change the content that's
+	// installed for the PlatformOperator, without applying anything.
+	Diff(context.Context, *v1alpha1.PlatformOperator, *sourcer.Bundle) (*v1alpha1.BundleDiff, error)
+	// Drift compares the live state of the objects installed for the bundle
+	// with its content, returning the objects that have been modified or
+	// deleted since it was applied.
+	Drift(context.Context, *v1alpha1.PlatformOperator, *sourcer.Bundle) ([]Drift, error)
+	// Hooks returns the hooks the bundle declares in its annotations.
+	Hooks(context.Context, *v1alpha1.PlatformOperator, *sourcer.Bundle) ([]v1alpha1.Hook, error)
+	// Forget releases the bundles kept for a PlatformOperator that no longer
+	// exists.
+	Forget(name string)
 }
@@ -2,42 +2,467 @@ package applier
 
 import (
 	"context"
+	"errors"
+	"fmt"
 
 	rukpakv1alpha1 "github.com/operator-framework/rukpak/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"sigs.k8s.io/controller-runtime/pkg/client"
-	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	logr "sigs.k8s.io/controller-runtime/pkg/log"
 
 	"github.com/openshift/platform-operators/api/v1alpha1"
+	"github.com/openshift/platform-operators/internal/hooks"
 	"github.com/openshift/platform-operators/internal/sourcer"
+	"github.com/openshift/platform-operators/internal/util"
 )
 
 const (
 	plainProvisionerID    = "core.rukpak.io/plain"
 	registryProvisionerID = "core.rukpak.io/registry"
+
+	// BundleDeploymentFieldManager is the field manager that owns the fields of
+	// the BundleDeployments applied for PlatformOperators.
+	BundleDeploymentFieldManager = "platformoperator-bundledeployment"
+
+	// The labels rukpak sets on the objects it applies for a BundleDeployment.
+	ownerKindLabel = "core.rukpak.io/owner-kind"
+	ownerNameLabel = "core.rukpak.io/owner-name"
+	// helmReleaseNameAnnotation is the annotation helm identifies the release
+	// that installed an object by.
+	helmReleaseNameAnnotation = "meta.helm.sh/release-name"
 )
 
+// ErrFieldConflict is returned when applying a BundleDeployment would overwrite
+// the changes other field managers made to it.
+var ErrFieldConflict = errors.New("the BundleDeployment has conflicting changes from other field managers")
+
 type bdApplier struct {
 	client.Client
+	options
+	cache *bundleCache
 }
 
-func NewBundleDeploymentHandler(c client.Client) Applier {
+func NewBundleDeploymentHandler(c client.Client, opts ...Option) Applier {
+	o := newOptions(opts)
 	return &bdApplier{
-		Client: c,
+		Client:  c,
+		options: o,
+		cache:   newBundleCache(o.remote),
 	}
 }
 
 func (a *bdApplier) Apply(ctx context.Context, po *v1alpha1.PlatformOperator, b *sourcer.Bundle) error {
-	bi := &rukpakv1alpha1.BundleDeployment{}
-	bi.SetName(po.GetName())
-	controllerRef := metav1.NewControllerRef(po, po.GroupVersionKind())
+	if err := a.rewriteImage(ctx, b); err != nil {
+		return err
+	}
+	// Rukpak applies the CRDs without checking them against the existing custom
+	// resources, so the bundle is rendered here to check them beforehand.
+	objs, err := a.render(ctx, po, b)
+	if err != nil {
+		return err
+	}
+	unverified, err := checkCRDUpgrades(ctx, a.Client, objs)
+	if err != nil {
+		return err
+	}
+
+	name := util.BundleDeploymentName(po)
+	previous, err := a.previousBundleDeployments(ctx, po, name)
+	if err != nil {
+		return err
+	}
+
+	existing := &rukpakv1alpha1.BundleDeployment{}
+	if err := a.Get(ctx, client.ObjectKey{Name: name}, existing); err != nil {
+		if client.IgnoreNotFound(err) != nil {
+			return fmt.Errorf("failed to get the %s BundleDeployment: %w", name, err)
+		}
+		existing = nil
+	}
+	if existing != nil {
+		if err := a.takeOver(ctx, existing); err != nil {
+			return err
+		}
+	}
+
+	// Only the fields managed here are applied, so the labels, annotations and
+	// owner references added by others are kept.
+	bd := &rukpakv1alpha1.BundleDeployment{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: rukpakv1alpha1.GroupVersion.String(),
+			Kind:       rukpakv1alpha1.BundleDeploymentKind,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			Labels:          map[string]string{hooks.PlatformOperatorLabel: po.GetName()},
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(po, v1alpha1.GroupVersion.WithKind(v1alpha1.PlatformOperatorKind))},
+		},
+		Spec: *buildBundleDeployment(b.Image),
+	}
+	opts := []client.PatchOption{client.FieldOwner(BundleDeploymentFieldManager)}
+	if po.Spec.ForceConflicts {
+		opts = append(opts, client.ForceOwnership)
+	}
+	if err := a.Patch(ctx, bd, client.Apply, opts...); err != nil {
+		if apierrors.IsConflict(err) {
+			return fmt.Errorf("%w: %v", ErrFieldConflict, err)
+		}
+		return fmt.Errorf("failed to apply the %s BundleDeployment: %w", bd.GetName(), err)
+	}
+
+	retiring, err := a.cutOver(ctx, po, bd, previous, objs)
+	po.Status.BundleDeployments = append([]string{name}, retiring...)
+	if err != nil {
+		return err
+	}
+
+	unchanged := existing != nil && existing.GetGeneration() == bd.GetGeneration()
+	if !unchanged || len(retiring) != 0 || bd.Status.ActiveBundle == "" || po.Spec.DriftPolicy != v1alpha1.DriftPolicyRemediate {
+		return unverified
+	}
+	if objs, _, err = a.installed(ctx, po, objs); err != nil {
+		return err
+	}
+	if err := a.remediate(ctx, bd, objs); err != nil {
+		return err
+	}
+	return unverified
+}
+
+// previousBundleDeployments returns the names of the BundleDeployments besides
+// the current one that are, or were until recently, controlled by the platform
+// operator. These include the BundleDeployments that were named after it.
+func (a *bdApplier) previousBundleDeployments(ctx context.Context, po *v1alpha1.PlatformOperator, current string) ([]string, error) {
+	names := sets.NewString(po.Status.BundleDeployments...)
+	bds := &rukpakv1alpha1.BundleDeploymentList{}
+	if err := a.List(ctx, bds); err != nil {
+		return nil, fmt.Errorf("failed to list BundleDeployments: %w", err)
+	}
+	for i := range bds.Items {
+		if metav1.IsControlledBy(&bds.Items[i], po) {
+			names.Insert(bds.Items[i].GetName())
+		}
+	}
+	names.Delete(current)
+	return names.List(), nil
+}
+
+// cutOver retires the previous BundleDeployments of the platform operator in
+// favor of the current one, returning the ones that are still being retired.
+//
+// Rukpak installs each BundleDeployment as a helm release named after it, and
+// helm refuses to install objects that belong to another release. So the
+// previous BundleDeployments are deleted first while orphaning their objects,
+// which keeps the objects running but stops rukpak from reconciling them. Once
+// they're gone, their objects are handed over to the current BundleDeployment's
+// release, which rukpak then installs.
+func (a *bdApplier) cutOver(ctx context.Context, po *v1alpha1.PlatformOperator, bd *rukpakv1alpha1.BundleDeployment, previous []string, objs []unstructured.Unstructured) ([]string, error) {
+	log := logr.FromContext(ctx)
+
+	var retiring []string
+	for i, name := range previous {
+		old := &rukpakv1alpha1.BundleDeployment{}
+		err := a.Get(ctx, client.ObjectKey{Name: name}, old)
+		switch {
+		case client.IgnoreNotFound(err) != nil:
+			return append(retiring, previous[i:]...), fmt.Errorf("failed to get the %s BundleDeployment: %w", name, err)
+		case err == nil && !metav1.IsControlledBy(old, po):
+			// The name was reused by an unrelated BundleDeployment.
+			continue
+		case err == nil:
+			retiring = append(retiring, name)
+			if old.GetDeletionTimestamp() != nil {
+				continue
+			}
+			if err := a.Delete(ctx, old, client.PropagationPolicy(metav1.DeletePropagationOrphan)); client.IgnoreNotFound(err) != nil {
+				return append(retiring, previous[i+1:]...), fmt.Errorf("failed to retire the %s BundleDeployment: %w", name, err)
+			}
+			log.Info("retiring BundleDeployment", "bundleDeployment", name, "current", bd.GetName())
+			continue
+		}
+		if err := a.handOver(ctx, name, bd.GetName(), objs); err != nil {
+			return append(retiring, previous[i:]...), err
+		}
+		log.Info("handed over the objects of a retired BundleDeployment", "bundleDeployment", name, "current", bd.GetName())
+	}
+	return retiring, nil
+}
+
+// handOver relabels the objects installed by a retired BundleDeployment, so the
+// helm release of the current one adopts them, and deletes the Bundles that were
+// unpacked for it. The objects are looked up among the kinds of the bundle's
+// objects and the RBAC rukpak generates for registry+v1 bundles, as the others
+// are no longer part of the bundle.
+func (a *bdApplier) handOver(ctx context.Context, from, to string, objs []unstructured.Unstructured) error {
+	selector := client.MatchingLabels{
+		ownerKindLabel: rukpakv1alpha1.BundleDeploymentKind,
+		ownerNameLabel: from,
+	}
+	for _, gvk := range handOverKinds(objs) {
+		list := &unstructured.UnstructuredList{}
+		list.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+		if err := a.List(ctx, list, selector); err != nil {
+			if meta.IsNoMatchError(err) {
+				continue
+			}
+			return fmt.Errorf("failed to list the %s objects installed by the %s BundleDeployment: %w", gvk.Kind, from, err)
+		}
+		for i := range list.Items {
+			obj := &list.Items[i]
+			patch := client.MergeFrom(obj.DeepCopy())
+			labels := obj.GetLabels()
+			labels[ownerNameLabel] = to
+			obj.SetLabels(labels)
+			annotations := obj.GetAnnotations()
+			if annotations == nil {
+				annotations = make(map[string]string)
+			}
+			annotations[helmReleaseNameAnnotation] = to
+			obj.SetAnnotations(annotations)
+			if err := a.Patch(ctx, obj, patch); err != nil {
+				return fmt.Errorf("failed to hand over %s %s: %w", obj.GetKind(), client.ObjectKeyFromObject(obj), err)
+			}
+		}
+	}
+	bundles := &rukpakv1alpha1.BundleList{}
+	if err := a.List(ctx, bundles, selector); err != nil {
+		return fmt.Errorf("failed to list the Bundles of the %s BundleDeployment: %w", from, err)
+	}
+	for i := range bundles.Items {
+		if err := a.Delete(ctx, &bundles.Items[i]); client.IgnoreNotFound(err) != nil {
+			return fmt.Errorf("failed to delete the %s Bundle: %w", bundles.Items[i].GetName(), err)
+		}
+	}
+	return nil
+}
+
+func handOverKinds(objs []unstructured.Unstructured) []schema.GroupVersionKind {
+	kinds := []schema.GroupVersionKind{
+		corev1.SchemeGroupVersion.WithKind("ServiceAccount"),
+		rbacv1.SchemeGroupVersion.WithKind("Role"),
+		rbacv1.SchemeGroupVersion.WithKind("RoleBinding"),
+		rbacv1.SchemeGroupVersion.WithKind("ClusterRole"),
+		rbacv1.SchemeGroupVersion.WithKind("ClusterRoleBinding"),
+	}
+	seen := make(map[schema.GroupKind]bool, len(kinds))
+	for _, gvk := range kinds {
+		seen[gvk.GroupKind()] = true
+	}
+	for _, obj := range objs {
+		if gvk := obj.GroupVersionKind(); !seen[gvk.GroupKind()] {
+			seen[gvk.GroupKind()] = true
+			kinds = append(kinds, gvk)
+		}
+	}
+	return kinds
+}
 
-	_, err := controllerutil.CreateOrUpdate(ctx, a.Client, bi, func() error {
-		bi.SetOwnerReferences([]metav1.OwnerReference{*controllerRef})
-		bi.Spec = *buildBundleDeployment(b.Image)
+// takeOver drops the ownership held by update operations over the fields of a
+// BundleDeployment that was created before it was managed with server-side
+// apply, as applying changes to those fields would conflict with the previous
+// owner otherwise. The fields keep their values, and status updates keep their
+// ownership.
+func (a *bdApplier) takeOver(ctx context.Context, bd *rukpakv1alpha1.BundleDeployment) error {
+	var kept []metav1.ManagedFieldsEntry
+	for _, entry := range bd.GetManagedFields() {
+		if entry.Manager == BundleDeploymentFieldManager && entry.Operation == metav1.ManagedFieldsOperationApply {
+			return nil
+		}
+		if entry.Operation != metav1.ManagedFieldsOperationUpdate || entry.Subresource != "" {
+			kept = append(kept, entry)
+		}
+	}
+	if len(kept) == len(bd.GetManagedFields()) {
 		return nil
-	})
-	return err
+	}
+	if len(kept) == 0 {
+		// An empty entry is how every entry is reset.
+		kept = []metav1.ManagedFieldsEntry{{}}
+	}
+	bd.SetManagedFields(kept)
+	if err := a.Update(ctx, bd); err != nil {
+		return fmt.Errorf("failed to take over the %s BundleDeployment: %w", bd.GetName(), err)
+	}
+	return nil
+}
+
+// remediate restores the objects that have drifted from the bundle's content, as
+// rukpak only applies them when the BundleDeployment changes. It's only called
+// once rukpak has rolled out the unchanged BundleDeployment, so rukpak's own
+// changes aren't mistaken for drift.
+func (a *bdApplier) remediate(ctx context.Context, bd *rukpakv1alpha1.BundleDeployment, objs []unstructured.Unstructured) error {
+	drifted, err := detectDrift(ctx, a.Client, objs)
+	if err != nil {
+		return err
+	}
+	log := logr.FromContext(ctx)
+	for _, d := range drifted {
+		for i := range objs {
+			obj := objs[i].DeepCopy()
+			if identity(appliedObject(obj)) != identity(d.Object) {
+				continue
+			}
+			// Keep the labels rukpak identifies the objects it applied by.
+			labels := obj.GetLabels()
+			if labels == nil {
+				labels = make(map[string]string)
+			}
+			labels[ownerKindLabel] = rukpakv1alpha1.BundleDeploymentKind
+			labels[ownerNameLabel] = bd.GetName()
+			obj.SetLabels(labels)
+			if err := a.Patch(ctx, obj, client.Apply, client.FieldOwner(FieldManager), client.ForceOwnership); err != nil {
+				return fmt.Errorf("failed to restore the drifted %s %s: %w", obj.GetKind(), client.ObjectKeyFromObject(obj), err)
+			}
+			log.Info("restored drifted object", "drift", d.String())
+		}
+	}
+	return nil
+}
+
+// Diff unpacks and renders the bundles itself, as rukpak doesn't offer a way to
+// preview the content a BundleDeployment would apply. Rukpak doesn't apply the
+// objects with server-side apply, so the fields the bundle no longer sets
+// aren't reported as changed.
+func (a *bdApplier) Diff(ctx context.Context, po *v1alpha1.PlatformOperator, b *sourcer.Bundle) (*v1alpha1.BundleDiff, error) {
+	if err := a.rewriteImage(ctx, b); err != nil {
+		return nil, err
+	}
+	var added []unstructured.Unstructured
+	d, err := diff(ctx, a.Client, func(rendered *sourcer.Bundle) ([]unstructured.Unstructured, error) {
+		objs, err := a.render(ctx, po, rendered)
+		if err != nil {
+			return nil, err
+		}
+		located, unlocated, err := a.installed(ctx, po, objs)
+		if rendered == b {
+			// The objects of the bundle that can't be located are yet to be
+			// installed in the namespace of rukpak's helm releases.
+			added = unlocated
+		}
+		return located, err
+	}, po, b)
+	if err != nil {
+		return nil, err
+	}
+	for i := range added {
+		d.Added = append(d.Added, appliedObject(&added[i]))
+	}
+	return d, nil
+}
+
+func (a *bdApplier) Drift(ctx context.Context, po *v1alpha1.PlatformOperator, b *sourcer.Bundle) ([]Drift, error) {
+	if err := a.rewriteImage(ctx, b); err != nil {
+		return nil, err
+	}
+	objs, err := a.render(ctx, po, b)
+	if err != nil {
+		return nil, err
+	}
+	// Drift can't be detected for the objects that can't be located.
+	if objs, _, err = a.installed(ctx, po, objs); err != nil {
+		return nil, err
+	}
+	return detectDrift(ctx, a.Client, objs)
+}
+
+func (a *bdApplier) Hooks(ctx context.Context, po *v1alpha1.PlatformOperator, b *sourcer.Bundle) ([]v1alpha1.Hook, error) {
+	if err := a.rewriteImage(ctx, b); err != nil {
+		return nil, err
+	}
+	return bundleHooks(ctx, a.cache, po, b)
+}
+
+func (a *bdApplier) Forget(name string) {
+	a.cache.forget(name)
+}
+
+// render returns the objects rukpak applies for the bundle, as rukpak converts
+// registry+v1 bundles differently from the direct applier.
+func (a *bdApplier) render(ctx context.Context, po *v1alpha1.PlatformOperator, b *sourcer.Bundle) ([]unstructured.Unstructured, error) {
+	content, err := a.cache.get(ctx, po.Name, b.Image)
+	if err != nil {
+		return nil, err
+	}
+	if content.annotations[mediaTypeAnnotation] != mediaTypeRegistryV1 {
+		return render(content, packageName(po, b), namespaced(a.RESTMapper()))
+	}
+	pkg := content.annotations[packageAnnotation]
+	if pkg == "" {
+		pkg = packageName(po, b)
+	}
+	return renderRukpakRegistryV1(content.manifests, pkg)
+}
+
+// installed returns the objects rukpak installed for the bundle, to compare
+// them with their live state. Rukpak installs the namespaced objects that don't
+// declare a namespace in the namespace of its helm releases, so they're looked
+// up among the objects labelled as installed for the platform operator. The
+// ones that can't be found, e.g. because they don't exist yet or the manager
+// isn't allowed to list their kind, are returned apart, as where they belong
+// isn't known.
+func (a *bdApplier) installed(ctx context.Context, po *v1alpha1.PlatformOperator, objs []unstructured.Unstructured) (located, unlocated []unstructured.Unstructured, err error) {
+	var (
+		isNamespaced = namespaced(a.RESTMapper())
+		owners       = sets.NewString(po.Status.BundleDeployments...).Insert(util.BundleDeploymentName(po))
+		namespaces   = make(map[schema.GroupVersionKind]map[string]string)
+	)
+	located = make([]unstructured.Unstructured, 0, len(objs))
+	for _, obj := range objs {
+		gvk := obj.GroupVersionKind()
+		if obj.GetNamespace() != "" {
+			located = append(located, obj)
+			continue
+		}
+		ok, err := isNamespaced(gvk)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !ok {
+			located = append(located, obj)
+			continue
+		}
+		if _, listed := namespaces[gvk]; !listed {
+			if namespaces[gvk], err = a.installedNamespaces(ctx, gvk, owners); err != nil {
+				return nil, nil, err
+			}
+		}
+		ns, found := namespaces[gvk][obj.GetName()]
+		if !found {
+			unlocated = append(unlocated, obj)
+			continue
+		}
+		obj := *obj.DeepCopy()
+		obj.SetNamespace(ns)
+		located = append(located, obj)
+	}
+	return located, unlocated, nil
+}
+
+// installedNamespaces maps the names of the objects of the kind installed by the
+// owner BundleDeployments to their namespaces.
+func (a *bdApplier) installedNamespaces(ctx context.Context, gvk schema.GroupVersionKind, owners sets.String) (map[string]string, error) {
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+	if err := a.List(ctx, list, client.MatchingLabels{ownerKindLabel: rukpakv1alpha1.BundleDeploymentKind}); err != nil {
+		if apierrors.IsForbidden(err) || meta.IsNoMatchError(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to list the %s objects installed by rukpak: %w", gvk.Kind, err)
+	}
+	namespaces := make(map[string]string, len(list.Items))
+	for _, obj := range list.Items {
+		if owners.Has(obj.GetLabels()[ownerNameLabel]) {
+			namespaces[obj.GetName()] = obj.GetNamespace()
+		}
+	}
+	return namespaces, nil
 }
 
 // buildBundleDeployment is responsible for taking a name and image to create an embedded BundleDeployment
@@ -0,0 +1,322 @@
+package applier
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	rukpakv1alpha1 "github.com/operator-framework/rukpak/api/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	platformv1alpha1 "github.com/openshift/platform-operators/api/v1alpha1"
+	"github.com/openshift/platform-operators/internal/hooks"
+	"github.com/openshift/platform-operators/internal/sourcer"
+	"github.com/openshift/platform-operators/internal/util"
+)
+
+// bdRecorder records the BundleDeployments that are applied, as the fake client
+// doesn't support server-side apply, and passes other patches through. Applying
+// without forcing conflicts fails while conflicting is set.
+type bdRecorder struct {
+	client.Client
+	conflicting bool
+	applied     *rukpakv1alpha1.BundleDeployment
+	opts        *client.PatchOptions
+}
+
+func (r *bdRecorder) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	if patch != client.Apply {
+		return r.Client.Patch(ctx, obj, patch, opts...)
+	}
+	r.opts = &client.PatchOptions{}
+	r.opts.ApplyOptions(opts)
+	if r.conflicting && (r.opts.Force == nil || !*r.opts.Force) {
+		return apierrors.NewConflict(schema.GroupResource{Group: rukpakv1alpha1.GroupVersion.Group, Resource: "bundledeployments"}, obj.GetName(),
+			errors.New(`Apply failed with 1 conflict: conflict with "kubectl-edit" using core.rukpak.io/v1alpha1: .spec.template.spec.source.image`))
+	}
+	r.applied = obj.(*rukpakv1alpha1.BundleDeployment).DeepCopy()
+	return nil
+}
+
+func newBDRecorder(t *testing.T, objs ...client.Object) *bdRecorder {
+	t.Helper()
+
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := rukpakv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	return &bdRecorder{Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()}
+}
+
+func pushPlainBundle(t *testing.T) string {
+	t.Helper()
+
+	return pushBundleImage(t, newTestRegistry(t)+"/combo/plain", map[string]string{
+		"manifests/configmap.yaml": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: combo
+  namespace: combo
+`,
+	})
+}
+
+func TestBundleDeploymentApplier(t *testing.T) {
+	image := pushPlainBundle(t)
+	po := &platformv1alpha1.PlatformOperator{ObjectMeta: metav1.ObjectMeta{Name: "combo", UID: "po-uid"}}
+
+	c := newBDRecorder(t)
+	if err := NewBundleDeploymentHandler(c).Apply(context.Background(), po, &sourcer.Bundle{Image: image}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if c.applied == nil {
+		t.Fatal("expected the BundleDeployment to be applied")
+	}
+	if c.opts.FieldManager != BundleDeploymentFieldManager || c.opts.Force != nil {
+		t.Errorf("expected the BundleDeployment to be applied by the %s field manager without forcing conflicts, got %+v", BundleDeploymentFieldManager, c.opts)
+	}
+	if c.applied.Kind != rukpakv1alpha1.BundleDeploymentKind || c.applied.Spec.Template.Spec.Source.Image.Ref != image {
+		t.Errorf("expected a BundleDeployment for the %s image, got %+v", image, c.applied)
+	}
+	if ref := metav1.GetControllerOf(c.applied); ref == nil || ref.UID != po.UID {
+		t.Errorf("expected the BundleDeployment to be controlled by the platform operator, got %v", c.applied.OwnerReferences)
+	}
+	if c.applied.Name != util.BundleDeploymentName(po) {
+		t.Errorf("expected the BundleDeployment to be named %s, got %s", util.BundleDeploymentName(po), c.applied.Name)
+	}
+	if want := map[string]string{hooks.PlatformOperatorLabel: po.Name}; !reflect.DeepEqual(c.applied.Labels, want) || len(c.applied.Annotations) != 0 {
+		t.Errorf("expected only the %v labels to be applied, so the ones added by others are kept, got %v and %v", want, c.applied.Labels, c.applied.Annotations)
+	}
+	if want := []string{c.applied.Name}; !reflect.DeepEqual(po.Status.BundleDeployments, want) {
+		t.Errorf("expected the BundleDeployments in status to be %v, got %v", want, po.Status.BundleDeployments)
+	}
+}
+
+func TestBundleDeploymentApplierConflicts(t *testing.T) {
+	image := pushPlainBundle(t)
+	po := &platformv1alpha1.PlatformOperator{ObjectMeta: metav1.ObjectMeta{Name: "combo", UID: "po-uid"}}
+
+	c := newBDRecorder(t)
+	c.conflicting = true
+	a := NewBundleDeploymentHandler(c)
+	err := a.Apply(context.Background(), po, &sourcer.Bundle{Image: image})
+	if !errors.Is(err, ErrFieldConflict) {
+		t.Fatalf("expected a field conflict, got %v", err)
+	}
+	if want := `conflict with "kubectl-edit"`; !strings.Contains(err.Error(), want) {
+		t.Errorf("expected the error to name the conflicting field manager, got %q", err.Error())
+	}
+
+	po.Spec.ForceConflicts = true
+	if err := a.Apply(context.Background(), po, &sourcer.Bundle{Image: image}); err != nil {
+		t.Fatalf("expected the conflicts to be forced, got %v", err)
+	}
+	if c.opts.Force == nil || !*c.opts.Force {
+		t.Errorf("expected the BundleDeployment to be applied with forced ownership, got %+v", c.opts)
+	}
+}
+
+func TestBundleDeploymentApplierTakeOver(t *testing.T) {
+	image := pushPlainBundle(t)
+	po := &platformv1alpha1.PlatformOperator{ObjectMeta: metav1.ObjectMeta{Name: "combo", UID: "po-uid"}}
+	status := metav1.ManagedFieldsEntry{Manager: "rukpak", Operation: metav1.ManagedFieldsOperationUpdate, Subresource: "status"}
+	existing := &rukpakv1alpha1.BundleDeployment{ObjectMeta: metav1.ObjectMeta{
+		Name: util.BundleDeploymentName(po),
+		ManagedFields: []metav1.ManagedFieldsEntry{
+			{Manager: "manager", Operation: metav1.ManagedFieldsOperationUpdate},
+			status,
+		},
+	}}
+
+	c := newBDRecorder(t, existing)
+	if err := NewBundleDeploymentHandler(c).Apply(context.Background(), po, &sourcer.Bundle{Image: image}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	bd := &rukpakv1alpha1.BundleDeployment{}
+	if err := c.Get(context.Background(), client.ObjectKeyFromObject(existing), bd); err != nil {
+		t.Fatal(err)
+	}
+	if got := bd.GetManagedFields(); len(got) != 1 || got[0].Manager != status.Manager {
+		t.Errorf("expected only the status updates to keep their ownership, got %+v", got)
+	}
+}
+
+func TestBundleDeploymentApplierCutOver(t *testing.T) {
+	ctx := context.Background()
+	image := pushPlainBundle(t)
+	po := &platformv1alpha1.PlatformOperator{ObjectMeta: metav1.ObjectMeta{Name: "combo", UID: "po-uid"}}
+	installedBy := map[string]string{ownerKindLabel: rukpakv1alpha1.BundleDeploymentKind, ownerNameLabel: "combo"}
+	// The BundleDeployment used to be named after the platform operator.
+	legacy := &rukpakv1alpha1.BundleDeployment{ObjectMeta: metav1.ObjectMeta{
+		Name:            "combo",
+		OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(po, platformv1alpha1.GroupVersion.WithKind(platformv1alpha1.PlatformOperatorKind))},
+	}}
+	bundle := &rukpakv1alpha1.Bundle{ObjectMeta: metav1.ObjectMeta{Name: "combo-7f8d9c", Labels: installedBy}}
+	cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+		Namespace:   "combo",
+		Name:        "combo",
+		Labels:      installedBy,
+		Annotations: map[string]string{helmReleaseNameAnnotation: "combo"},
+	}}
+	// Objects installed by other BundleDeployments are left alone.
+	unrelated := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+		Namespace:   "combo",
+		Name:        "unrelated",
+		Labels:      map[string]string{ownerKindLabel: rukpakv1alpha1.BundleDeploymentKind, ownerNameLabel: "unrelated"},
+		Annotations: map[string]string{helmReleaseNameAnnotation: "unrelated"},
+	}}
+
+	c := newBDRecorder(t, legacy, bundle, cm, unrelated)
+	a := NewBundleDeploymentHandler(c)
+	current := util.BundleDeploymentName(po)
+
+	// The legacy BundleDeployment is retired once the current one is applied.
+	if err := a.Apply(ctx, po, &sourcer.Bundle{Image: image}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if c.applied == nil || c.applied.Name != current {
+		t.Fatalf("expected the %s BundleDeployment to be applied, got %v", current, c.applied)
+	}
+	if want := []string{current, "combo"}; !reflect.DeepEqual(po.Status.BundleDeployments, want) {
+		t.Errorf("expected the BundleDeployments in status to be %v, got %v", want, po.Status.BundleDeployments)
+	}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(legacy), &rukpakv1alpha1.BundleDeployment{}); !apierrors.IsNotFound(err) {
+		t.Errorf("expected the legacy BundleDeployment to be deleted, got %v", err)
+	}
+
+	// Its objects are handed over once it's gone.
+	if err := a.Apply(ctx, po, &sourcer.Bundle{Image: image}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{current}; !reflect.DeepEqual(po.Status.BundleDeployments, want) {
+		t.Errorf("expected the BundleDeployments in status to be %v, got %v", want, po.Status.BundleDeployments)
+	}
+	got := &corev1.ConfigMap{}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(cm), got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Labels[ownerNameLabel] != current || got.Annotations[helmReleaseNameAnnotation] != current {
+		t.Errorf("expected the ConfigMap to be handed over to the %s BundleDeployment, got %v and %v", current, got.Labels, got.Annotations)
+	}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(unrelated), got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Labels[ownerNameLabel] != "unrelated" || got.Annotations[helmReleaseNameAnnotation] != "unrelated" {
+		t.Errorf("expected the unrelated ConfigMap to be left alone, got %v and %v", got.Labels, got.Annotations)
+	}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(bundle), &rukpakv1alpha1.Bundle{}); !apierrors.IsNotFound(err) {
+		t.Errorf("expected the Bundle of the legacy BundleDeployment to be deleted, got %v", err)
+	}
+}
+
+func TestBundleDeploymentApplierIgnoresUnrelated(t *testing.T) {
+	image := pushPlainBundle(t)
+	po := &platformv1alpha1.PlatformOperator{ObjectMeta: metav1.ObjectMeta{Name: "combo", UID: "po-uid"}}
+	// A BundleDeployment that happens to share the platform operator's name.
+	unrelated := &rukpakv1alpha1.BundleDeployment{ObjectMeta: metav1.ObjectMeta{Name: "combo"}}
+
+	c := newBDRecorder(t, unrelated)
+	if err := NewBundleDeploymentHandler(c).Apply(context.Background(), po, &sourcer.Bundle{Image: image}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := c.Get(context.Background(), client.ObjectKeyFromObject(unrelated), &rukpakv1alpha1.BundleDeployment{}); err != nil {
+		t.Errorf("expected the unrelated BundleDeployment to be kept, got %v", err)
+	}
+	if want := []string{util.BundleDeploymentName(po)}; !reflect.DeepEqual(po.Status.BundleDeployments, want) {
+		t.Errorf("expected the BundleDeployments in status to be %v, got %v", want, po.Status.BundleDeployments)
+	}
+}
+
+func TestBundleDeploymentApplierDriftRegistryV1(t *testing.T) {
+	csv := strings.Replace(testCSV("0.0.1"), "  name: combo.v0.0.1\nspec:\n",
+		"  name: combo.v0.0.1\n  annotations:\n    capabilities: Basic Install\nspec:\n  installModes:\n  - type: AllNamespaces\n    supported: true\n", 1)
+	image := pushBundleImage(t, newTestRegistry(t)+"/combo/bundle", map[string]string{
+		"metadata/annotations.yaml":                  testAnnotations,
+		"manifests/combo.clusterserviceversion.yaml": csv,
+		"manifests/service.yaml":                     testService,
+	})
+	po := &platformv1alpha1.PlatformOperator{ObjectMeta: metav1.ObjectMeta{Name: "combo"}}
+	installedByRukpak := func(obj client.Object) client.Object {
+		obj.SetLabels(map[string]string{ownerKindLabel: rukpakv1alpha1.BundleDeploymentKind, ownerNameLabel: util.BundleDeploymentName(po)})
+		return obj
+	}
+
+	// The objects as rukpak's registry provisioner installs them: the target
+	// namespaces are annotated on the deployment along with the CSV's
+	// annotations, and the service that doesn't declare a namespace is
+	// installed in the namespace of rukpak's helm releases.
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "combo-operator",
+			Namespace:   "combo-system",
+			Annotations: map[string]string{"capabilities": "Basic Install", targetNamespacesAnnotation: ""},
+		},
+		Spec: appsv1.DeploymentSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "combo-operator"}},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "combo-operator"}},
+				Spec: corev1.PodSpec{
+					ServiceAccountName: "combo-operator",
+					Containers:         []corev1.Container{{Name: "manager", Image: "quay.io/combo/operator:v0.0.1"}},
+				},
+			},
+		},
+	}
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "combo-metrics", Namespace: "rukpak-system"},
+		Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Port: 8443}}},
+	}
+	c := newBDRecorder(t,
+		installedByRukpak(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "combo-system"}}),
+		installedByRukpak(&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "combo-operator", Namespace: "combo-system"}}),
+		installedByRukpak(deployment),
+		installedByRukpak(service),
+		// An unrelated service of the same name isn't mistaken for the bundle's.
+		&corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "combo-metrics", Namespace: "default"}},
+	)
+	a := NewBundleDeploymentHandler(c)
+	b := &sourcer.Bundle{Image: image, Package: "combo"}
+
+	drifted, err := a.Drift(context.Background(), po, b)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(drifted) != 0 {
+		t.Errorf("expected the objects installed by rukpak not to have drifted, got %v", drifted)
+	}
+
+	service.Spec.Ports[0].Port = 9443
+	if err := c.Update(context.Background(), service); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Delete(context.Background(), deployment); err != nil {
+		t.Fatal(err)
+	}
+	if drifted, err = a.Drift(context.Background(), po, b); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var got []string
+	for _, d := range drifted {
+		got = append(got, d.String())
+	}
+	want := []string{
+		"Deployment combo-system/combo-operator (deleted)",
+		"Service rukpak-system/combo-metrics (spec.ports[0].port)",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected the drifted objects to be %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,87 @@
+package applier
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// maxCachedBundles is the number of bundles kept for each PlatformOperator,
+// which is enough for the active bundle and the one it's being upgraded to.
+const maxCachedBundles = 2
+
+// bundleCache holds the unpacked content of the bundles last used for each
+// PlatformOperator, so their images are only pulled again when they change.
+type bundleCache struct {
+	remote []remote.Option
+
+	mu     sync.Mutex
+	owners map[string]*ownedBundles
+}
+
+// ownedBundles are the bundles unpacked for a PlatformOperator, most recently
+// used first. Its lock is held while images are pulled, so a slow registry only
+// holds up the PlatformOperators whose bundles it serves.
+type ownedBundles struct {
+	mu       sync.Mutex
+	unpacked []unpackedBundle
+}
+
+type unpackedBundle struct {
+	image   string
+	content *bundleContent
+}
+
+func newBundleCache(opts []remote.Option) *bundleCache {
+	return &bundleCache{
+		remote: opts,
+		owners: make(map[string]*ownedBundles),
+	}
+}
+
+// get returns the content of the image on behalf of the owner. Only the images
+// most recently requested by each owner are kept in the cache.
+func (c *bundleCache) get(ctx context.Context, owner, image string) (*bundleContent, error) {
+	c.mu.Lock()
+	o, ok := c.owners[owner]
+	if !ok {
+		o = &ownedBundles{}
+		c.owners[owner] = o
+	}
+	c.mu.Unlock()
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var (
+		content *bundleContent
+		kept    = make([]unpackedBundle, 0, maxCachedBundles)
+	)
+	for _, u := range o.unpacked {
+		if u.image == image {
+			content = u.content
+			continue
+		}
+		kept = append(kept, u)
+	}
+	if content == nil {
+		var err error
+		if content, err = unpack(ctx, image, c.remote); err != nil {
+			return nil, fmt.Errorf("failed to unpack the %s bundle: %w", image, err)
+		}
+	}
+	o.unpacked = append([]unpackedBundle{{image: image, content: content}}, kept...)
+	if len(o.unpacked) > maxCachedBundles {
+		o.unpacked = o.unpacked[:maxCachedBundles]
+	}
+	return content, nil
+}
+
+// forget evicts the bundles of the owner.
+func (c *bundleCache) forget(owner string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.owners, owner)
+}
@@ -0,0 +1,66 @@
+package applier
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestBundleCache(t *testing.T) {
+	repo := newTestRegistry(t) + "/combo/plain"
+	var images []string
+	for _, data := range []string{"a", "b", "c"} {
+		images = append(images, pushBundleImage(t, repo, map[string]string{"manifests/configmap.yaml": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: combo
+  namespace: combo
+data:
+  key: ` + data + `
+`}))
+	}
+
+	ctx := context.Background()
+	c := newBundleCache(nil)
+	for _, image := range images {
+		if _, err := c.get(ctx, "combo", image); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if _, err := c.get(ctx, "combo", images[1]); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var cached []string
+	for _, u := range c.owners["combo"].unpacked {
+		cached = append(cached, u.image)
+	}
+	if len(cached) != maxCachedBundles || cached[0] != images[1] || cached[1] != images[2] {
+		t.Errorf("expected the most recently used images to be cached, got %v", cached)
+	}
+
+	// Unpacking the bundles of one owner doesn't hold up the others.
+	busy := c.owners["combo"]
+	busy.mu.Lock()
+	done := make(chan error)
+	go func() {
+		_, err := c.get(ctx, "other", images[0])
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("expected the bundle of another owner to be unpacked")
+	}
+	busy.mu.Unlock()
+
+	c.forget("combo")
+	if _, ok := c.owners["combo"]; ok {
+		t.Error("expected the bundles of a forgotten owner to be evicted")
+	}
+	if _, ok := c.owners["other"]; !ok {
+		t.Error("expected the bundles of other owners to be kept")
+	}
+}
@@ -0,0 +1,131 @@
+package applier
+
+import (
+	"fmt"
+	"sort"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// schemaProperty describes a property of a CRD version's schema.
+type schemaProperty struct {
+	Type     string
+	Required bool
+}
+
+// schemaProperties flattens the schema into its properties, keyed by their path,
+// e.g. "spec.replicas". Array items are denoted by "[*]".
+func schemaProperties(schema *apiextensionsv1.JSONSchemaProps) map[string]schemaProperty {
+	props := make(map[string]schemaProperty)
+	if schema != nil {
+		walkSchema("", schema, props)
+	}
+	return props
+}
+
+func walkSchema(path string, schema *apiextensionsv1.JSONSchemaProps, props map[string]schemaProperty) {
+	required := make(map[string]bool, len(schema.Required))
+	for _, name := range schema.Required {
+		required[name] = true
+	}
+	for name, prop := range schema.Properties {
+		prop := prop
+		child := name
+		if path != "" {
+			child = path + "." + name
+		}
+		props[child] = schemaProperty{Type: prop.Type, Required: required[name]}
+		walkSchema(child, &prop, props)
+	}
+	if schema.Items != nil && schema.Items.Schema != nil {
+		walkSchema(path+"[*]", schema.Items.Schema, props)
+	}
+}
+
+func toCRD(u *unstructured.Unstructured) (*apiextensionsv1.CustomResourceDefinition, error) {
+	crd := &apiextensionsv1.CustomResourceDefinition{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, crd); err != nil {
+		return nil, fmt.Errorf("failed to parse the %s CustomResourceDefinition: %w", u.GetName(), err)
+	}
+	return crd, nil
+}
+
+func versionSchema(v apiextensionsv1.CustomResourceDefinitionVersion) *apiextensionsv1.JSONSchemaProps {
+	if v.Schema == nil {
+		return nil
+	}
+	return v.Schema.OpenAPIV3Schema
+}
+
+// crdChanges describes how the CRD's versions and their schemas change between
+// the installed and desired definitions.
+func crdChanges(installed, desired *apiextensionsv1.CustomResourceDefinition) []string {
+	var changes []string
+	desiredVersions := make(map[string]apiextensionsv1.CustomResourceDefinitionVersion, len(desired.Spec.Versions))
+	for _, v := range desired.Spec.Versions {
+		desiredVersions[v.Name] = v
+	}
+	installedVersions := make(map[string]apiextensionsv1.CustomResourceDefinitionVersion, len(installed.Spec.Versions))
+	for _, old := range installed.Spec.Versions {
+		installedVersions[old.Name] = old
+		v, ok := desiredVersions[old.Name]
+		if !ok {
+			changes = append(changes, fmt.Sprintf("removed version %s", old.Name))
+			continue
+		}
+		if old.Served != v.Served {
+			changes = append(changes, fmt.Sprintf("%s: served changed from %t to %t", v.Name, old.Served, v.Served))
+		}
+		if old.Storage != v.Storage {
+			changes = append(changes, fmt.Sprintf("%s: storage changed from %t to %t", v.Name, old.Storage, v.Storage))
+		}
+		changes = append(changes, schemaChanges(v.Name, versionSchema(old), versionSchema(v))...)
+	}
+	for _, v := range desired.Spec.Versions {
+		if _, ok := installedVersions[v.Name]; !ok {
+			changes = append(changes, fmt.Sprintf("added version %s", v.Name))
+		}
+	}
+	return changes
+}
+
+func schemaChanges(version string, installed, desired *apiextensionsv1.JSONSchemaProps) []string {
+	var (
+		changes  []string
+		oldProps = schemaProperties(installed)
+		newProps = schemaProperties(desired)
+	)
+	for _, path := range sortedPaths(oldProps) {
+		if _, ok := newProps[path]; !ok {
+			changes = append(changes, fmt.Sprintf("%s: removed property %s", version, path))
+		}
+	}
+	for _, path := range sortedPaths(newProps) {
+		prop := newProps[path]
+		old, ok := oldProps[path]
+		switch {
+		case !ok && prop.Required:
+			changes = append(changes, fmt.Sprintf("%s: added required property %s", version, path))
+		case !ok:
+			changes = append(changes, fmt.Sprintf("%s: added property %s", version, path))
+		case old.Type != prop.Type:
+			changes = append(changes, fmt.Sprintf("%s: property %s changed type from %q to %q", version, path, old.Type, prop.Type))
+		case !old.Required && prop.Required:
+			changes = append(changes, fmt.Sprintf("%s: property %s is now required", version, path))
+		case old.Required && !prop.Required:
+			changes = append(changes, fmt.Sprintf("%s: property %s is no longer required", version, path))
+		}
+	}
+	return changes
+}
+
+func sortedPaths(props map[string]schemaProperty) []string {
+	paths := make([]string, 0, len(props))
+	for path := range props {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
@@ -0,0 +1,136 @@
+package applier
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/openshift/platform-operators/api/v1alpha1"
+	"github.com/openshift/platform-operators/internal/resolver"
+	"github.com/openshift/platform-operators/internal/sourcer"
+)
+
+// renderFunc returns the objects applied for the bundle.
+type renderFunc func(*sourcer.Bundle) ([]unstructured.Unstructured, error)
+
+// diff summarizes how applying the bundle would change the objects installed on
+// the cluster for the PlatformOperator. Every object of the bundle is applied
+// with a server-side dry run and compared with its live state, so objects that
+// already exist, or were edited by hand, are reported as they are on the
+// cluster. The objects of the active bundle, and the ones recorded in status,
+// that are still on the cluster and no longer part of the bundle are reported
+// as removed.
+func diff(ctx context.Context, c client.Client, render renderFunc, po *v1alpha1.PlatformOperator, b *sourcer.Bundle) (*v1alpha1.BundleDiff, error) {
+	desired, err := render(b)
+	if err != nil {
+		return nil, err
+	}
+	previous := append([]v1alpha1.AppliedObject(nil), po.Status.AppliedObjects...)
+	if active := po.Status.ActiveBundle; active != nil {
+		image := active.MirroredImage
+		if image == "" {
+			if image, err = resolver.Pin(active.Image, active.Digest); err != nil {
+				return nil, err
+			}
+		}
+		installed := *b
+		installed.Image = image
+		objs, err := render(&installed)
+		if err != nil {
+			return nil, err
+		}
+		for i := range objs {
+			previous = append(previous, appliedObject(&objs[i]))
+		}
+	}
+
+	d, err := compareLive(ctx, c, previous, desired)
+	if err != nil {
+		return nil, err
+	}
+	d.ToVersion = b.Version
+	if po.Status.ActiveBundle != nil {
+		d.FromVersion = po.Status.ActiveBundle.Version
+	}
+	return d, nil
+}
+
+// compareLive lists the desired objects that would be added to or changed on
+// the cluster, along with the changes to the CRDs, and the previous objects
+// that would be removed from it.
+func compareLive(ctx context.Context, c client.Client, previous []v1alpha1.AppliedObject, desired []unstructured.Unstructured) (*v1alpha1.BundleDiff, error) {
+	d := &v1alpha1.BundleDiff{}
+	wanted := make(map[string]bool, len(desired))
+	for i := range desired {
+		obj := desired[i].DeepCopy()
+		ref := appliedObject(obj)
+		wanted[identity(ref)] = true
+
+		live := &unstructured.Unstructured{}
+		live.SetGroupVersionKind(obj.GroupVersionKind())
+		if err := c.Get(ctx, client.ObjectKeyFromObject(obj), live); err != nil {
+			if client.IgnoreNotFound(err) != nil {
+				return nil, fmt.Errorf("failed to get %s %s: %w", obj.GetKind(), client.ObjectKeyFromObject(obj), err)
+			}
+			d.Added = append(d.Added, ref)
+			continue
+		}
+		if err := c.Patch(ctx, obj, client.Apply, client.DryRunAll, client.FieldOwner(FieldManager), client.ForceOwnership); err != nil {
+			return nil, fmt.Errorf("failed to dry run the apply of %s %s: %w", obj.GetKind(), client.ObjectKeyFromObject(obj), err)
+		}
+		if equality.Semantic.DeepEqual(stripServerFields(live), stripServerFields(obj)) {
+			continue
+		}
+		d.Changed = append(d.Changed, ref)
+		if !isCRD(obj.GroupVersionKind()) {
+			continue
+		}
+		oldCRD, err := toCRD(live)
+		if err != nil {
+			return nil, err
+		}
+		newCRD, err := toCRD(obj)
+		if err != nil {
+			return nil, err
+		}
+		if changes := crdChanges(oldCRD, newCRD); len(changes) != 0 {
+			d.CRDChanges = append(d.CRDChanges, v1alpha1.CRDChange{Name: obj.GetName(), Changes: changes})
+		}
+	}
+
+	for _, ref := range union(previous) {
+		if wanted[identity(ref)] {
+			continue
+		}
+		live := &unstructured.Unstructured{}
+		live.SetAPIVersion(ref.APIVersion)
+		live.SetKind(ref.Kind)
+		if err := c.Get(ctx, client.ObjectKey{Namespace: ref.Namespace, Name: ref.Name}, live); err != nil {
+			if client.IgnoreNotFound(err) != nil {
+				return nil, fmt.Errorf("failed to get %s %s: %w", ref.Kind, client.ObjectKey{Namespace: ref.Namespace, Name: ref.Name}, err)
+			}
+			continue
+		}
+		d.Removed = append(d.Removed, ref)
+	}
+	return d, nil
+}
+
+// stripServerFields returns the content of the object without the metadata the
+// API server updates on every write and without its status, which applying the
+// bundle doesn't change.
+func stripServerFields(obj *unstructured.Unstructured) map[string]interface{} {
+	u := obj.DeepCopy()
+	for _, field := range [][]string{
+		{"metadata", "managedFields"},
+		{"metadata", "resourceVersion"},
+		{"metadata", "generation"},
+		{"status"},
+	} {
+		unstructured.RemoveNestedField(u.Object, field...)
+	}
+	return u.Object
+}
@@ -0,0 +1,256 @@
+package applier
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	platformv1alpha1 "github.com/openshift/platform-operators/api/v1alpha1"
+	"github.com/openshift/platform-operators/internal/sourcer"
+)
+
+const testCRDv2 = `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: combos.example.com
+spec:
+  group: example.com
+  names:
+    kind: Combo
+    plural: combos
+  scope: Namespaced
+  versions:
+  - name: v1
+    served: true
+    storage: false
+    schema:
+      openAPIV3Schema:
+        type: object
+        properties:
+          spec:
+            type: object
+            required: [size]
+            properties:
+              size:
+                type: integer
+  - name: v2
+    served: true
+    storage: true
+`
+
+func TestDirectApplierDiff(t *testing.T) {
+	host := newTestRegistry(t)
+	installed := pushBundleImage(t, host+"/combo/bundle", map[string]string{
+		"metadata/annotations.yaml":                  testAnnotations,
+		"manifests/combo.clusterserviceversion.yaml": testCSV("0.0.1"),
+		"manifests/crd.yaml":                         testCRD,
+		"manifests/service.yaml":                     testService,
+	})
+	desired := pushBundleImage(t, host+"/combo/bundle", map[string]string{
+		"metadata/annotations.yaml":                  testAnnotations,
+		"manifests/combo.clusterserviceversion.yaml": testCSV("0.0.2"),
+		"manifests/crd.yaml":                         testCRDv2,
+	})
+
+	po := &platformv1alpha1.PlatformOperator{
+		ObjectMeta: metav1.ObjectMeta{Name: "combo", UID: "uid"},
+		Spec:       platformv1alpha1.PlatformOperatorSpec{PackageName: "combo"},
+	}
+	c := newApplyRecorder(t, install(t, po, installed)...)
+	po.Status.ActiveBundle = &platformv1alpha1.ActiveBundle{
+		Version: "0.0.1",
+		Image:   host + "/combo/bundle:v0.0.1",
+		Digest:  strings.SplitN(installed, "@", 2)[1],
+	}
+	d, err := NewDirectHandler(c).Diff(context.Background(), po, &sourcer.Bundle{Version: "0.0.2", Image: desired, Package: "combo"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(c.applied) != 0 || len(c.deleted) != 0 {
+		t.Errorf("expected nothing to be applied or pruned, got %v and %v", appliedKeys(c.applied), c.deleted)
+	}
+	if d.FromVersion != "0.0.1" || d.ToVersion != "0.0.2" {
+		t.Errorf("expected a diff from 0.0.1 to 0.0.2, got %s to %s", d.FromVersion, d.ToVersion)
+	}
+
+	for _, tt := range []struct {
+		name string
+		got  []platformv1alpha1.AppliedObject
+		want []string
+	}{
+		{
+			name: "added",
+			got:  d.Added,
+			want: []string{
+				"ClusterRole/combo.v0.0.2-combo-operator",
+				"ClusterRoleBinding/combo.v0.0.2-combo-operator",
+				"Role/combo-system/combo.v0.0.2-combo-operator",
+				"RoleBinding/combo-system/combo.v0.0.2-combo-operator",
+			},
+		},
+		{
+			name: "removed",
+			got:  d.Removed,
+			want: []string{
+				"ClusterRole/combo.v0.0.1-combo-operator",
+				"ClusterRoleBinding/combo.v0.0.1-combo-operator",
+				"Role/combo-system/combo.v0.0.1-combo-operator",
+				"RoleBinding/combo-system/combo.v0.0.1-combo-operator",
+				"Service/combo-system/combo-metrics",
+			},
+		},
+		{
+			name: "changed",
+			got:  d.Changed,
+			want: []string{
+				"CustomResourceDefinition/combos.example.com",
+				"Deployment/combo-system/combo-operator",
+			},
+		},
+	} {
+		var got []string
+		for _, ref := range tt.got {
+			got = append(got, refKey(ref))
+		}
+		if !equal(sorted(got), tt.want) {
+			t.Errorf("expected the %s objects to be %v, got %v", tt.name, tt.want, got)
+		}
+	}
+
+	want := []platformv1alpha1.CRDChange{{
+		Name: "combos.example.com",
+		Changes: []string{
+			"v1: storage changed from true to false",
+			"v1: added property spec",
+			"v1: added required property spec.size",
+			"added version v2",
+		},
+	}}
+	if !reflect.DeepEqual(d.CRDChanges, want) {
+		t.Errorf("expected the CRD changes to be %v, got %v", want, d.CRDChanges)
+	}
+}
+
+func TestDiffWithoutInstalledBundle(t *testing.T) {
+	host := newTestRegistry(t)
+	image := pushBundleImage(t, host+"/combo/bundle", map[string]string{
+		"metadata/annotations.yaml":                  testAnnotations,
+		"manifests/combo.clusterserviceversion.yaml": testCSV("0.0.1"),
+	})
+
+	po := &platformv1alpha1.PlatformOperator{
+		ObjectMeta: metav1.ObjectMeta{Name: "combo"},
+		Spec:       platformv1alpha1.PlatformOperatorSpec{PackageName: "combo"},
+	}
+	d, err := NewBundleDeploymentHandler(newApplyRecorder(t)).Diff(context.Background(), po, &sourcer.Bundle{Version: "0.0.1", Image: image})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(d.Added) == 0 || len(d.Removed) != 0 || len(d.Changed) != 0 {
+		t.Errorf("expected every object to be added, got %+v", d)
+	}
+}
+
+func TestDiffLiveState(t *testing.T) {
+	host := newTestRegistry(t)
+	image := pushBundleImage(t, host+"/combo/bundle", map[string]string{
+		"metadata/annotations.yaml":                  testAnnotations,
+		"manifests/combo.clusterserviceversion.yaml": testCSV("0.0.1"),
+		"manifests/service.yaml":                     testService,
+	})
+
+	po := &platformv1alpha1.PlatformOperator{
+		ObjectMeta: metav1.ObjectMeta{Name: "combo", UID: "uid"},
+		Spec:       platformv1alpha1.PlatformOperatorSpec{PackageName: "combo"},
+	}
+	// The live state differs from the installed bundle: the Service was edited
+	// by hand, the Deployment was deleted and a ConfigMap the bundle no longer
+	// ships is left over.
+	var live []client.Object
+	for _, obj := range install(t, po, image) {
+		u := obj.(*unstructured.Unstructured)
+		switch u.GetKind() {
+		case "Deployment":
+			continue
+		case "Service":
+			ports := []interface{}{map[string]interface{}{"port": int64(9443)}}
+			if err := unstructured.SetNestedSlice(u.Object, ports, "spec", "ports"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		live = append(live, u)
+	}
+	leftover := &unstructured.Unstructured{}
+	leftover.SetAPIVersion("v1")
+	leftover.SetKind("ConfigMap")
+	leftover.SetNamespace("combo-system")
+	leftover.SetName("combo-config")
+	live = append(live, leftover)
+
+	po.Status.ActiveBundle = &platformv1alpha1.ActiveBundle{
+		Version: "0.0.1",
+		Image:   host + "/combo/bundle:v0.0.1",
+		Digest:  strings.SplitN(image, "@", 2)[1],
+	}
+	po.Status.AppliedObjects = []platformv1alpha1.AppliedObject{
+		{APIVersion: "v1", Kind: "ConfigMap", Namespace: "combo-system", Name: "combo-config"},
+		{APIVersion: "v1", Kind: "ConfigMap", Namespace: "combo-system", Name: "deleted"},
+	}
+	// The same bundle is diffed, so only the live state can make a difference.
+	d, err := NewDirectHandler(newApplyRecorder(t, live...)).Diff(context.Background(), po, &sourcer.Bundle{Version: "0.0.1", Image: image, Package: "combo"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, tt := range []struct {
+		name string
+		got  []platformv1alpha1.AppliedObject
+		want []string
+	}{
+		{name: "added", got: d.Added, want: []string{"Deployment/combo-system/combo-operator"}},
+		{name: "removed", got: d.Removed, want: []string{"ConfigMap/combo-system/combo-config"}},
+		{name: "changed", got: d.Changed, want: []string{"Service/combo-system/combo-metrics"}},
+	} {
+		var got []string
+		for _, ref := range tt.got {
+			got = append(got, refKey(ref))
+		}
+		if !equal(sorted(got), tt.want) {
+			t.Errorf("expected the %s objects to be %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
+
+// install returns the objects the direct applier applies for the bundle, to
+// seed the live state of the cluster.
+func install(t *testing.T, po *platformv1alpha1.PlatformOperator, image string) []client.Object {
+	t.Helper()
+
+	c := newApplyRecorder(t)
+	if err := NewDirectHandler(c).Apply(context.Background(), po.DeepCopy(), &sourcer.Bundle{Image: image, Package: "combo"}); err != nil {
+		t.Fatal(err)
+	}
+	objs := make([]client.Object, 0, len(c.applied))
+	for _, obj := range c.applied {
+		objs = append(objs, obj)
+	}
+	return objs
+}
+
+func refKey(ref platformv1alpha1.AppliedObject) string {
+	if ref.Namespace == "" {
+		return ref.Kind + "/" + ref.Name
+	}
+	return strings.Join([]string{ref.Kind, ref.Namespace, ref.Name}, "/")
+}
+
+func sorted(keys []string) []string {
+	out := append([]string(nil), keys...)
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,200 @@
+package applier
+
+import (
+	"context"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilerror "k8s.io/apimachinery/pkg/util/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logr "sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/openshift/platform-operators/api/v1alpha1"
+	"github.com/openshift/platform-operators/internal/sourcer"
+)
+
+const (
+	// FieldManager is the field manager that owns the fields of the objects
+	// applied directly by the platform operators manager.
+	FieldManager = "platformoperator-applier"
+)
+
+// directApplier unpacks bundle images itself and applies the resulting objects
+// with server-side apply, without requiring rukpak to run on the cluster.
+type directApplier struct {
+	client.Client
+	options
+	cache *bundleCache
+}
+
+// NewDirectHandler returns an Applier that applies the objects of registry+v1
+// and plain bundles directly, pruning the objects that were applied for a
+// previous version and recording the applied objects in status.
+func NewDirectHandler(c client.Client, opts ...Option) Applier {
+	o := newOptions(opts)
+	return &directApplier{
+		Client:  c,
+		options: o,
+		cache:   newBundleCache(o.remote),
+	}
+}
+
+func (a *directApplier) Apply(ctx context.Context, po *v1alpha1.PlatformOperator, b *sourcer.Bundle) error {
+	if err := a.rewriteImage(ctx, b); err != nil {
+		return err
+	}
+	objs, err := renderBundle(ctx, a.cache, a.RESTMapper(), po, b)
+	if err != nil {
+		return err
+	}
+	unverified, err := checkCRDUpgrades(ctx, a.Client, objs)
+	if err != nil {
+		return err
+	}
+
+	objs = ownedBy(po, objs)
+	applied := make([]v1alpha1.AppliedObject, 0, len(objs))
+	for i := range objs {
+		obj := &objs[i]
+		applied = append(applied, appliedObject(obj))
+		if err := a.Patch(ctx, obj, client.Apply, client.FieldOwner(FieldManager), client.ForceOwnership); err != nil {
+			// Keep track of every object that may have been applied, so they're
+			// still pruned when the next attempt renders a different set.
+			po.Status.AppliedObjects = union(po.Status.AppliedObjects, applied)
+			return fmt.Errorf("failed to apply %s %s: %w", obj.GetKind(), client.ObjectKeyFromObject(obj), err)
+		}
+	}
+
+	stale, err := a.prune(ctx, po.Status.AppliedObjects, applied)
+	po.Status.AppliedObjects = union(applied, stale)
+	if err != nil {
+		return err
+	}
+	return unverified
+}
+
+func (a *directApplier) Diff(ctx context.Context, po *v1alpha1.PlatformOperator, b *sourcer.Bundle) (*v1alpha1.BundleDiff, error) {
+	if err := a.rewriteImage(ctx, b); err != nil {
+		return nil, err
+	}
+	return diff(ctx, a.Client, func(b *sourcer.Bundle) ([]unstructured.Unstructured, error) {
+		objs, err := renderBundle(ctx, a.cache, a.RESTMapper(), po, b)
+		if err != nil {
+			return nil, err
+		}
+		return ownedBy(po, objs), nil
+	}, po, b)
+}
+
+func (a *directApplier) Drift(ctx context.Context, po *v1alpha1.PlatformOperator, b *sourcer.Bundle) ([]Drift, error) {
+	if err := a.rewriteImage(ctx, b); err != nil {
+		return nil, err
+	}
+	objs, err := renderBundle(ctx, a.cache, a.RESTMapper(), po, b)
+	if err != nil {
+		return nil, err
+	}
+	return detectDrift(ctx, a.Client, objs)
+}
+
+func (a *directApplier) Hooks(ctx context.Context, po *v1alpha1.PlatformOperator, b *sourcer.Bundle) ([]v1alpha1.Hook, error) {
+	if err := a.rewriteImage(ctx, b); err != nil {
+		return nil, err
+	}
+	return bundleHooks(ctx, a.cache, po, b)
+}
+
+func (a *directApplier) Forget(name string) {
+	a.cache.forget(name)
+}
+
+// prune deletes the previously applied objects that are no longer part of the
+// applied set, returning the ones that couldn't be deleted. CRDs are orphaned
+// rather than deleted, so the custom resources stored in them are preserved.
+func (a *directApplier) prune(ctx context.Context, previous, applied []v1alpha1.AppliedObject) ([]v1alpha1.AppliedObject, error) {
+	log := logr.FromContext(ctx)
+
+	current := make(map[string]bool, len(applied))
+	for _, ref := range applied {
+		current[identity(ref)] = true
+	}
+	var (
+		stale []v1alpha1.AppliedObject
+		errs  []error
+	)
+	for _, ref := range previous {
+		if current[identity(ref)] {
+			continue
+		}
+		obj := &unstructured.Unstructured{}
+		obj.SetAPIVersion(ref.APIVersion)
+		obj.SetKind(ref.Kind)
+		obj.SetNamespace(ref.Namespace)
+		obj.SetName(ref.Name)
+		if isCRD(obj.GroupVersionKind()) {
+			log.Info("orphaning a CustomResourceDefinition that's no longer part of the bundle", "name", ref.Name)
+			continue
+		}
+		if err := a.Delete(ctx, obj); client.IgnoreNotFound(err) != nil {
+			stale = append(stale, ref)
+			errs = append(errs, fmt.Errorf("failed to prune %s %s: %w", ref.Kind, client.ObjectKeyFromObject(obj), err))
+			continue
+		}
+		log.V(1).Info("pruned object", "kind", ref.Kind, "namespace", ref.Namespace, "name", ref.Name)
+	}
+	return stale, utilerror.NewAggregate(errs)
+}
+
+func isCRD(gvk schema.GroupVersionKind) bool {
+	return gvk.GroupKind() == schema.GroupKind{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"}
+}
+
+// ownedBy sets the PlatformOperator as the controller of the objects, so they're
+// garbage collected along with it. CRDs aren't garbage collected along with the
+// PlatformOperator, as that would delete every custom resource stored in them.
+func ownedBy(po *v1alpha1.PlatformOperator, objs []unstructured.Unstructured) []unstructured.Unstructured {
+	controllerRef := metav1.NewControllerRef(po, v1alpha1.GroupVersion.WithKind(v1alpha1.PlatformOperatorKind))
+	for i := range objs {
+		if !isCRD(objs[i].GroupVersionKind()) {
+			objs[i].SetOwnerReferences([]metav1.OwnerReference{*controllerRef})
+		}
+	}
+	return objs
+}
+
+func appliedObject(obj *unstructured.Unstructured) v1alpha1.AppliedObject {
+	return v1alpha1.AppliedObject{
+		APIVersion: obj.GetAPIVersion(),
+		Kind:       obj.GetKind(),
+		Namespace:  obj.GetNamespace(),
+		Name:       obj.GetName(),
+	}
+}
+
+// identity identifies the object regardless of the API version it was applied
+// with, so an object that's served under a new version isn't mistaken for a
+// different one.
+func identity(ref v1alpha1.AppliedObject) string {
+	gv, _ := schema.ParseGroupVersion(ref.APIVersion)
+	return fmt.Sprintf("%s/%s/%s/%s", gv.Group, ref.Kind, ref.Namespace, ref.Name)
+}
+
+// union returns the objects in any of the sets, in order and without
+// duplicates.
+func union(sets ...[]v1alpha1.AppliedObject) []v1alpha1.AppliedObject {
+	var (
+		out  []v1alpha1.AppliedObject
+		seen = make(map[string]bool)
+	)
+	for _, set := range sets {
+		for _, ref := range set {
+			if id := identity(ref); !seen[id] {
+				seen[id] = true
+				out = append(out, ref)
+			}
+		}
+	}
+	return out
+}
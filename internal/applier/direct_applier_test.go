@@ -0,0 +1,363 @@
+package applier
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	platformv1alpha1 "github.com/openshift/platform-operators/api/v1alpha1"
+	"github.com/openshift/platform-operators/internal/sourcer"
+	"github.com/openshift/platform-operators/internal/util"
+)
+
+const testAnnotations = `annotations:
+  operators.operatorframework.io.bundle.mediatype.v1: registry+v1
+  operators.operatorframework.io.bundle.package.v1: combo
+`
+
+const testCRD = `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: combos.example.com
+spec:
+  group: example.com
+  names:
+    kind: Combo
+    plural: combos
+  scope: Namespaced
+  versions:
+  - name: v1
+    served: true
+    storage: true
+`
+
+const testService = `apiVersion: v1
+kind: Service
+metadata:
+  name: combo-metrics
+spec:
+  ports:
+  - port: 8443
+`
+
+func testCSV(version string) string {
+	return `apiVersion: operators.coreos.com/v1alpha1
+kind: ClusterServiceVersion
+metadata:
+  name: combo.v` + version + `
+spec:
+  install:
+    strategy: deployment
+    spec:
+      permissions:
+      - serviceAccountName: combo-operator
+        rules:
+        - apiGroups: [""]
+          resources: [configmaps]
+          verbs: [get, list, watch]
+      clusterPermissions:
+      - serviceAccountName: combo-operator
+        rules:
+        - apiGroups: [example.com]
+          resources: [combos]
+          verbs: ["*"]
+      deployments:
+      - name: combo-operator
+        spec:
+          selector:
+            matchLabels:
+              app: combo-operator
+          template:
+            metadata:
+              labels:
+                app: combo-operator
+            spec:
+              serviceAccountName: combo-operator
+              containers:
+              - name: manager
+                image: quay.io/combo/operator:v` + version + `
+`
+}
+
+// pushBundleImage pushes an image containing the files to the in-process
+// registry and returns its digest reference.
+func pushBundleImage(t *testing.T, repo string, files map[string]string) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for path, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: path, Mode: 0o644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	layer, err := tarball.LayerFromReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := mutate.AppendLayers(empty.Image, layer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest, err := img.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := name.ParseReference(repo + "@" + digest.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(ref, img); err != nil {
+		t.Fatal(err)
+	}
+	return ref.String()
+}
+
+func newTestRegistry(t *testing.T) string {
+	t.Helper()
+
+	srv := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	t.Cleanup(srv.Close)
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.Host
+}
+
+// applyRecorder records the objects that are applied and deleted, as the fake
+// client doesn't support server-side apply. Dry runs aren't recorded, and
+// return the applied fields merged into the live object.
+type applyRecorder struct {
+	client.Client
+	applied map[string]*unstructured.Unstructured
+	deleted []string
+}
+
+func newApplyRecorder(t *testing.T, objs ...client.Object) *applyRecorder {
+	t.Helper()
+
+	mapper := meta.NewDefaultRESTMapper(nil)
+	for _, gvk := range []schema.GroupVersionKind{
+		{Version: "v1", Kind: "Service"},
+		{Version: "v1", Kind: "ConfigMap"},
+	} {
+		mapper.Add(gvk, meta.RESTScopeNamespace)
+	}
+	mapper.Add(schema.GroupVersionKind{Group: "apiextensions.k8s.io", Version: "v1", Kind: "CustomResourceDefinition"}, meta.RESTScopeRoot)
+	return &applyRecorder{
+		Client:  fake.NewClientBuilder().WithScheme(runtime.NewScheme()).WithRESTMapper(mapper).WithObjects(objs...).Build(),
+		applied: make(map[string]*unstructured.Unstructured),
+	}
+}
+
+func (r *applyRecorder) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	if patch != client.Apply {
+		return errors.New("expected a server-side apply patch")
+	}
+	u := obj.(*unstructured.Unstructured)
+	patchOpts := &client.PatchOptions{}
+	patchOpts.ApplyOptions(opts)
+	if len(patchOpts.DryRun) != 0 {
+		live := &unstructured.Unstructured{}
+		live.SetGroupVersionKind(u.GroupVersionKind())
+		if err := r.Get(ctx, client.ObjectKeyFromObject(u), live); err != nil {
+			return err
+		}
+		// Round trip the result, as the API server's response would be decoded.
+		data, err := json.Marshal(mergeFields(live.Object, u.Object))
+		if err != nil {
+			return err
+		}
+		return u.UnmarshalJSON(data)
+	}
+	r.applied[key(u)] = u.DeepCopy()
+	return nil
+}
+
+// mergeFields approximates server-side apply by setting the applied fields on
+// the live object. Lists are replaced rather than merged.
+func mergeFields(live, applied map[string]interface{}) map[string]interface{} {
+	merged := runtime.DeepCopyJSON(live)
+	for key, value := range applied {
+		if fields, ok := value.(map[string]interface{}); ok {
+			if liveFields, ok := merged[key].(map[string]interface{}); ok {
+				merged[key] = mergeFields(liveFields, fields)
+				continue
+			}
+		}
+		merged[key] = runtime.DeepCopyJSONValue(value)
+	}
+	return merged
+}
+
+func (r *applyRecorder) Delete(_ context.Context, obj client.Object, _ ...client.DeleteOption) error {
+	u := obj.(*unstructured.Unstructured)
+	r.deleted = append(r.deleted, key(u))
+	return nil
+}
+
+func key(u *unstructured.Unstructured) string {
+	if u.GetNamespace() == "" {
+		return u.GetKind() + "/" + u.GetName()
+	}
+	return strings.Join([]string{u.GetKind(), u.GetNamespace(), u.GetName()}, "/")
+}
+
+func TestDirectApplierRegistryV1(t *testing.T) {
+	host := newTestRegistry(t)
+	v1 := pushBundleImage(t, host+"/combo/bundle", map[string]string{
+		"metadata/annotations.yaml":                  testAnnotations,
+		"manifests/combo.clusterserviceversion.yaml": testCSV("0.0.1"),
+		"manifests/crd.yaml":                         testCRD,
+		"manifests/service.yaml":                     testService,
+	})
+	v2 := pushBundleImage(t, host+"/combo/bundle", map[string]string{
+		"metadata/annotations.yaml":                  testAnnotations,
+		"manifests/combo.clusterserviceversion.yaml": testCSV("0.0.2"),
+		"manifests/crd.yaml":                         testCRD,
+	})
+
+	c := newApplyRecorder(t)
+	a := NewDirectHandler(c)
+	po := &platformv1alpha1.PlatformOperator{
+		ObjectMeta: metav1.ObjectMeta{Name: "combo", UID: "uid"},
+		Spec:       platformv1alpha1.PlatformOperatorSpec{PackageName: "combo"},
+	}
+	if err := a.Apply(context.Background(), po, &sourcer.Bundle{Image: v1, Package: "combo"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []string{
+		"ClusterRole/combo.v0.0.1-combo-operator",
+		"ClusterRoleBinding/combo.v0.0.1-combo-operator",
+		"CustomResourceDefinition/combos.example.com",
+		"Deployment/combo-system/combo-operator",
+		"Namespace/combo-system",
+		"Role/combo-system/combo.v0.0.1-combo-operator",
+		"RoleBinding/combo-system/combo.v0.0.1-combo-operator",
+		"Service/combo-system/combo-metrics",
+		"ServiceAccount/combo-system/combo-operator",
+	}
+	if got := appliedKeys(c.applied); !equal(got, want) {
+		t.Errorf("expected the applied objects to be %v, got %v", want, got)
+	}
+	if got := len(po.Status.AppliedObjects); got != len(want) {
+		t.Errorf("expected %d objects to be recorded in status, got %d", len(want), got)
+	}
+	if refs := c.applied["CustomResourceDefinition/combos.example.com"].GetOwnerReferences(); len(refs) != 0 {
+		t.Errorf("expected CRDs not to be owned by the platform operator, got %v", refs)
+	}
+	deployment := c.applied["Deployment/combo-system/combo-operator"]
+	if refs := deployment.GetOwnerReferences(); len(refs) != 1 || refs[0].Name != "combo" {
+		t.Errorf("expected the deployment to be owned by the platform operator, got %v", refs)
+	}
+	if _, ok, _ := unstructured.NestedString(deployment.Object, "spec", "template", "metadata", "annotations", targetNamespacesAnnotation); !ok {
+		t.Errorf("expected the deployment to target all namespaces")
+	}
+
+	c.applied = make(map[string]*unstructured.Unstructured)
+	if err := a.Apply(context.Background(), po, &sourcer.Bundle{Image: v2, Package: "combo"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	wantDeleted := []string{
+		"ClusterRole/combo.v0.0.1-combo-operator",
+		"ClusterRoleBinding/combo.v0.0.1-combo-operator",
+		"Role/combo-system/combo.v0.0.1-combo-operator",
+		"RoleBinding/combo-system/combo.v0.0.1-combo-operator",
+		"Service/combo-system/combo-metrics",
+	}
+	sort.Strings(c.deleted)
+	if !equal(c.deleted, wantDeleted) {
+		t.Errorf("expected the objects dropped from the bundle to be pruned, got %v", c.deleted)
+	}
+	if got := len(po.Status.AppliedObjects); got != len(c.applied) {
+		t.Errorf("expected the %d applied objects to be recorded in status, got %d", len(c.applied), got)
+	}
+}
+
+func TestDirectApplierPlain(t *testing.T) {
+	host := newTestRegistry(t)
+	image := pushBundleImage(t, host+"/combo/plain", map[string]string{
+		"manifests/configmap.yaml": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: combo
+  namespace: combo
+---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: combo
+`,
+		"etc/unrelated.yaml": "not a manifest",
+	})
+
+	c := newApplyRecorder(t)
+	po := &platformv1alpha1.PlatformOperator{ObjectMeta: metav1.ObjectMeta{Name: "combo"}}
+	if err := NewDirectHandler(c).Apply(context.Background(), po, &sourcer.Bundle{Image: image}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, want := appliedKeys(c.applied), []string{"ConfigMap/combo/combo", "Namespace/combo"}; !equal(got, want) {
+		t.Errorf("expected the applied objects to be %v, got %v", want, got)
+	}
+}
+
+func TestDirectApplierRequiresDigest(t *testing.T) {
+	po := &platformv1alpha1.PlatformOperator{ObjectMeta: metav1.ObjectMeta{Name: "combo"}}
+	err := NewDirectHandler(newApplyRecorder(t)).Apply(context.Background(), po, &sourcer.Bundle{Image: "quay.io/combo/bundle:v0.0.1"})
+	var permanent *util.PermanentError
+	if !errors.As(err, &permanent) {
+		t.Errorf("expected a permanent error for an image that isn't pinned to a digest, got %v", err)
+	}
+}
+
+func appliedKeys(applied map[string]*unstructured.Unstructured) []string {
+	keys := make([]string, 0, len(applied))
+	for k := range applied {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
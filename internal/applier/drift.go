@@ -0,0 +1,146 @@
+package applier
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logr "sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/openshift/platform-operators/api/v1alpha1"
+)
+
+// Drift describes how an installed object differs from the bundle's content.
+type Drift struct {
+	Object v1alpha1.AppliedObject
+	// Fields are the paths of the fields whose live values differ from the
+	// bundle's content. Fields is empty when the object has been deleted.
+	Fields []string
+}
+
+func (d Drift) String() string {
+	ref := d.Object.Kind + " " + d.Object.Name
+	if d.Object.Namespace != "" {
+		ref = d.Object.Kind + " " + d.Object.Namespace + "/" + d.Object.Name
+	}
+	if len(d.Fields) == 0 {
+		return ref + " (deleted)"
+	}
+	return fmt.Sprintf("%s (%s)", ref, strings.Join(d.Fields, ", "))
+}
+
+// detectDrift compares the live state of the desired objects with their
+// content. Only the fields set by the content are compared, so the fields that
+// are defaulted by the API server or set by other actors aren't reported. The
+// objects the manager isn't allowed to read are skipped, so drift is only
+// detected for the kinds it's granted get on.
+func detectDrift(ctx context.Context, c client.Reader, desired []unstructured.Unstructured) ([]Drift, error) {
+	log := logr.FromContext(ctx)
+
+	var drifted []Drift
+	for i := range desired {
+		obj := &desired[i]
+		live := &unstructured.Unstructured{}
+		live.SetGroupVersionKind(obj.GroupVersionKind())
+		if err := c.Get(ctx, client.ObjectKeyFromObject(obj), live); err != nil {
+			if apierrors.IsForbidden(err) {
+				log.V(1).Info("skipping drift detection of an object the manager isn't allowed to read", "kind", obj.GetKind(), "object", client.ObjectKeyFromObject(obj))
+				continue
+			}
+			if client.IgnoreNotFound(err) != nil {
+				return nil, fmt.Errorf("failed to get %s %s: %w", obj.GetKind(), client.ObjectKeyFromObject(obj), err)
+			}
+			drifted = append(drifted, Drift{Object: appliedObject(obj)})
+			continue
+		}
+		if fields := driftedFields(obj.Object, live.Object); len(fields) != 0 {
+			drifted = append(drifted, Drift{Object: appliedObject(obj), Fields: fields})
+		}
+	}
+	return drifted, nil
+}
+
+// driftedFields returns the paths of the fields of the desired object whose live
+// values differ. Besides its labels and annotations, the object's metadata is
+// managed by the API server and isn't compared, and neither is its status.
+func driftedFields(desired, live map[string]interface{}) []string {
+	var fields []string
+	for key, value := range desired {
+		switch key {
+		case "apiVersion", "kind", "status":
+			continue
+		case "metadata":
+			metadata, _ := value.(map[string]interface{})
+			liveMetadata, _ := live["metadata"].(map[string]interface{})
+			for _, key := range []string{"labels", "annotations"} {
+				fields = append(fields, compareValues("metadata."+key, metadata[key], liveMetadata[key])...)
+			}
+			continue
+		}
+		fields = append(fields, compareValues(key, value, live[key])...)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+func compareValues(path string, desired, live interface{}) []string {
+	switch desired := desired.(type) {
+	case nil:
+		return nil
+	case map[string]interface{}:
+		if len(desired) == 0 {
+			return nil
+		}
+		liveMap, ok := live.(map[string]interface{})
+		if !ok {
+			return []string{path}
+		}
+		var fields []string
+		for key, value := range desired {
+			fields = append(fields, compareValues(path+"."+key, value, liveMap[key])...)
+		}
+		return fields
+	case []interface{}:
+		if len(desired) == 0 {
+			return nil
+		}
+		liveSlice, ok := live.([]interface{})
+		if !ok || len(liveSlice) != len(desired) {
+			return []string{path}
+		}
+		var fields []string
+		for i := range desired {
+			fields = append(fields, compareValues(fmt.Sprintf("%s[%d]", path, i), desired[i], liveSlice[i])...)
+		}
+		return fields
+	}
+	if a, ok := toFloat(desired); ok {
+		if b, ok := toFloat(live); ok && a == b {
+			return nil
+		}
+		return []string{path}
+	}
+	if !reflect.DeepEqual(desired, live) {
+		return []string{path}
+	}
+	return nil
+}
+
+// toFloat normalizes numbers, as manifests decoded from YAML hold floats while
+// the API server returns integers.
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
@@ -0,0 +1,142 @@
+package applier
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+const desiredDeployment = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: combo-operator
+  namespace: combo-system
+  labels:
+    app: combo
+spec:
+  replicas: 1
+  template:
+    spec:
+      containers:
+      - name: manager
+        image: quay.io/combo/operator:v0.0.1
+        args: [--leader-elect]
+`
+
+func TestDetectDrift(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		live string
+		want []string
+	}{
+		{
+			name: "unchanged",
+			live: desiredDeployment,
+		},
+		{
+			name: "fields set by other actors",
+			live: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: combo-operator
+  namespace: combo-system
+  uid: 1d9f
+  labels:
+    app: combo
+    team: platform
+  annotations:
+    deployment.kubernetes.io/revision: "2"
+spec:
+  replicas: 1
+  progressDeadlineSeconds: 600
+  template:
+    spec:
+      containers:
+      - name: manager
+        image: quay.io/combo/operator:v0.0.1
+        args: [--leader-elect]
+        imagePullPolicy: IfNotPresent
+status:
+  replicas: 1
+`,
+		},
+		{
+			name: "modified fields",
+			live: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: combo-operator
+  namespace: combo-system
+  labels:
+    app: patched
+spec:
+  replicas: 3
+  template:
+    spec:
+      containers:
+      - name: manager
+        image: quay.io/combo/operator:v0.0.1
+        args: []
+`,
+			want: []string{"Deployment combo-system/combo-operator (metadata.labels.app, spec.replicas, spec.template.spec.containers[0].args)"},
+		},
+		{
+			name: "deleted",
+			want: []string{"Deployment combo-system/combo-operator (deleted)"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			b := fake.NewClientBuilder().WithScheme(runtime.NewScheme())
+			if tt.live != "" {
+				b = b.WithObjects(parseObject(t, tt.live))
+			}
+			drifted, err := detectDrift(context.Background(), b.Build(), []unstructured.Unstructured{*parseObject(t, desiredDeployment)})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var got []string
+			for _, d := range drifted {
+				got = append(got, d.String())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected the drift %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+// forbiddenGetter isn't allowed to read Namespaces.
+type forbiddenGetter struct {
+	client.Client
+}
+
+func (c forbiddenGetter) Get(ctx context.Context, key client.ObjectKey, obj client.Object) error {
+	if gvk := obj.GetObjectKind().GroupVersionKind(); gvk.Kind == "Namespace" {
+		return apierrors.NewForbidden(schema.GroupResource{Resource: "namespaces"}, key.Name, errors.New("not allowed"))
+	}
+	return c.Client.Get(ctx, key, obj)
+}
+
+func TestDetectDriftForbidden(t *testing.T) {
+	namespace := &unstructured.Unstructured{}
+	namespace.SetAPIVersion("v1")
+	namespace.SetKind("Namespace")
+	namespace.SetName("combo-system")
+	c := forbiddenGetter{Client: fake.NewClientBuilder().WithScheme(runtime.NewScheme()).Build()}
+
+	drifted, err := detectDrift(context.Background(), c, []unstructured.Unstructured{*namespace, *parseObject(t, desiredDeployment)})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := "Deployment combo-system/combo-operator (deleted)"; len(drifted) != 1 || drifted[0].String() != want {
+		t.Errorf("expected only the readable objects to be checked for drift, got %v", drifted)
+	}
+}
@@ -0,0 +1,59 @@
+package applier
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/openshift/platform-operators/api/v1alpha1"
+	"github.com/openshift/platform-operators/internal/sourcer"
+	"github.com/openshift/platform-operators/internal/util"
+)
+
+const (
+	// The bundle annotations declaring the hooks of each phase, as a stream of
+	// Job manifests. Each hook is named after its Job.
+	preApplyHooksAnnotation    = "platform.openshift.io/pre-apply-hooks"
+	postInstallHooksAnnotation = "platform.openshift.io/post-install-hooks"
+)
+
+// bundleHooks returns the hooks declared by the bundle's annotations.
+func bundleHooks(ctx context.Context, cache *bundleCache, po *v1alpha1.PlatformOperator, b *sourcer.Bundle) ([]v1alpha1.Hook, error) {
+	content, err := cache.get(ctx, po.Name, b.Image)
+	if err != nil {
+		return nil, err
+	}
+	var hooks []v1alpha1.Hook
+	for _, declared := range []struct {
+		annotation string
+		phase      v1alpha1.HookPhase
+	}{
+		{preApplyHooksAnnotation, v1alpha1.HookPhasePreApply},
+		{postInstallHooksAnnotation, v1alpha1.HookPhasePostInstall},
+	} {
+		manifests, ok := content.annotations[declared.annotation]
+		if !ok {
+			continue
+		}
+		objs, err := decodeManifests([]byte(manifests))
+		if err != nil {
+			return nil, util.NewPermanentError(fmt.Errorf("failed to decode the %s bundle's %s annotation: %w", b.Image, declared.annotation, err))
+		}
+		for i := range objs {
+			if gvk := objs[i].GroupVersionKind(); gvk.Group != "batch" || gvk.Kind != "Job" {
+				return nil, util.NewPermanentError(fmt.Errorf("the %s bundle's %s annotation declares a %s rather than a Job", b.Image, declared.annotation, gvk.Kind))
+			}
+			data, err := objs[i].MarshalJSON()
+			if err != nil {
+				return nil, err
+			}
+			hooks = append(hooks, v1alpha1.Hook{
+				Name:  objs[i].GetName(),
+				Phase: declared.phase,
+				Job:   runtime.RawExtension{Raw: data},
+			})
+		}
+	}
+	return hooks, nil
+}
@@ -0,0 +1,68 @@
+package applier
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	platformv1alpha1 "github.com/openshift/platform-operators/api/v1alpha1"
+	"github.com/openshift/platform-operators/internal/sourcer"
+)
+
+func TestBundleHooks(t *testing.T) {
+	repo := newTestRegistry(t) + "/combo/bundle"
+	image := pushBundleImage(t, repo, map[string]string{
+		"manifests/combo.crd.yaml": testCRD,
+		"metadata/annotations.yaml": testAnnotations + `  platform.openshift.io/pre-apply-hooks: |
+    apiVersion: batch/v1
+    kind: Job
+    metadata:
+      name: migrate
+      namespace: combo-system
+    ---
+    apiVersion: batch/v1
+    kind: Job
+    metadata:
+      name: backup
+      namespace: combo-system
+  platform.openshift.io/post-install-hooks: |
+    apiVersion: batch/v1
+    kind: Job
+    metadata:
+      name: smoke-test
+      namespace: combo-system
+`,
+	})
+
+	po := &platformv1alpha1.PlatformOperator{ObjectMeta: metav1.ObjectMeta{Name: "combo"}}
+	hooks, err := NewDirectHandler(newApplyRecorder(t)).Hooks(context.Background(), po, &sourcer.Bundle{Image: image})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var got []string
+	for _, h := range hooks {
+		got = append(got, string(h.Phase)+"/"+h.Name)
+	}
+	if want := []string{"PreApply/migrate", "PreApply/backup", "PostInstall/smoke-test"}; !equal(got, want) {
+		t.Errorf("expected the hooks %v, got %v", want, got)
+	}
+}
+
+func TestBundleHooksRequireJobs(t *testing.T) {
+	repo := newTestRegistry(t) + "/combo/bundle"
+	image := pushBundleImage(t, repo, map[string]string{
+		"manifests/combo.crd.yaml": testCRD,
+		"metadata/annotations.yaml": testAnnotations + `  platform.openshift.io/pre-apply-hooks: |
+    apiVersion: v1
+    kind: Pod
+    metadata:
+      name: migrate
+`,
+	})
+
+	po := &platformv1alpha1.PlatformOperator{ObjectMeta: metav1.ObjectMeta{Name: "combo"}}
+	if _, err := NewDirectHandler(newApplyRecorder(t)).Hooks(context.Background(), po, &sourcer.Bundle{Image: image}); err == nil {
+		t.Error("expected an error for a hook that isn't a Job")
+	}
+}
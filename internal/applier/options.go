@@ -0,0 +1,61 @@
+package applier
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+
+	"github.com/openshift/platform-operators/internal/mirror"
+	"github.com/openshift/platform-operators/internal/resolver"
+	"github.com/openshift/platform-operators/internal/sourcer"
+	"github.com/openshift/platform-operators/internal/util"
+)
+
+type options struct {
+	mirrors mirror.Rewriter
+	remote  []remote.Option
+}
+
+// Option configures an Applier.
+type Option func(*options)
+
+// WithImageMirrors rewrites bundle images to the locations they're mirrored to
+// before they're applied.
+func WithImageMirrors(r mirror.Rewriter) Option {
+	return func(o *options) {
+		o.mirrors = r
+	}
+}
+
+// WithRemoteOptions configures how bundle images are pulled by the appliers
+// that unpack bundles themselves, e.g. the registry credentials to use.
+func WithRemoteOptions(opts ...remote.Option) Option {
+	return func(o *options) {
+		o.remote = append(o.remote, opts...)
+	}
+}
+
+func newOptions(opts []Option) options {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// rewriteImage ensures the bundle's image is pinned to a digest, and rewrites it
+// to the location it's mirrored to, if any.
+func (o options) rewriteImage(ctx context.Context, b *sourcer.Bundle) error {
+	if !resolver.IsDigest(b.Image) {
+		return util.NewPermanentError(fmt.Errorf("refusing to apply the %s image: only images pinned to a digest can be applied", b.Image))
+	}
+	if o.mirrors != nil {
+		image, err := o.mirrors.Rewrite(ctx, b.Image)
+		if err != nil {
+			return fmt.Errorf("failed to rewrite the %s image to its mirror: %w", b.Image, err)
+		}
+		b.Image = image
+	}
+	return nil
+}
@@ -0,0 +1,353 @@
+package applier
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	operatorsv1alpha1 "github.com/operator-framework/api/pkg/operators/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"github.com/openshift/platform-operators/api/v1alpha1"
+	"github.com/openshift/platform-operators/internal/sourcer"
+	"github.com/openshift/platform-operators/internal/util"
+)
+
+const (
+	mediaTypeAnnotation          = "operators.operatorframework.io.bundle.mediatype.v1"
+	packageAnnotation            = "operators.operatorframework.io.bundle.package.v1"
+	suggestedNamespaceAnnotation = "operatorframework.io/suggested-namespace"
+	targetNamespacesAnnotation   = "olm.targetNamespaces"
+
+	mediaTypeRegistryV1 = "registry+v1"
+	mediaTypePlain      = "plain+v0"
+)
+
+// scopeFunc reports whether objects of the kind are namespaced.
+type scopeFunc func(schema.GroupVersionKind) (bool, error)
+
+// namespaced returns a scopeFunc backed by the mapper. Kinds that are unknown to
+// the cluster are assumed to be namespaced, as they're most likely served by a
+// CRD in the same bundle.
+func namespaced(mapper meta.RESTMapper) scopeFunc {
+	return func(gvk schema.GroupVersionKind) (bool, error) {
+		mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if meta.IsNoMatchError(err) {
+			return true, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		return mapping.Scope.Name() == meta.RESTScopeNameNamespace, nil
+	}
+}
+
+// packageName returns the name of the bundle's package, which determines the
+// namespace registry+v1 bundles are installed in.
+func packageName(po *v1alpha1.PlatformOperator, b *sourcer.Bundle) string {
+	if b.Package != "" {
+		return b.Package
+	}
+	return po.Spec.PackageName
+}
+
+// renderBundle unpacks the bundle's image and returns the objects to apply for it.
+func renderBundle(ctx context.Context, cache *bundleCache, mapper meta.RESTMapper, po *v1alpha1.PlatformOperator, b *sourcer.Bundle) ([]unstructured.Unstructured, error) {
+	content, err := cache.get(ctx, po.Name, b.Image)
+	if err != nil {
+		return nil, err
+	}
+	return render(content, packageName(po, b), namespaced(mapper))
+}
+
+// render returns the objects to apply for the unpacked bundle. Plain bundles
+// are applied as they are, while the ClusterServiceVersion of registry+v1
+// bundles is rendered into the objects OLM would create for it.
+func render(content *bundleContent, packageName string, namespaced scopeFunc) ([]unstructured.Unstructured, error) {
+	var (
+		objs []unstructured.Unstructured
+		err  error
+	)
+	switch mediaType := content.annotations[mediaTypeAnnotation]; mediaType {
+	case "", mediaTypePlain:
+		for _, m := range content.manifests {
+			objs = append(objs, *m.DeepCopy())
+		}
+	case mediaTypeRegistryV1:
+		if pkg := content.annotations[packageAnnotation]; pkg != "" {
+			packageName = pkg
+		}
+		if objs, err = renderRegistryV1(content.manifests, packageName, namespaced); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, util.NewPermanentError(fmt.Errorf("unsupported bundle media type %q", mediaType))
+	}
+	sort.SliceStable(objs, func(i, j int) bool {
+		return applyOrder(objs[i].GroupVersionKind()) < applyOrder(objs[j].GroupVersionKind())
+	})
+	return objs, nil
+}
+
+// applyOrder ranks kinds so the objects others depend on, like namespaces,
+// CRDs and RBAC, are applied before the workloads that use them.
+func applyOrder(gvk schema.GroupVersionKind) int {
+	switch gvk.GroupKind() {
+	case schema.GroupKind{Kind: "Namespace"}:
+		return 0
+	case schema.GroupKind{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"}:
+		return 1
+	case schema.GroupKind{Kind: "ServiceAccount"},
+		schema.GroupKind{Group: rbacv1.GroupName, Kind: "ClusterRole"},
+		schema.GroupKind{Group: rbacv1.GroupName, Kind: "Role"}:
+		return 2
+	case schema.GroupKind{Group: rbacv1.GroupName, Kind: "ClusterRoleBinding"},
+		schema.GroupKind{Group: rbacv1.GroupName, Kind: "RoleBinding"}:
+		return 3
+	case schema.GroupKind{Group: appsv1.GroupName, Kind: "Deployment"}:
+		return 5
+	default:
+		return 4
+	}
+}
+
+// renderRegistryV1 renders the ClusterServiceVersion of a registry+v1 bundle
+// into its install namespace, service accounts, RBAC and deployments, alongside
+// the bundle's other manifests. The operator is installed in AllNamespaces mode.
+func renderRegistryV1(manifests []unstructured.Unstructured, packageName string, namespaced scopeFunc) ([]unstructured.Unstructured, error) {
+	csv, others, err := parseRegistryV1(manifests)
+	if err != nil {
+		return nil, err
+	}
+	installNamespace := registryV1InstallNamespace(csv, packageName)
+
+	objs := []runtime.Object{
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: installNamespace}},
+	}
+	existing := sets.NewString()
+	for i := range others {
+		isNamespaced, err := namespaced(others[i].GroupVersionKind())
+		if err != nil {
+			return nil, err
+		}
+		if isNamespaced && others[i].GetNamespace() == "" {
+			others[i].SetNamespace(installNamespace)
+		}
+		if others[i].GetKind() == "ServiceAccount" {
+			existing.Insert(others[i].GetName())
+		}
+	}
+
+	strategy := csv.Spec.InstallStrategy.StrategySpec
+	serviceAccounts := sets.NewString()
+	for _, p := range strategy.Permissions {
+		serviceAccounts.Insert(p.ServiceAccountName)
+		objs = append(objs, roleFor(csv.Name, installNamespace, p)...)
+	}
+	for _, p := range strategy.ClusterPermissions {
+		serviceAccounts.Insert(p.ServiceAccountName)
+		objs = append(objs, clusterRoleFor(csv.Name, installNamespace, p)...)
+	}
+	for _, d := range strategy.DeploymentSpecs {
+		serviceAccounts.Insert(d.Spec.Template.Spec.ServiceAccountName)
+		dep := &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: d.Name, Namespace: installNamespace, Labels: d.Label},
+			Spec:       *d.Spec.DeepCopy(),
+		}
+		if dep.Spec.Template.Annotations == nil {
+			dep.Spec.Template.Annotations = make(map[string]string)
+		}
+		dep.Spec.Template.Annotations[targetNamespacesAnnotation] = ""
+		objs = append(objs, dep)
+	}
+	for _, sa := range serviceAccounts.Difference(existing).Delete("", "default").List() {
+		objs = append(objs, &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: sa, Namespace: installNamespace}})
+	}
+
+	rendered := make([]unstructured.Unstructured, 0, len(objs)+len(others))
+	for _, obj := range objs {
+		u, err := toUnstructured(obj)
+		if err != nil {
+			return nil, err
+		}
+		rendered = append(rendered, u)
+	}
+	return append(rendered, others...), nil
+}
+
+// parseRegistryV1 returns the ClusterServiceVersion of a registry+v1 bundle,
+// along with its other manifests.
+func parseRegistryV1(manifests []unstructured.Unstructured) (*operatorsv1alpha1.ClusterServiceVersion, []unstructured.Unstructured, error) {
+	var (
+		csv    *operatorsv1alpha1.ClusterServiceVersion
+		others []unstructured.Unstructured
+	)
+	for _, m := range manifests {
+		if m.GroupVersionKind().GroupKind() != operatorsv1alpha1.SchemeGroupVersion.WithKind(operatorsv1alpha1.ClusterServiceVersionKind).GroupKind() {
+			others = append(others, *m.DeepCopy())
+			continue
+		}
+		if csv != nil {
+			return nil, nil, util.NewPermanentError(fmt.Errorf("registry+v1 bundles must contain exactly one ClusterServiceVersion, found %s and %s", csv.Name, m.GetName()))
+		}
+		csv = &operatorsv1alpha1.ClusterServiceVersion{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(m.Object, csv); err != nil {
+			return nil, nil, util.NewPermanentError(fmt.Errorf("failed to parse the %s ClusterServiceVersion: %w", m.GetName(), err))
+		}
+	}
+	if csv == nil {
+		return nil, nil, util.NewPermanentError(fmt.Errorf("registry+v1 bundles must contain a ClusterServiceVersion"))
+	}
+	if len(csv.Spec.WebhookDefinitions) != 0 || len(csv.Spec.APIServiceDefinitions.Owned) != 0 {
+		return nil, nil, util.NewPermanentError(fmt.Errorf("the %s ClusterServiceVersion declares webhooks or API services, which aren't supported", csv.Name))
+	}
+	return csv, others, nil
+}
+
+// registryV1InstallNamespace returns the namespace a registry+v1 bundle's
+// operator is installed in.
+func registryV1InstallNamespace(csv *operatorsv1alpha1.ClusterServiceVersion, packageName string) string {
+	if ns := csv.Annotations[suggestedNamespaceAnnotation]; ns != "" {
+		return ns
+	}
+	return packageName + "-system"
+}
+
+// renderRukpakRegistryV1 renders a registry+v1 bundle the way rukpak's registry
+// provisioner converts it, as of rukpak v0.7.0, so the objects rukpak installed
+// can be compared with it. Unlike renderRegistryV1, the target namespaces are
+// annotated on the deployments themselves, alongside the ClusterServiceVersion's
+// annotations, and the other manifests are left in the namespace they declare,
+// if any, as rukpak installs the ones that don't declare one in the namespace of
+// its helm releases. The RBAC rukpak generates is named after a hash of the
+// permissions, so it isn't rendered.
+func renderRukpakRegistryV1(manifests []unstructured.Unstructured, packageName string) ([]unstructured.Unstructured, error) {
+	csv, others, err := parseRegistryV1(manifests)
+	if err != nil {
+		return nil, err
+	}
+	installNamespace := registryV1InstallNamespace(csv, packageName)
+
+	// Rukpak installs operators in AllNamespaces mode when it's supported, and
+	// in OwnNamespace mode otherwise.
+	supported := sets.NewString()
+	for _, mode := range csv.Spec.InstallModes {
+		if mode.Supported {
+			supported.Insert(string(mode.Type))
+		}
+	}
+	targetNamespaces := ""
+	if !supported.Has(string(operatorsv1alpha1.InstallModeTypeAllNamespaces)) && supported.Has(string(operatorsv1alpha1.InstallModeTypeOwnNamespace)) {
+		targetNamespaces = installNamespace
+	}
+
+	objs := []runtime.Object{
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: installNamespace}},
+	}
+	strategy := csv.Spec.InstallStrategy.StrategySpec
+	serviceAccounts := sets.NewString()
+	for _, d := range strategy.DeploymentSpecs {
+		serviceAccounts.Insert(d.Spec.Template.Spec.ServiceAccountName)
+		annotations := make(map[string]string, len(csv.Annotations)+len(d.Spec.Template.Annotations)+1)
+		for _, m := range []map[string]string{csv.Annotations, d.Spec.Template.Annotations} {
+			for k, v := range m {
+				annotations[k] = v
+			}
+		}
+		annotations[targetNamespacesAnnotation] = targetNamespaces
+		objs = append(objs, &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: d.Name, Namespace: installNamespace, Labels: d.Label, Annotations: annotations},
+			Spec:       *d.Spec.DeepCopy(),
+		})
+	}
+	for _, p := range append(strategy.Permissions, strategy.ClusterPermissions...) {
+		serviceAccounts.Insert(p.ServiceAccountName)
+	}
+	for _, sa := range serviceAccounts.Delete("", "default").List() {
+		objs = append(objs, &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: sa, Namespace: installNamespace}})
+	}
+
+	rendered := make([]unstructured.Unstructured, 0, len(objs)+len(others))
+	for _, obj := range objs {
+		u, err := toUnstructured(obj)
+		if err != nil {
+			return nil, err
+		}
+		rendered = append(rendered, u)
+	}
+	return append(rendered, others...), nil
+}
+
+func roleFor(csvName, namespace string, p operatorsv1alpha1.StrategyDeploymentPermissions) []runtime.Object {
+	name := csvName + "-" + p.ServiceAccountName
+	return []runtime.Object{
+		&rbacv1.Role{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Rules:      p.Rules,
+		},
+		&rbacv1.RoleBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "Role", Name: name},
+			Subjects:   []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: p.ServiceAccountName, Namespace: namespace}},
+		},
+	}
+}
+
+func clusterRoleFor(csvName, namespace string, p operatorsv1alpha1.StrategyDeploymentPermissions) []runtime.Object {
+	name := csvName + "-" + p.ServiceAccountName
+	return []runtime.Object{
+		&rbacv1.ClusterRole{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Rules:      p.Rules,
+		},
+		&rbacv1.ClusterRoleBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: name},
+			Subjects:   []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: p.ServiceAccountName, Namespace: namespace}},
+		},
+	}
+}
+
+// toUnstructured converts a typed object to an unstructured one, filling in the
+// apiVersion and kind that typed objects leave empty.
+func toUnstructured(obj runtime.Object) (unstructured.Unstructured, error) {
+	var gvk schema.GroupVersionKind
+	switch obj.(type) {
+	case *corev1.Namespace:
+		gvk = corev1.SchemeGroupVersion.WithKind("Namespace")
+	case *corev1.ServiceAccount:
+		gvk = corev1.SchemeGroupVersion.WithKind("ServiceAccount")
+	case *rbacv1.Role:
+		gvk = rbacv1.SchemeGroupVersion.WithKind("Role")
+	case *rbacv1.RoleBinding:
+		gvk = rbacv1.SchemeGroupVersion.WithKind("RoleBinding")
+	case *rbacv1.ClusterRole:
+		gvk = rbacv1.SchemeGroupVersion.WithKind("ClusterRole")
+	case *rbacv1.ClusterRoleBinding:
+		gvk = rbacv1.SchemeGroupVersion.WithKind("ClusterRoleBinding")
+	case *appsv1.Deployment:
+		gvk = appsv1.SchemeGroupVersion.WithKind("Deployment")
+	default:
+		return unstructured.Unstructured{}, fmt.Errorf("unexpected rendered object %T", obj)
+	}
+	data, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return unstructured.Unstructured{}, err
+	}
+	u := unstructured.Unstructured{Object: data}
+	u.SetGroupVersionKind(gvk)
+	// Typed objects serialize an empty creationTimestamp and status, which
+	// shouldn't be part of the applied configuration.
+	unstructured.RemoveNestedField(u.Object, "metadata", "creationTimestamp")
+	unstructured.RemoveNestedField(u.Object, "spec", "template", "metadata", "creationTimestamp")
+	unstructured.RemoveNestedField(u.Object, "status")
+	return u, nil
+}
@@ -0,0 +1,278 @@
+package applier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	structuralschema "k8s.io/apiextensions-apiserver/pkg/apiserver/schema"
+	"k8s.io/apiextensions-apiserver/pkg/apiserver/schema/defaulting"
+	"k8s.io/apiextensions-apiserver/pkg/apiserver/validation"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ErrUpgradeBlocked is returned by Apply when the bundle changes its CRDs in a way
+// that would break the custom resources that already exist on the cluster.
+var ErrUpgradeBlocked = errors.New("the upgrade would break existing custom resources")
+
+// ErrUpgradeUnverified is returned by Apply once the bundle is applied, when the
+// existing custom resources of its CRDs couldn't be checked against their new
+// schemas because the manager isn't allowed to list them. Listing is only granted
+// for the kinds the manager itself reads, as granting it for every kind would
+// include secrets, so the upgrade isn't blocked and its safety is left unknown.
+var ErrUpgradeUnverified = errors.New("the existing custom resources couldn't be checked against the new CRD schemas")
+
+// maxReportedResources caps the number of invalid custom resources reported per
+// CRD version, so the condition stays readable on clusters with many of them.
+const maxReportedResources = 5
+
+// checkCRDUpgrades compares the CRDs among the objects with the ones installed on
+// the cluster, and returns an ErrUpgradeBlocked error listing every change that
+// would break the existing custom resources. The existing custom resources are
+// only listed and validated for the versions whose schema changes, so resyncs
+// that re-apply the installed CRDs don't list anything. The custom resources that
+// couldn't be listed are returned as an ErrUpgradeUnverified error, which is only
+// reported once the objects are applied.
+func checkCRDUpgrades(ctx context.Context, c client.Client, objs []unstructured.Unstructured) (unverified error, err error) {
+	var blockers, unlisted []string
+	for i := range objs {
+		obj := &objs[i]
+		if !isCRD(obj.GroupVersionKind()) {
+			continue
+		}
+		installed := &unstructured.Unstructured{}
+		installed.SetGroupVersionKind(obj.GroupVersionKind())
+		if err := c.Get(ctx, client.ObjectKeyFromObject(obj), installed); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to get the %s CustomResourceDefinition: %w", obj.GetName(), err)
+		}
+		old, err := toCRD(installed)
+		if err != nil {
+			return nil, err
+		}
+		desired, err := toCRD(obj)
+		if err != nil {
+			return nil, err
+		}
+		if equality.Semantic.DeepEqual(old.Spec.Versions, desired.Spec.Versions) {
+			// Re-applying the same versions can't break the existing resources,
+			// even ones that are already invalid.
+			continue
+		}
+		b, u, err := crdUpgradeBlockers(ctx, c, old, desired)
+		if err != nil {
+			return nil, err
+		}
+		blockers = append(blockers, b...)
+		unlisted = append(unlisted, u...)
+	}
+	if len(blockers) != 0 {
+		return nil, fmt.Errorf("%w: %s", ErrUpgradeBlocked, strings.Join(blockers, "; "))
+	}
+	if len(unlisted) != 0 {
+		return fmt.Errorf("%w: not allowed to list the existing %s resources", ErrUpgradeUnverified, strings.Join(unlisted, ", ")), nil
+	}
+	return nil, nil
+}
+
+// crdUpgradeBlockers lists the versions the desired CRD stops serving or storing,
+// and the existing custom resources that are invalid against its new schemas,
+// along with the versions whose custom resources aren't allowed to be listed.
+func crdUpgradeBlockers(ctx context.Context, c client.Client, installed, desired *apiextensionsv1.CustomResourceDefinition) (blockers, unlisted []string, err error) {
+	desiredVersions := make(map[string]apiextensionsv1.CustomResourceDefinitionVersion, len(desired.Spec.Versions))
+	for _, v := range desired.Spec.Versions {
+		desiredVersions[v.Name] = v
+	}
+
+	stored := make(map[string]bool, len(installed.Status.StoredVersions))
+	for _, name := range installed.Status.StoredVersions {
+		stored[name] = true
+		if _, ok := desiredVersions[name]; !ok {
+			blockers = append(blockers, fmt.Sprintf("%s removes the %s version that existing resources are stored in", desired.Name, name))
+		}
+	}
+	for _, old := range installed.Spec.Versions {
+		if !old.Served || stored[old.Name] {
+			continue
+		}
+		if v, ok := desiredVersions[old.Name]; !ok {
+			blockers = append(blockers, fmt.Sprintf("%s removes the served %s version", desired.Name, old.Name))
+		} else if !v.Served {
+			blockers = append(blockers, fmt.Sprintf("%s stops serving the %s version", desired.Name, old.Name))
+		}
+	}
+
+	for _, old := range installed.Spec.Versions {
+		v, ok := desiredVersions[old.Name]
+		if !ok || !old.Served || !v.Served || !versionChanged(old, v) {
+			continue
+		}
+		invalid, err := invalidResources(ctx, c, desired, old, v)
+		if apierrors.IsForbidden(err) {
+			unlisted = append(unlisted, fmt.Sprintf("%s/%s %s", desired.Spec.Group, v.Name, desired.Spec.Names.Kind))
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		blockers = append(blockers, invalid...)
+	}
+	return blockers, unlisted, nil
+}
+
+// versionChanged reports whether the desired version changes the schema the
+// existing resources are validated against, or whether it's served or stored.
+func versionChanged(installed, desired apiextensionsv1.CustomResourceDefinitionVersion) bool {
+	return installed.Served != desired.Served ||
+		installed.Storage != desired.Storage ||
+		!equality.Semantic.DeepEqual(versionSchema(installed), versionSchema(desired))
+}
+
+// invalidResources validates the existing custom resources served at the version
+// against its desired schema, after applying the schema's defaults as the API
+// server would. Properties the new schema requires are reported on their own, as
+// they're the most common reason existing resources become invalid.
+func invalidResources(ctx context.Context, c client.Client, crd *apiextensionsv1.CustomResourceDefinition, installed, desired apiextensionsv1.CustomResourceDefinitionVersion) ([]string, error) {
+	newlyRequired := requiredPaths(versionSchema(installed), versionSchema(desired))
+	validator, structural, err := newValidator(desired)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the %s schema of the %s CustomResourceDefinition: %w", desired.Name, crd.Name, err)
+	}
+	if validator == nil {
+		return nil, nil
+	}
+
+	list := &unstructured.UnstructuredList{}
+	list.SetAPIVersion(crd.Spec.Group + "/" + desired.Name)
+	list.SetKind(crd.Spec.Names.Kind + "List")
+	if err := c.List(ctx, list); err != nil {
+		return nil, fmt.Errorf("failed to list the existing %s resources: %w", crd.Spec.Names.Kind, err)
+	}
+
+	var (
+		blockers []string
+		skipped  int
+	)
+	for _, cr := range list.Items {
+		content := runtime.DeepCopyJSON(cr.UnstructuredContent())
+		if structural != nil {
+			defaulting.Default(content, structural)
+		}
+		var problems []string
+		for _, path := range newlyRequired {
+			if lacks(content, strings.Split(path, ".")) {
+				problems = append(problems, fmt.Sprintf("doesn't set %s, which is now required", path))
+			}
+		}
+		// The missing properties would be reported by the validator again.
+		if len(problems) == 0 {
+			for _, err := range validator(content) {
+				problems = append(problems, err.Error())
+			}
+		}
+		if len(problems) == 0 {
+			continue
+		}
+		if len(blockers) == maxReportedResources {
+			skipped++
+			continue
+		}
+		blockers = append(blockers, fmt.Sprintf("%s %s is invalid against the new %s schema: %s",
+			crd.Spec.Names.Kind, client.ObjectKeyFromObject(&cr), desired.Name, strings.Join(problems, ", ")))
+	}
+	if skipped > 0 {
+		blockers = append(blockers, fmt.Sprintf("%d more %s resources are invalid against the new %s schema", skipped, crd.Spec.Names.Kind, desired.Name))
+	}
+	return blockers, nil
+}
+
+// requiredPaths returns the paths of the properties the desired schema requires
+// that the installed schema didn't.
+func requiredPaths(installed, desired *apiextensionsv1.JSONSchemaProps) []string {
+	var (
+		paths    []string
+		oldProps = schemaProperties(installed)
+		newProps = schemaProperties(desired)
+	)
+	for _, path := range sortedPaths(newProps) {
+		if newProps[path].Required && !oldProps[path].Required {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// lacks reports whether the object is missing the property at the path, while
+// setting its parent. Array items, denoted by "[*]", are each checked in turn.
+func lacks(value interface{}, path []string) bool {
+	segment := path[0]
+	name := strings.ReplaceAll(segment, "[*]", "")
+	depth := strings.Count(segment, "[*]")
+
+	obj, ok := value.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	child, ok := obj[name]
+	if !ok {
+		return len(path) == 1
+	}
+	if len(path) == 1 {
+		return false
+	}
+	return lacksInItems(child, depth, path[1:])
+}
+
+func lacksInItems(value interface{}, depth int, path []string) bool {
+	if depth == 0 {
+		return lacks(value, path)
+	}
+	items, ok := value.([]interface{})
+	if !ok {
+		return false
+	}
+	for _, item := range items {
+		if lacksInItems(item, depth-1, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateFunc validates a custom resource against a schema.
+type validateFunc func(content map[string]interface{}) field.ErrorList
+
+// newValidator returns a validator for the version's schema, along with its
+// structural form for defaulting when the schema is structural. No validator is
+// returned when the version has no schema.
+func newValidator(v apiextensionsv1.CustomResourceDefinitionVersion) (validateFunc, *structuralschema.Structural, error) {
+	if v.Schema == nil || v.Schema.OpenAPIV3Schema == nil {
+		return nil, nil, nil
+	}
+	internal := &apiextensions.CustomResourceValidation{}
+	if err := apiextensionsv1.Convert_v1_CustomResourceValidation_To_apiextensions_CustomResourceValidation(v.Schema, internal, nil); err != nil {
+		return nil, nil, err
+	}
+	validator, _, err := validation.NewSchemaValidator(internal)
+	if err != nil {
+		return nil, nil, err
+	}
+	validate := func(content map[string]interface{}) field.ErrorList {
+		return validation.ValidateCustomResource(nil, content, validator)
+	}
+	structural, err := structuralschema.NewStructural(internal.OpenAPIV3Schema)
+	if err != nil {
+		return validate, nil, nil
+	}
+	return validate, structural, nil
+}
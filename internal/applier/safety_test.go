@@ -0,0 +1,243 @@
+package applier
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/yaml"
+)
+
+const installedCRD = `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: combos.example.com
+spec:
+  group: example.com
+  names:
+    kind: Combo
+    plural: combos
+  scope: Namespaced
+  versions:
+  - name: v1alpha1
+    served: true
+    storage: false
+  - name: v1
+    served: true
+    storage: true
+    schema:
+      openAPIV3Schema:
+        type: object
+        properties:
+          spec:
+            type: object
+            properties:
+              size:
+                type: integer
+              mode:
+                type: string
+status:
+  storedVersions: [v1]
+`
+
+func TestCheckCRDUpgrades(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		desired string
+		crs     []string
+		want    []string
+	}{
+		{
+			name:    "unchanged",
+			desired: installedCRD,
+			crs:     []string{testCombo("a", "size: 1")},
+		},
+		{
+			name: "unchanged with resources that are already invalid",
+			desired: `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: combos.example.com
+spec:
+  group: example.com
+  names:
+    kind: Combo
+    plural: combos
+  scope: Namespaced
+  versions:
+  - name: v1alpha1
+    served: true
+    storage: false
+  - name: v1
+    served: true
+    storage: true
+    additionalPrinterColumns:
+    - name: Size
+      type: integer
+      jsonPath: .spec.size
+    schema:
+      openAPIV3Schema:
+        type: object
+        properties:
+          spec:
+            type: object
+            properties:
+              size:
+                type: integer
+              mode:
+                type: string
+`,
+			crs: []string{testCombo("a", "size: fast")},
+		},
+		{
+			name: "removed served and stored versions",
+			desired: `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: combos.example.com
+spec:
+  group: example.com
+  names:
+    kind: Combo
+    plural: combos
+  scope: Namespaced
+  versions:
+  - name: v2
+    served: true
+    storage: true
+`,
+			want: []string{
+				"combos.example.com removes the v1 version that existing resources are stored in",
+				"combos.example.com removes the served v1alpha1 version",
+			},
+		},
+		{
+			name: "version no longer served",
+			desired: strings.Replace(installedCRD, `  - name: v1alpha1
+    served: true`, `  - name: v1alpha1
+    served: false`, 1),
+			want: []string{"combos.example.com stops serving the v1alpha1 version"},
+		},
+		{
+			name:    "new required property",
+			desired: strings.Replace(installedCRD, "            properties:\n", "            required: [size]\n            properties:\n", 1),
+			crs:     []string{testCombo("a", "size: 1"), testCombo("b", "mode: fast")},
+			want:    []string{"Combo default/b is invalid against the new v1 schema: doesn't set spec.size, which is now required"},
+		},
+		{
+			name: "new required property with a default",
+			desired: strings.Replace(installedCRD, "              size:\n                type: integer\n",
+				"              size:\n                type: integer\n                default: 1\n", 1),
+			crs: []string{testCombo("b", "mode: fast")},
+		},
+		{
+			name:    "existing resources failing validation",
+			desired: strings.Replace(installedCRD, "              mode:\n                type: string\n", "              mode:\n                type: string\n                enum: [slow]\n", 1),
+			crs:     []string{testCombo("a", "mode: fast")},
+			want:    []string{`Combo default/a is invalid against the new v1 schema: spec.mode: Unsupported value: "fast": supported values: "slow"`},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			objs := []client.Object{parseObject(t, installedCRD)}
+			for _, cr := range tt.crs {
+				objs = append(objs, parseObject(t, cr))
+			}
+			mapper := meta.NewDefaultRESTMapper(nil)
+			mapper.Add(schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Combo"}, meta.RESTScopeNamespace)
+			c := fake.NewClientBuilder().WithScheme(runtime.NewScheme()).WithRESTMapper(mapper).WithObjects(objs...).Build()
+
+			unverified, err := checkCRDUpgrades(context.Background(), c, []unstructured.Unstructured{*parseObject(t, tt.desired)})
+			if unverified != nil {
+				t.Errorf("expected the existing resources to be checked, got %v", unverified)
+			}
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrUpgradeBlocked) {
+				t.Fatalf("expected the upgrade to be blocked, got %v", err)
+			}
+			if want := ErrUpgradeBlocked.Error() + ": " + strings.Join(tt.want, "; "); err.Error() != want {
+				t.Errorf("expected %q, got %q", want, err.Error())
+			}
+		})
+	}
+}
+
+func TestCheckCRDUpgradesWithoutInstalledCRD(t *testing.T) {
+	c := fake.NewClientBuilder().WithScheme(runtime.NewScheme()).Build()
+	if unverified, err := checkCRDUpgrades(context.Background(), c, []unstructured.Unstructured{*parseObject(t, testCRD)}); unverified != nil || err != nil {
+		t.Errorf("unexpected error: %v", utilerrors.NewAggregate([]error{unverified, err}))
+	}
+}
+
+// forbiddenLister fails to list any resources, as the manager isn't allowed to
+// list custom resources.
+type forbiddenLister struct {
+	client.Client
+}
+
+func (forbiddenLister) List(_ context.Context, list client.ObjectList, _ ...client.ListOption) error {
+	gvk := list.GetObjectKind().GroupVersionKind()
+	return apierrors.NewForbidden(schema.GroupResource{Group: gvk.Group, Resource: "combos"}, "", errors.New("not allowed"))
+}
+
+func TestCheckCRDUpgradesForbidden(t *testing.T) {
+	c := forbiddenLister{Client: fake.NewClientBuilder().WithScheme(runtime.NewScheme()).WithObjects(parseObject(t, installedCRD)).Build()}
+	desired := strings.Replace(installedCRD, "            properties:\n              size:", "            required: [size]\n            properties:\n              size:", 1)
+
+	unverified, err := checkCRDUpgrades(context.Background(), c, []unstructured.Unstructured{*parseObject(t, desired)})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !errors.Is(unverified, ErrUpgradeUnverified) {
+		t.Fatalf("expected the upgrade to be left unverified, got %v", unverified)
+	}
+	if want := ErrUpgradeUnverified.Error() + ": not allowed to list the existing example.com/v1 Combo resources"; unverified.Error() != want {
+		t.Errorf("expected %q, got %q", want, unverified.Error())
+	}
+
+	// Resyncs that don't change the schemas don't need to list the resources.
+	unverified, err = checkCRDUpgrades(context.Background(), c, []unstructured.Unstructured{*parseObject(t, installedCRD)})
+	if unverified != nil || err != nil {
+		t.Errorf("expected the unchanged CRD to pass without listing its resources, got %v, %v", unverified, err)
+	}
+
+	// Blocking changes that don't depend on the existing resources are still reported.
+	removed := strings.Replace(installedCRD, "  - name: v1alpha1\n    served: true\n    storage: false\n", "", 1)
+	if _, err := checkCRDUpgrades(context.Background(), c, []unstructured.Unstructured{*parseObject(t, removed)}); !errors.Is(err, ErrUpgradeBlocked) {
+		t.Errorf("expected the upgrade to be blocked, got %v", err)
+	}
+}
+
+func testCombo(name, spec string) string {
+	return `apiVersion: example.com/v1
+kind: Combo
+metadata:
+  name: ` + name + `
+  namespace: default
+spec:
+  ` + spec + `
+`
+}
+
+func parseObject(t *testing.T, manifest string) *unstructured.Unstructured {
+	t.Helper()
+
+	obj := &unstructured.Unstructured{}
+	if err := yaml.Unmarshal([]byte(manifest), &obj.Object); err != nil {
+		t.Fatal(err)
+	}
+	return obj
+}
@@ -0,0 +1,124 @@
+package applier
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/yaml"
+
+	"github.com/openshift/platform-operators/internal/util"
+)
+
+const (
+	manifestsDir    = "manifests"
+	annotationsFile = "metadata/annotations.yaml"
+)
+
+// bundleContent is the content unpacked from a bundle image.
+type bundleContent struct {
+	// annotations are the bundle's metadata/annotations.yaml annotations, which
+	// only registry+v1 bundles declare.
+	annotations map[string]string
+	// manifests are the objects found in the bundle's manifests directory, in
+	// the order of their file names.
+	manifests []unstructured.Unstructured
+}
+
+// unpack pulls the bundle image and reads its manifests and annotations out of
+// the flattened image filesystem.
+func unpack(ctx context.Context, image string, opts []remote.Option) (*bundleContent, error) {
+	ref, err := name.ParseReference(image)
+	if err != nil {
+		return nil, util.NewPermanentError(err)
+	}
+	img, err := remote.Image(ref, append([]remote.Option{remote.WithContext(ctx)}, opts...)...)
+	if err != nil {
+		return nil, err
+	}
+	rc := mutate.Extract(img)
+	defer rc.Close()
+
+	files := make(map[string][]byte)
+	tr := tar.NewReader(rc)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		entry := strings.TrimPrefix(path.Clean("/"+hdr.Name), "/")
+		if hdr.Typeflag != tar.TypeReg || (path.Dir(entry) != manifestsDir && entry != annotationsFile) {
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		files[entry] = data
+	}
+
+	content := &bundleContent{}
+	if data, ok := files[annotationsFile]; ok {
+		var metadata struct {
+			Annotations map[string]string `json:"annotations"`
+		}
+		if err := yaml.Unmarshal(data, &metadata); err != nil {
+			return nil, util.NewPermanentError(fmt.Errorf("failed to parse the %s bundle's %s: %w", image, annotationsFile, err))
+		}
+		content.annotations = metadata.Annotations
+		delete(files, annotationsFile)
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		objs, err := decodeManifests(files[name])
+		if err != nil {
+			return nil, util.NewPermanentError(fmt.Errorf("failed to decode the %s bundle's %s manifest: %w", image, name, err))
+		}
+		content.manifests = append(content.manifests, objs...)
+	}
+	if len(content.manifests) == 0 {
+		return nil, util.NewPermanentError(fmt.Errorf("the %s bundle doesn't contain any manifests in the /%s directory", image, manifestsDir))
+	}
+	return content, nil
+}
+
+// decodeManifests decodes every object in a YAML or JSON stream.
+func decodeManifests(data []byte) ([]unstructured.Unstructured, error) {
+	var objs []unstructured.Unstructured
+	dec := utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), 4096)
+	for {
+		var obj unstructured.Unstructured
+		if err := dec.Decode(&obj.Object); err != nil {
+			if errors.Is(err, io.EOF) {
+				return objs, nil
+			}
+			return nil, err
+		}
+		if len(obj.Object) == 0 {
+			continue
+		}
+		if obj.GetKind() == "" || obj.GetAPIVersion() == "" {
+			return nil, fmt.Errorf("object %q is missing its apiVersion or kind", obj.GetName())
+		}
+		objs = append(objs, obj)
+	}
+}
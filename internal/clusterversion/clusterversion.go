@@ -0,0 +1,103 @@
+package clusterversion
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/blang/semver/v4"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/version"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var (
+	// ClusterVersionGVK is the GVK of the OpenShift ClusterVersion API.
+	ClusterVersionGVK = schema.GroupVersionKind{Group: "config.openshift.io", Version: "v1", Kind: "ClusterVersion"}
+)
+
+const (
+	// clusterVersionName is the name of the singleton ClusterVersion.
+	clusterVersionName = "version"
+)
+
+// Versions are the versions of the running cluster.
+type Versions struct {
+	// OpenShift is the version of OpenShift the cluster runs, or nil when the
+	// cluster isn't an OpenShift cluster.
+	OpenShift *semver.Version
+	// Kube is the version of Kubernetes the API server runs.
+	Kube semver.Version
+}
+
+// Getter returns the versions of the running cluster.
+type Getter interface {
+	Get(context.Context) (*Versions, error)
+}
+
+// ServerVersioner discovers the version of the API server.
+type ServerVersioner interface {
+	ServerVersion() (*version.Info, error)
+}
+
+type getter struct {
+	reader    client.Reader
+	discovery ServerVersioner
+}
+
+// NewGetter returns a Getter that reads the OpenShift version from the cluster's
+// ClusterVersion, and the Kubernetes version from the discovered server version.
+// The ClusterVersion is read every time the versions are, so c should be a cache,
+// which unlike the manager's client also caches unstructured objects.
+func NewGetter(c client.Reader, discovery ServerVersioner) Getter {
+	return &getter{
+		reader:    c,
+		discovery: discovery,
+	}
+}
+
+func (g getter) Get(ctx context.Context) (*Versions, error) {
+	info, err := g.discovery.ServerVersion()
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover the server version: %w", err)
+	}
+	kube, err := semver.ParseTolerant(info.GitVersion)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the %q server version: %w", info.GitVersion, err)
+	}
+	openshift, err := g.openShiftVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &Versions{OpenShift: openshift, Kube: kube}, nil
+}
+
+func (g getter) openShiftVersion(ctx context.Context) (*semver.Version, error) {
+	cv := &unstructured.Unstructured{}
+	cv.SetGroupVersionKind(ClusterVersionGVK)
+	if err := g.reader.Get(ctx, types.NamespacedName{Name: clusterVersionName}, cv); err != nil {
+		if meta.IsNoMatchError(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get the cluster version: %w", err)
+	}
+	desired, _, err := unstructured.NestedString(cv.Object, "status", "desired", "version")
+	if err != nil || desired == "" {
+		return nil, fmt.Errorf("failed to determine the desired version from the cluster version status")
+	}
+	v, err := semver.ParseTolerant(desired)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the %q cluster version: %w", desired, err)
+	}
+	return &v, nil
+}
+
+// Static is a Getter that returns fixed versions.
+type Static Versions
+
+func (s Static) Get(context.Context) (*Versions, error) {
+	v := Versions(s)
+	return &v, nil
+}
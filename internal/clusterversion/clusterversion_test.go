@@ -0,0 +1,39 @@
+package clusterversion
+
+import (
+	"context"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/version"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+type staticServerVersion string
+
+func (s staticServerVersion) ServerVersion() (*version.Info, error) {
+	return &version.Info{GitVersion: string(s)}, nil
+}
+
+func TestGetter(t *testing.T) {
+	cv := &unstructured.Unstructured{Object: map[string]interface{}{
+		"status": map[string]interface{}{
+			"desired": map[string]interface{}{"version": "4.12.3"},
+		},
+	}}
+	cv.SetGroupVersionKind(ClusterVersionGVK)
+	cv.SetName("version")
+
+	c := fake.NewClientBuilder().WithScheme(runtime.NewScheme()).WithObjects(cv).Build()
+	versions, err := NewGetter(c, staticServerVersion("v1.25.4+a34b9e9")).Get(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if versions.OpenShift == nil || versions.OpenShift.String() != "4.12.3" {
+		t.Errorf("unexpected OpenShift version %v", versions.OpenShift)
+	}
+	if versions.Kube.Major != 1 || versions.Kube.Minor != 25 || versions.Kube.Patch != 4 {
+		t.Errorf("unexpected Kubernetes version %v", versions.Kube)
+	}
+}
@@ -0,0 +1,286 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/operator-framework/operator-registry/alpha/property"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	platformv1alpha1 "github.com/openshift/platform-operators/api/v1alpha1"
+	"github.com/openshift/platform-operators/internal/sourcer"
+	"github.com/openshift/platform-operators/internal/util"
+)
+
+const (
+	// TypeHealthProbe is the olm.bundle property declaring an additional object
+	// whose status condition determines whether the bundle's operator is healthy.
+	TypeHealthProbe = "platform.openshift.io/health-probe"
+
+	// The labels rukpak sets on the objects it applies for a BundleDeployment.
+	ownerKindLabel = "core.rukpak.io/owner-kind"
+	ownerNameLabel = "core.rukpak.io/owner-name"
+)
+
+// Probe evaluates the health of an individual object, returning a message that
+// explains why the object is unhealthy.
+type Probe interface {
+	Probe(ctx context.Context, obj *unstructured.Unstructured) (healthy bool, message string, err error)
+}
+
+// ProbeFunc adapts a function to a Probe.
+type ProbeFunc func(ctx context.Context, obj *unstructured.Unstructured) (bool, string, error)
+
+func (f ProbeFunc) Probe(ctx context.Context, obj *unstructured.Unstructured) (bool, string, error) {
+	return f(ctx, obj)
+}
+
+// Report is the outcome of evaluating the health of a PlatformOperator.
+type Report struct {
+	// Evaluated is the number of objects whose health was evaluated.
+	Evaluated int
+	// Unhealthy describes each object that isn't healthy.
+	Unhealthy []string
+	// Skipped describes each health probe object that the manager isn't allowed
+	// to read, and whose health is left unknown.
+	Skipped []string
+}
+
+// Evaluator evaluates the health of the objects installed for a PlatformOperator.
+type Evaluator interface {
+	Evaluate(ctx context.Context, po *platformv1alpha1.PlatformOperator, b *sourcer.Bundle) (*Report, error)
+}
+
+type evaluator struct {
+	client.Client
+	probes map[schema.GroupKind]registeredProbe
+}
+
+type registeredProbe struct {
+	version string
+	probe   Probe
+}
+
+// Option configures an Evaluator.
+type Option func(*evaluator)
+
+// WithProbe evaluates the objects of the kind with the probe, replacing any probe
+// already registered for the kind. Objects are discovered at the given version.
+func WithProbe(gvk schema.GroupVersionKind, p Probe) Option {
+	return func(e *evaluator) {
+		e.probes[gvk.GroupKind()] = registeredProbe{version: gvk.Version, probe: p}
+	}
+}
+
+// NewEvaluator returns an Evaluator that discovers the Deployments, DaemonSets,
+// APIServices and webhook configurations installed for a PlatformOperator and
+// evaluates their health, along with the objects declared by the bundle's
+// health probe properties.
+func NewEvaluator(c client.Client, opts ...Option) Evaluator {
+	e := &evaluator{
+		Client: c,
+		probes: map[schema.GroupKind]registeredProbe{
+			deploymentGVK.GroupKind():        {version: deploymentGVK.Version, probe: ProbeFunc(probeDeployment)},
+			daemonSetGVK.GroupKind():         {version: daemonSetGVK.Version, probe: ProbeFunc(probeDaemonSet)},
+			apiServiceGVK.GroupKind():        {version: apiServiceGVK.Version, probe: ProbeFunc(probeAPIService)},
+			validatingWebhookGVK.GroupKind(): {version: validatingWebhookGVK.Version, probe: webhookProbe{c}},
+			mutatingWebhookGVK.GroupKind():   {version: mutatingWebhookGVK.Version, probe: webhookProbe{c}},
+		},
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+func (e *evaluator) Evaluate(ctx context.Context, po *platformv1alpha1.PlatformOperator, b *sourcer.Bundle) (*Report, error) {
+	custom, err := customProbes(b.Properties)
+	if err != nil {
+		return nil, err
+	}
+	objs, missing, err := e.discover(ctx, po)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{Evaluated: len(missing)}
+	for _, m := range missing {
+		report.Unhealthy = append(report.Unhealthy, m+": not found")
+	}
+	for i := range objs {
+		obj := &objs[i]
+		p, ok := e.probes[obj.GroupVersionKind().GroupKind()]
+		if !ok {
+			continue
+		}
+		if err := e.probe(ctx, report, obj, p.probe); err != nil {
+			return nil, err
+		}
+	}
+	for _, cp := range custom {
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(cp.gvk())
+		if err := e.Get(ctx, client.ObjectKey{Namespace: cp.Namespace, Name: cp.Name}, obj); err != nil {
+			// Bundles can declare probes for any kind, including ones the manager
+			// isn't allowed to read or that the cluster doesn't serve.
+			key := objectKey(cp.Namespace, cp.Name)
+			switch {
+			case apierrors.IsNotFound(err):
+				report.Evaluated++
+				report.Unhealthy = append(report.Unhealthy, fmt.Sprintf("%s %s: not found", cp.Kind, key))
+			case meta.IsNoMatchError(err):
+				report.Evaluated++
+				report.Unhealthy = append(report.Unhealthy, fmt.Sprintf("%s %s: the %s API isn't served", cp.Kind, key, cp.gvk().GroupVersion()))
+			case apierrors.IsForbidden(err):
+				report.Skipped = append(report.Skipped, fmt.Sprintf("%s %s: not allowed to get it", cp.Kind, key))
+			default:
+				return nil, fmt.Errorf("failed to get the %s %s health probe object: %w", cp.Kind, cp.Name, err)
+			}
+			continue
+		}
+		if err := e.probe(ctx, report, obj, cp); err != nil {
+			return nil, err
+		}
+	}
+	return report, nil
+}
+
+func (e *evaluator) probe(ctx context.Context, report *Report, obj *unstructured.Unstructured, p Probe) error {
+	healthy, message, err := p.Probe(ctx, obj)
+	if err != nil {
+		return fmt.Errorf("failed to evaluate the health of %s %s: %w", obj.GetKind(), objectKey(obj.GetNamespace(), obj.GetName()), err)
+	}
+	report.Evaluated++
+	if !healthy {
+		report.Unhealthy = append(report.Unhealthy, fmt.Sprintf("%s %s: %s", obj.GetKind(), objectKey(obj.GetNamespace(), obj.GetName()), message))
+	}
+	return nil
+}
+
+// discover returns the objects installed for the PlatformOperator whose health
+// can be evaluated, along with the recorded objects that no longer exist. The
+// objects applied directly are recorded in status, while the ones applied by
+// rukpak are labelled with their BundleDeployment, which includes the ones that
+// are being retired while their objects are handed over to the current one.
+func (e *evaluator) discover(ctx context.Context, po *platformv1alpha1.PlatformOperator) ([]unstructured.Unstructured, []string, error) {
+	var (
+		objs    []unstructured.Unstructured
+		missing []string
+	)
+	if len(po.Status.AppliedObjects) != 0 {
+		for _, ref := range po.Status.AppliedObjects {
+			gv, err := schema.ParseGroupVersion(ref.APIVersion)
+			if err != nil {
+				return nil, nil, err
+			}
+			if _, ok := e.probes[gv.WithKind(ref.Kind).GroupKind()]; !ok {
+				continue
+			}
+			obj := unstructured.Unstructured{}
+			obj.SetGroupVersionKind(gv.WithKind(ref.Kind))
+			if err := e.Get(ctx, client.ObjectKey{Namespace: ref.Namespace, Name: ref.Name}, &obj); err != nil {
+				if client.IgnoreNotFound(err) != nil {
+					return nil, nil, fmt.Errorf("failed to get %s %s: %w", ref.Kind, objectKey(ref.Namespace, ref.Name), err)
+				}
+				missing = append(missing, fmt.Sprintf("%s %s", ref.Kind, objectKey(ref.Namespace, ref.Name)))
+				continue
+			}
+			objs = append(objs, obj)
+		}
+		return objs, missing, nil
+	}
+
+	names := sets.NewString(po.Status.BundleDeployments...).Insert(util.BundleDeploymentName(po))
+	owned, err := labels.NewRequirement(ownerNameLabel, selection.In, names.List())
+	if err != nil {
+		return nil, nil, err
+	}
+	selector := labels.SelectorFromSet(labels.Set{ownerKindLabel: "BundleDeployment"}).Add(*owned)
+
+	kinds := make([]schema.GroupKind, 0, len(e.probes))
+	for gk := range e.probes {
+		kinds = append(kinds, gk)
+	}
+	sort.Slice(kinds, func(i, j int) bool { return kinds[i].String() < kinds[j].String() })
+	for _, gk := range kinds {
+		list := &unstructured.UnstructuredList{}
+		list.SetGroupVersionKind(gk.WithVersion(e.probes[gk].version).GroupVersion().WithKind(gk.Kind + "List"))
+		if err := e.List(ctx, list, client.MatchingLabelsSelector{Selector: selector}); err != nil {
+			// The API may not be served by the cluster, e.g. for probes
+			// registered for custom resources.
+			if meta.IsNoMatchError(err) {
+				continue
+			}
+			return nil, nil, fmt.Errorf("failed to list the %s objects installed for the platform operator: %w", gk.Kind, err)
+		}
+		objs = append(objs, list.Items...)
+	}
+	return objs, nil, nil
+}
+
+// conditionProbe is the value of a health probe property. The probed object is
+// healthy when its status condition of the given type has the given status.
+type conditionProbe struct {
+	Group     string `json:"group,omitempty"`
+	Version   string `json:"version"`
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	Condition string `json:"condition"`
+	// Status defaults to True.
+	Status string `json:"status,omitempty"`
+}
+
+func (p conditionProbe) gvk() schema.GroupVersionKind {
+	return schema.GroupVersionKind{Group: p.Group, Version: p.Version, Kind: p.Kind}
+}
+
+func (p conditionProbe) Probe(_ context.Context, obj *unstructured.Unstructured) (bool, string, error) {
+	want := p.Status
+	if want == "" {
+		want = "True"
+	}
+	status, found := conditionStatus(obj, p.Condition)
+	if !found {
+		return false, fmt.Sprintf("the %s condition isn't reported", p.Condition), nil
+	}
+	if status != want {
+		return false, fmt.Sprintf("the %s condition is %s rather than %s", p.Condition, status, want), nil
+	}
+	return true, "", nil
+}
+
+// customProbes parses the health probe properties declared by the bundle.
+func customProbes(props []property.Property) ([]conditionProbe, error) {
+	var probes []conditionProbe
+	for _, p := range props {
+		if p.Type != TypeHealthProbe {
+			continue
+		}
+		var probe conditionProbe
+		if err := json.Unmarshal(p.Value, &probe); err != nil {
+			return nil, fmt.Errorf("invalid %s property: %w", TypeHealthProbe, err)
+		}
+		if probe.Version == "" || probe.Kind == "" || probe.Name == "" || probe.Condition == "" {
+			return nil, fmt.Errorf("invalid %s property %s: version, kind, name and condition are required", TypeHealthProbe, p.Value)
+		}
+		probes = append(probes, probe)
+	}
+	return probes, nil
+}
+
+func objectKey(namespace, name string) string {
+	if namespace == "" {
+		return name
+	}
+	return namespace + "/" + name
+}
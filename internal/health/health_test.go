@@ -0,0 +1,259 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/operator-framework/operator-registry/alpha/property"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	platformv1alpha1 "github.com/openshift/platform-operators/api/v1alpha1"
+	"github.com/openshift/platform-operators/internal/sourcer"
+	"github.com/openshift/platform-operators/internal/util"
+)
+
+var comboGVK = schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Combo"}
+
+func newObject(gvk schema.GroupVersionKind, namespace, name string, content map[string]interface{}) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: content}
+	if obj.Object == nil {
+		obj.Object = make(map[string]interface{})
+	}
+	obj.SetGroupVersionKind(gvk)
+	obj.SetNamespace(namespace)
+	obj.SetName(name)
+	return obj
+}
+
+// installedByRukpak labels the object as applied for the combo platform
+// operator's BundleDeployment.
+func installedByRukpak(obj *unstructured.Unstructured) *unstructured.Unstructured {
+	po := &platformv1alpha1.PlatformOperator{}
+	po.SetName("combo")
+	return installedBy(obj, util.BundleDeploymentName(po))
+}
+
+func installedBy(obj *unstructured.Unstructured, bundleDeployment string) *unstructured.Unstructured {
+	obj.SetLabels(map[string]string{ownerKindLabel: "BundleDeployment", ownerNameLabel: bundleDeployment})
+	return obj
+}
+
+func deployment(name string, replicas, updated int64, available string) *unstructured.Unstructured {
+	return newObject(deploymentGVK, "combo-system", name, map[string]interface{}{
+		"spec": map[string]interface{}{"replicas": replicas},
+		"status": map[string]interface{}{
+			"updatedReplicas":   updated,
+			"availableReplicas": updated,
+			"conditions":        []interface{}{map[string]interface{}{"type": "Available", "status": available}},
+		},
+	})
+}
+
+func newFakeClient(objs ...client.Object) client.Client {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	for _, gvk := range []schema.GroupVersionKind{deploymentGVK, daemonSetGVK, endpointsGVK, comboGVK} {
+		mapper.Add(gvk, meta.RESTScopeNamespace)
+	}
+	for _, gvk := range []schema.GroupVersionKind{apiServiceGVK, validatingWebhookGVK, mutatingWebhookGVK} {
+		mapper.Add(gvk, meta.RESTScopeRoot)
+	}
+	return fake.NewClientBuilder().WithScheme(runtime.NewScheme()).WithRESTMapper(mapper).WithObjects(objs...).Build()
+}
+
+func TestEvaluate(t *testing.T) {
+	webhook := newObject(validatingWebhookGVK, "", "combo-webhook", map[string]interface{}{
+		"webhooks": []interface{}{map[string]interface{}{
+			"name": "combos.example.com",
+			"clientConfig": map[string]interface{}{
+				"service": map[string]interface{}{"namespace": "combo-system", "name": "combo-webhook"},
+			},
+		}},
+	})
+	readyEndpoints := newObject(endpointsGVK, "combo-system", "combo-webhook", map[string]interface{}{
+		"subsets": []interface{}{map[string]interface{}{
+			"addresses": []interface{}{map[string]interface{}{"ip": "10.0.0.1"}},
+		}},
+	})
+	probeProperty := func(condition string) property.Property {
+		value, _ := json.Marshal(map[string]string{
+			"group": "example.com", "version": "v1", "kind": "Combo",
+			"namespace": "combo-system", "name": "cluster", "condition": condition,
+		})
+		return property.Property{Type: TypeHealthProbe, Value: value}
+	}
+	combo := newObject(comboGVK, "combo-system", "cluster", map[string]interface{}{
+		"status": map[string]interface{}{
+			"conditions": []interface{}{map[string]interface{}{"type": "Ready", "status": "True"}},
+		},
+	})
+
+	for _, tt := range []struct {
+		name      string
+		po        *platformv1alpha1.PlatformOperator
+		props     []property.Property
+		objs      []client.Object
+		evaluated int
+		unhealthy []string
+	}{
+		{
+			name: "available workloads installed by rukpak",
+			objs: []client.Object{
+				installedByRukpak(deployment("combo-operator", 1, 1, "True")),
+				installedByRukpak(newObject(daemonSetGVK, "combo-system", "combo-agent", map[string]interface{}{
+					"status": map[string]interface{}{"desiredNumberScheduled": int64(3), "updatedNumberScheduled": int64(3), "numberAvailable": int64(3)},
+				})),
+				installedByRukpak(webhook), readyEndpoints,
+				// Workloads that weren't installed for the platform operator are ignored.
+				deployment("unrelated", 1, 0, "False"),
+			},
+			evaluated: 3,
+		},
+		{
+			name: "unavailable workloads installed by rukpak",
+			objs: []client.Object{
+				installedByRukpak(deployment("combo-operator", 2, 1, "True")),
+				installedByRukpak(deployment("combo-proxy", 1, 1, "False")),
+				installedByRukpak(newObject(apiServiceGVK, "", "v1.example.com", map[string]interface{}{
+					"status": map[string]interface{}{"conditions": []interface{}{map[string]interface{}{
+						"type": "Available", "status": "False", "message": "failing or missing response from the service",
+					}}},
+				})),
+				installedByRukpak(webhook),
+			},
+			evaluated: 4,
+			unhealthy: []string{
+				"APIService v1.example.com: failing or missing response from the service",
+				"Deployment combo-system/combo-operator: 1 of 2 replicas are updated",
+				"Deployment combo-system/combo-proxy: 1 of 1 replicas are available",
+				"ValidatingWebhookConfiguration combo-webhook: the combo-system/combo-webhook webhook services have no ready endpoints",
+			},
+		},
+		{
+			name: "workloads of a BundleDeployment being retired",
+			po:   &platformv1alpha1.PlatformOperator{Status: platformv1alpha1.PlatformOperatorStatus{BundleDeployments: []string{"combo"}}},
+			objs: []client.Object{
+				installedBy(deployment("combo-operator", 1, 1, "True"), "combo"),
+				installedByRukpak(deployment("combo-proxy", 1, 1, "True")),
+				// Workloads of other BundleDeployments are ignored.
+				installedBy(deployment("unrelated", 1, 0, "False"), "unrelated"),
+			},
+			evaluated: 2,
+		},
+		{
+			name: "workloads applied directly",
+			po: &platformv1alpha1.PlatformOperator{Status: platformv1alpha1.PlatformOperatorStatus{AppliedObjects: []platformv1alpha1.AppliedObject{
+				{APIVersion: "apps/v1", Kind: "Deployment", Namespace: "combo-system", Name: "combo-operator"},
+				{APIVersion: "apps/v1", Kind: "Deployment", Namespace: "combo-system", Name: "deleted"},
+				{APIVersion: "v1", Kind: "Service", Namespace: "combo-system", Name: "combo-metrics"},
+			}}},
+			objs:      []client.Object{deployment("combo-operator", 1, 1, "True")},
+			evaluated: 2,
+			unhealthy: []string{"Deployment combo-system/deleted: not found"},
+		},
+		{
+			name:      "custom probes",
+			props:     []property.Property{probeProperty("Ready")},
+			objs:      []client.Object{combo},
+			evaluated: 1,
+		},
+		{
+			name:      "failing custom probes",
+			props:     []property.Property{probeProperty("Upgraded")},
+			objs:      []client.Object{combo},
+			evaluated: 1,
+			unhealthy: []string{"Combo combo-system/cluster: the Upgraded condition isn't reported"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			po := tt.po
+			if po == nil {
+				po = &platformv1alpha1.PlatformOperator{}
+			}
+			po.SetName("combo")
+
+			report, err := NewEvaluator(newFakeClient(tt.objs...)).Evaluate(context.Background(), po, &sourcer.Bundle{Properties: tt.props})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if report.Evaluated != tt.evaluated {
+				t.Errorf("expected %d objects to be evaluated, got %d", tt.evaluated, report.Evaluated)
+			}
+			if !reflect.DeepEqual(report.Unhealthy, tt.unhealthy) {
+				t.Errorf("expected the unhealthy objects to be %q, got %q", tt.unhealthy, report.Unhealthy)
+			}
+		})
+	}
+}
+
+var unservedGVK = schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Unserved"}
+
+// restrictedGetter isn't allowed to get Combos, as the manager's role doesn't
+// cover the kinds of every health probe object, and doesn't serve the Unserved
+// kind, which the fake client can't tell.
+type restrictedGetter struct {
+	client.Client
+}
+
+func (c restrictedGetter) Get(ctx context.Context, key client.ObjectKey, obj client.Object) error {
+	switch gvk := obj.GetObjectKind().GroupVersionKind(); gvk {
+	case comboGVK:
+		return apierrors.NewForbidden(schema.GroupResource{Group: gvk.Group, Resource: "combos"}, key.Name, errors.New("not allowed"))
+	case unservedGVK:
+		return &meta.NoKindMatchError{GroupKind: gvk.GroupKind(), SearchedVersions: []string{gvk.Version}}
+	}
+	return c.Client.Get(ctx, key, obj)
+}
+
+func TestEvaluateUnreadableProbes(t *testing.T) {
+	probe := func(gvk schema.GroupVersionKind) property.Property {
+		value, _ := json.Marshal(map[string]string{
+			"group": gvk.Group, "version": gvk.Version, "kind": gvk.Kind,
+			"namespace": "combo-system", "name": "cluster", "condition": "Ready",
+		})
+		return property.Property{Type: TypeHealthProbe, Value: value}
+	}
+	c := restrictedGetter{newFakeClient(installedByRukpak(deployment("combo-operator", 1, 1, "True")))}
+	po := &platformv1alpha1.PlatformOperator{}
+	po.SetName("combo")
+
+	props := []property.Property{probe(comboGVK), probe(unservedGVK)}
+	report, err := NewEvaluator(c).Evaluate(context.Background(), po, &sourcer.Bundle{Properties: props})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if report.Evaluated != 2 {
+		t.Errorf("expected 2 objects to be evaluated, got %d", report.Evaluated)
+	}
+	if want := []string{"Unserved combo-system/cluster: the example.com/v1 API isn't served"}; !reflect.DeepEqual(report.Unhealthy, want) {
+		t.Errorf("expected the unhealthy objects to be %q, got %q", want, report.Unhealthy)
+	}
+	if want := []string{"Combo combo-system/cluster: not allowed to get it"}; !reflect.DeepEqual(report.Skipped, want) {
+		t.Errorf("expected the skipped objects to be %q, got %q", want, report.Skipped)
+	}
+}
+
+func TestEvaluateWithProbe(t *testing.T) {
+	probe := ProbeFunc(func(context.Context, *unstructured.Unstructured) (bool, string, error) {
+		return false, "not ready", nil
+	})
+	c := newFakeClient(installedByRukpak(newObject(comboGVK, "combo-system", "cluster", nil)))
+	po := &platformv1alpha1.PlatformOperator{}
+	po.SetName("combo")
+
+	report, err := NewEvaluator(c, WithProbe(comboGVK, probe)).Evaluate(context.Background(), po, &sourcer.Bundle{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"Combo combo-system/cluster: not ready"}; !reflect.DeepEqual(report.Unhealthy, want) {
+		t.Errorf("expected the unhealthy objects to be %q, got %q", want, report.Unhealthy)
+	}
+}
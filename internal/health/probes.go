@@ -0,0 +1,162 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var (
+	deploymentGVK        = schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}
+	daemonSetGVK         = schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "DaemonSet"}
+	apiServiceGVK        = schema.GroupVersionKind{Group: "apiregistration.k8s.io", Version: "v1", Kind: "APIService"}
+	validatingWebhookGVK = schema.GroupVersionKind{Group: "admissionregistration.k8s.io", Version: "v1", Kind: "ValidatingWebhookConfiguration"}
+	mutatingWebhookGVK   = schema.GroupVersionKind{Group: "admissionregistration.k8s.io", Version: "v1", Kind: "MutatingWebhookConfiguration"}
+	endpointsGVK         = schema.GroupVersionKind{Version: "v1", Kind: "Endpoints"}
+)
+
+// probeDeployment reports a Deployment as healthy once its latest spec has been
+// rolled out and it's Available.
+func probeDeployment(_ context.Context, obj *unstructured.Unstructured) (bool, string, error) {
+	if msg := rolloutPending(obj); msg != "" {
+		return false, msg, nil
+	}
+	replicas, found, _ := unstructured.NestedInt64(obj.Object, "spec", "replicas")
+	if !found {
+		replicas = 1
+	}
+	updated, _, _ := unstructured.NestedInt64(obj.Object, "status", "updatedReplicas")
+	if updated < replicas {
+		return false, fmt.Sprintf("%d of %d replicas are updated", updated, replicas), nil
+	}
+	if status, _ := conditionStatus(obj, "Available"); status != "True" {
+		available, _, _ := unstructured.NestedInt64(obj.Object, "status", "availableReplicas")
+		return false, fmt.Sprintf("%d of %d replicas are available", available, replicas), nil
+	}
+	return true, "", nil
+}
+
+// probeDaemonSet reports a DaemonSet as healthy once its latest spec has been
+// rolled out to every node it's scheduled on, and is available on each of them.
+func probeDaemonSet(_ context.Context, obj *unstructured.Unstructured) (bool, string, error) {
+	if msg := rolloutPending(obj); msg != "" {
+		return false, msg, nil
+	}
+	desired, _, _ := unstructured.NestedInt64(obj.Object, "status", "desiredNumberScheduled")
+	updated, _, _ := unstructured.NestedInt64(obj.Object, "status", "updatedNumberScheduled")
+	if updated < desired {
+		return false, fmt.Sprintf("%d of %d pods are updated", updated, desired), nil
+	}
+	available, _, _ := unstructured.NestedInt64(obj.Object, "status", "numberAvailable")
+	if available < desired {
+		return false, fmt.Sprintf("%d of %d pods are available", available, desired), nil
+	}
+	return true, "", nil
+}
+
+// probeAPIService reports an APIService as healthy when the aggregator reports
+// it as Available.
+func probeAPIService(_ context.Context, obj *unstructured.Unstructured) (bool, string, error) {
+	status, found := conditionStatus(obj, "Available")
+	if !found {
+		return false, "the Available condition isn't reported", nil
+	}
+	if status != "True" {
+		if msg := conditionMessage(obj, "Available"); msg != "" {
+			return false, msg, nil
+		}
+		return false, "the API isn't available", nil
+	}
+	return true, "", nil
+}
+
+// webhookProbe reports a webhook configuration as healthy when each of the
+// services its webhooks call has ready endpoints.
+type webhookProbe struct {
+	client.Client
+}
+
+func (p webhookProbe) Probe(ctx context.Context, obj *unstructured.Unstructured) (bool, string, error) {
+	webhooks, _, err := unstructured.NestedSlice(obj.Object, "webhooks")
+	if err != nil {
+		return false, "", err
+	}
+	var unready []string
+	for _, w := range webhooks {
+		w, ok := w.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		namespace, _, _ := unstructured.NestedString(w, "clientConfig", "service", "namespace")
+		name, found, _ := unstructured.NestedString(w, "clientConfig", "service", "name")
+		if !found {
+			// Webhooks called through a URL can't be probed.
+			continue
+		}
+		endpoints := &unstructured.Unstructured{}
+		endpoints.SetGroupVersionKind(endpointsGVK)
+		if err := p.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, endpoints); client.IgnoreNotFound(err) != nil {
+			return false, "", err
+		}
+		if !hasReadyAddresses(endpoints) {
+			unready = append(unready, fmt.Sprintf("%s/%s", namespace, name))
+		}
+	}
+	if len(unready) != 0 {
+		return false, fmt.Sprintf("the %s webhook services have no ready endpoints", strings.Join(unready, ", ")), nil
+	}
+	return true, "", nil
+}
+
+func hasReadyAddresses(endpoints *unstructured.Unstructured) bool {
+	subsets, _, _ := unstructured.NestedSlice(endpoints.Object, "subsets")
+	for _, s := range subsets {
+		s, ok := s.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if addresses, _, _ := unstructured.NestedSlice(s, "addresses"); len(addresses) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// rolloutPending describes why the workload's latest spec hasn't been observed
+// by its controller yet, if it hasn't.
+func rolloutPending(obj *unstructured.Unstructured) string {
+	observed, _, _ := unstructured.NestedInt64(obj.Object, "status", "observedGeneration")
+	if observed < obj.GetGeneration() {
+		return fmt.Sprintf("generation %d hasn't been observed yet", obj.GetGeneration())
+	}
+	return ""
+}
+
+// conditionStatus returns the status of the object's condition of the type.
+func conditionStatus(obj *unstructured.Unstructured, conditionType string) (string, bool) {
+	c := findCondition(obj, conditionType)
+	if c == nil {
+		return "", false
+	}
+	status, _ := c["status"].(string)
+	return status, true
+}
+
+func conditionMessage(obj *unstructured.Unstructured, conditionType string) string {
+	message, _ := findCondition(obj, conditionType)["message"].(string)
+	return message
+}
+
+func findCondition(obj *unstructured.Unstructured, conditionType string) map[string]interface{} {
+	conds, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, c := range conds {
+		if c, ok := c.(map[string]interface{}); ok && c["type"] == conditionType {
+			return c
+		}
+	}
+	return nil
+}
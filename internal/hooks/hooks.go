@@ -0,0 +1,306 @@
+package hooks
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	logr "sigs.k8s.io/controller-runtime/pkg/log"
+
+	platformv1alpha1 "github.com/openshift/platform-operators/api/v1alpha1"
+	"github.com/openshift/platform-operators/internal/util"
+)
+
+const (
+	// PlatformOperatorLabel and HookLabel identify the PlatformOperator and the
+	// hook the Jobs and their logs are created for.
+	PlatformOperatorLabel = "platform.openshift.io/platform-operator"
+	HookLabel             = "platform.openshift.io/hook"
+
+	// maxLogBytes limits the logs kept for each container of a hook's pods, so
+	// the logs of every pod fit in a ConfigMap.
+	maxLogBytes = 64 * 1024
+	// maxNameLength is the longest name a Job can have, as it's used as the
+	// value of the job-name label of its pods.
+	maxNameLength = 63
+)
+
+// ErrHookFailed is returned when a hook's Job fails.
+var ErrHookFailed = errors.New("hook failed")
+
+// Runner runs the hooks of a PlatformOperator as Jobs, recording their outcome
+// in its status.
+type Runner interface {
+	// Run runs the hooks of the phase for the olm.bundle version one at a time,
+	// in order, returning the name of the hook that's still running, if any.
+	// ErrHookFailed is returned once a hook fails, and the failed hook isn't run
+	// again until its Job manifest changes.
+	Run(ctx context.Context, po *platformv1alpha1.PlatformOperator, version string, phase platformv1alpha1.HookPhase, hooks []platformv1alpha1.Hook) (string, error)
+}
+
+type runner struct {
+	client.Client
+	pods corev1client.PodsGetter
+}
+
+// NewRunner returns a Runner that creates the hooks' Jobs with the client, and
+// copies the logs of their pods into a ConfigMap before deleting them. The Jobs
+// and ConfigMaps are read through the client, so its cache should be restricted
+// with CacheSelectors.
+func NewRunner(c client.Client, pods corev1client.PodsGetter) Runner {
+	return &runner{Client: c, pods: pods}
+}
+
+// CacheSelectors restricts the cache to the Jobs and ConfigMaps created for
+// hooks, so reading them doesn't cache every Job and ConfigMap on the cluster.
+func CacheSelectors() cache.SelectorsByObject {
+	// The requirement is valid, as the label is.
+	hooked, _ := labels.NewRequirement(PlatformOperatorLabel, selection.Exists, nil)
+	selector := cache.ObjectSelector{Label: labels.NewSelector().Add(*hooked)}
+	return cache.SelectorsByObject{
+		&batchv1.Job{}:      selector,
+		&corev1.ConfigMap{}: selector,
+	}
+}
+
+func (r *runner) Run(ctx context.Context, po *platformv1alpha1.PlatformOperator, version string, phase platformv1alpha1.HookPhase, hooks []platformv1alpha1.Hook) (string, error) {
+	declared := make(map[string]bool, len(hooks))
+	for _, h := range hooks {
+		if h.Phase == phase {
+			declared[h.Name] = true
+		}
+	}
+	// Forget the hooks of the phase that are no longer declared.
+	statuses := po.Status.Hooks[:0]
+	for _, s := range po.Status.Hooks {
+		if s.Phase != phase || declared[s.Name] {
+			statuses = append(statuses, s)
+			continue
+		}
+		r.deleteLogs(ctx, &s)
+	}
+	po.Status.Hooks = statuses
+
+	for _, h := range hooks {
+		if h.Phase != phase {
+			continue
+		}
+		job, err := newJob(po, version, h)
+		if err != nil {
+			return "", err
+		}
+		status := r.status(ctx, po, h, version, job)
+		if status.State == platformv1alpha1.HookStateRunning {
+			if err := r.sync(ctx, po, job, status); err != nil {
+				return "", err
+			}
+		}
+		switch status.State {
+		case platformv1alpha1.HookStateSucceeded:
+			continue
+		case platformv1alpha1.HookStateFailed:
+			return "", fmt.Errorf("%w: the %s %s hook of the %s version: %s", ErrHookFailed, h.Name, phase, version, status.Message)
+		}
+		return h.Name, nil
+	}
+	return "", nil
+}
+
+// status returns the recorded status of the hook, resetting it when the hook
+// last ran for another version or with another Job manifest.
+func (r *runner) status(ctx context.Context, po *platformv1alpha1.PlatformOperator, h platformv1alpha1.Hook, version string, job *batchv1.Job) *platformv1alpha1.HookStatus {
+	for i := range po.Status.Hooks {
+		s := &po.Status.Hooks[i]
+		if s.Name != h.Name || s.Phase != h.Phase {
+			continue
+		}
+		if s.Version != version || s.Namespace != job.Namespace || s.Job != job.Name {
+			r.deleteLogs(ctx, s)
+			*s = newStatus(h, version, job)
+		}
+		return s
+	}
+	po.Status.Hooks = append(po.Status.Hooks, newStatus(h, version, job))
+	return &po.Status.Hooks[len(po.Status.Hooks)-1]
+}
+
+func newStatus(h platformv1alpha1.Hook, version string, job *batchv1.Job) platformv1alpha1.HookStatus {
+	return platformv1alpha1.HookStatus{
+		Name:      h.Name,
+		Phase:     h.Phase,
+		Version:   version,
+		Namespace: job.Namespace,
+		Job:       job.Name,
+		State:     platformv1alpha1.HookStateRunning,
+	}
+}
+
+// sync creates the hook's Job if it doesn't exist yet, and records its outcome
+// once it finishes, keeping its logs and deleting it.
+func (r *runner) sync(ctx context.Context, po *platformv1alpha1.PlatformOperator, job *batchv1.Job, status *platformv1alpha1.HookStatus) error {
+	log := logr.FromContext(ctx)
+
+	existing := &batchv1.Job{}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(job), existing); err != nil {
+		if client.IgnoreNotFound(err) != nil {
+			return fmt.Errorf("failed to get the %s hook's Job: %w", status.Name, err)
+		}
+		if err := r.Create(ctx, job); err != nil {
+			return fmt.Errorf("failed to create the %s hook's Job: %w", status.Name, err)
+		}
+		log.Info("started hook", "hook", status.Name, "phase", status.Phase, "job", client.ObjectKeyFromObject(job))
+		return nil
+	}
+
+	finished, failure := jobOutcome(existing)
+	if !finished {
+		return nil
+	}
+	if err := r.keepLogs(ctx, po, existing); err != nil {
+		return err
+	}
+	if err := r.Delete(ctx, existing, client.PropagationPolicy(metav1.DeletePropagationBackground)); client.IgnoreNotFound(err) != nil {
+		return fmt.Errorf("failed to delete the %s hook's Job: %w", status.Name, err)
+	}
+	status.LogsConfigMap = existing.Name
+	status.State = platformv1alpha1.HookStateSucceeded
+	if failure != "" {
+		status.State = platformv1alpha1.HookStateFailed
+		status.Message = failure
+	}
+	log.Info("finished hook", "hook", status.Name, "phase", status.Phase, "state", status.State)
+	return nil
+}
+
+// jobOutcome reports whether the Job has finished, and why it failed if it did.
+func jobOutcome(job *batchv1.Job) (bool, string) {
+	for _, c := range job.Status.Conditions {
+		if c.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch c.Type {
+		case batchv1.JobComplete:
+			return true, ""
+		case batchv1.JobFailed:
+			if c.Message != "" {
+				return true, c.Message
+			}
+			return true, c.Reason
+		}
+	}
+	return false, ""
+}
+
+// keepLogs copies the logs of the Job's pods into a ConfigMap named after the
+// Job, so they outlive it.
+func (r *runner) keepLogs(ctx context.Context, po *platformv1alpha1.PlatformOperator, job *batchv1.Job) error {
+	// The pods are listed directly rather than through the cache, so every pod
+	// on the cluster isn't cached.
+	pods, err := r.pods.Pods(job.Namespace).List(ctx, metav1.ListOptions{LabelSelector: "controller-uid=" + string(job.UID)})
+	if err != nil {
+		return fmt.Errorf("failed to list the pods of the %s Job: %w", job.Name, err)
+	}
+	data := make(map[string]string)
+	for _, pod := range pods.Items {
+		for _, c := range pod.Spec.Containers {
+			limit := int64(maxLogBytes)
+			logs, err := r.pods.Pods(pod.Namespace).GetLogs(pod.Name, &corev1.PodLogOptions{Container: c.Name, LimitBytes: &limit}).DoRaw(ctx)
+			if err != nil {
+				logs = []byte(fmt.Sprintf("failed to get the logs: %v", err))
+			}
+			data[pod.Name+"."+c.Name] = string(logs)
+		}
+	}
+
+	cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: job.Namespace, Name: job.Name}}
+	_, err = controllerutil.CreateOrUpdate(ctx, r.Client, cm, func() error {
+		cm.Labels = job.Labels
+		cm.SetOwnerReferences([]metav1.OwnerReference{*metav1.NewControllerRef(po, platformv1alpha1.GroupVersion.WithKind(platformv1alpha1.PlatformOperatorKind))})
+		cm.Data = data
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to keep the logs of the %s Job: %w", job.Name, err)
+	}
+	return nil
+}
+
+// deleteLogs deletes the logs kept for a hook that's run again or no longer
+// declared.
+func (r *runner) deleteLogs(ctx context.Context, s *platformv1alpha1.HookStatus) {
+	if s.LogsConfigMap == "" {
+		return
+	}
+	cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: s.Namespace, Name: s.LogsConfigMap}}
+	if err := r.Delete(ctx, cm); client.IgnoreNotFound(err) != nil {
+		logr.FromContext(ctx).Error(err, "failed to delete the logs of a previous hook", "hook", s.Name, "configmap", client.ObjectKeyFromObject(cm))
+	}
+}
+
+// newJob returns the Job the hook runs as for the version. The Job is named
+// after the version and its manifest, so the hook runs again whenever either
+// changes.
+func newJob(po *platformv1alpha1.PlatformOperator, version string, h platformv1alpha1.Hook) (*batchv1.Job, error) {
+	job := &batchv1.Job{}
+	if err := json.Unmarshal(h.Job.Raw, job); err != nil {
+		return nil, util.NewPermanentError(fmt.Errorf("invalid Job manifest for the %s hook: %w", h.Name, err))
+	}
+	if job.APIVersion != batchv1.SchemeGroupVersion.String() || job.Kind != "Job" {
+		return nil, util.NewPermanentError(fmt.Errorf("the %s hook must be a %s Job, got a %s %s", h.Name, batchv1.SchemeGroupVersion, job.APIVersion, job.Kind))
+	}
+	if job.Namespace == "" {
+		return nil, util.NewPermanentError(fmt.Errorf("the %s hook's Job must set its namespace", h.Name))
+	}
+
+	hash := sha256.New()
+	hash.Write([]byte(version))
+	hash.Write(h.Job.Raw)
+	suffix := fmt.Sprintf("%x", hash.Sum(nil))[:10]
+	name := dnsLabel(po.Name + "-" + h.Name)
+	if len(name) > maxNameLength-len(suffix)-1 {
+		name = strings.TrimRight(name[:maxNameLength-len(suffix)-1], "-")
+	}
+
+	job.Name = name + "-" + suffix
+	job.GenerateName = ""
+	labels := job.Labels
+	if labels == nil {
+		labels = make(map[string]string)
+	}
+	labels[PlatformOperatorLabel] = po.Name
+	labels[HookLabel] = dnsLabel(h.Name)
+	job.Labels = labels
+	job.SetOwnerReferences([]metav1.OwnerReference{*metav1.NewControllerRef(po, platformv1alpha1.GroupVersion.WithKind(platformv1alpha1.PlatformOperatorKind))})
+	return job, nil
+}
+
+// dnsLabel turns the name into a DNS label, usable in Job names and as a label
+// value. Hook names may be any object name, so the characters a DNS label can't
+// contain, like dots, are replaced with dashes.
+func dnsLabel(name string) string {
+	label := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r - 'A' + 'a'
+		}
+		return '-'
+	}, name)
+	if len(label) > maxNameLength {
+		label = label[:maxNameLength]
+	}
+	return strings.Trim(label, "-")
+}
@@ -0,0 +1,214 @@
+package hooks
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	platformv1alpha1 "github.com/openshift/platform-operators/api/v1alpha1"
+)
+
+func hook(name string, phase platformv1alpha1.HookPhase, image string) platformv1alpha1.Hook {
+	return platformv1alpha1.Hook{
+		Name:  name,
+		Phase: phase,
+		Job: runtime.RawExtension{Raw: []byte(`{"apiVersion":"batch/v1","kind":"Job","metadata":{"name":"` + name + `","namespace":"combo-system"},` +
+			`"spec":{"template":{"spec":{"restartPolicy":"Never","containers":[{"name":"hook","image":"` + image + `"}]}}}}`)},
+	}
+}
+
+type testRunner struct {
+	Runner
+	client.Client
+	pods *kubefake.Clientset
+}
+
+func newTestRunner(t *testing.T) *testRunner {
+	t.Helper()
+
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).Build()
+	pods := kubefake.NewSimpleClientset()
+	return &testRunner{Runner: NewRunner(c, pods.CoreV1()), Client: c, pods: pods}
+}
+
+// finish marks the hook's Job as finished, with a pod that ran it.
+func (r *testRunner) finish(t *testing.T, status *platformv1alpha1.HookStatus, condition batchv1.JobConditionType, message string) {
+	t.Helper()
+
+	job := &batchv1.Job{}
+	if err := r.Get(context.Background(), types.NamespacedName{Namespace: status.Namespace, Name: status.Job}, job); err != nil {
+		t.Fatalf("expected the %s hook's Job to exist: %v", status.Name, err)
+	}
+	job.UID = types.UID(status.Job + "-uid")
+	job.Status.Conditions = []batchv1.JobCondition{{Type: condition, Status: corev1.ConditionTrue, Message: message}}
+	if err := r.Update(context.Background(), job); err != nil {
+		t.Fatal(err)
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: job.Namespace, Name: job.Name + "-abcde", Labels: map[string]string{"controller-uid": string(job.UID)}},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "hook"}}},
+	}
+	if _, err := r.pods.CoreV1().Pods(pod.Namespace).Create(context.Background(), pod, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRun(t *testing.T) {
+	r := newTestRunner(t)
+	po := &platformv1alpha1.PlatformOperator{ObjectMeta: metav1.ObjectMeta{Name: "combo", UID: "po-uid"}}
+	hooks := []platformv1alpha1.Hook{
+		hook("migrate", platformv1alpha1.HookPhasePreApply, "quay.io/combo/migrate:v1"),
+		hook("backup", platformv1alpha1.HookPhasePreApply, "quay.io/combo/backup:v1"),
+		hook("smoke-test", platformv1alpha1.HookPhasePostInstall, "quay.io/combo/smoke-test:v1"),
+	}
+	ctx := context.Background()
+
+	pending, err := r.Run(ctx, po, "0.0.2", platformv1alpha1.HookPhasePreApply, hooks)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if pending != "migrate" || len(po.Status.Hooks) != 1 {
+		t.Fatalf("expected only the migrate hook to be started, got %q and %+v", pending, po.Status.Hooks)
+	}
+	migrate := po.Status.Hooks[0]
+	if migrate.State != platformv1alpha1.HookStateRunning || migrate.Version != "0.0.2" {
+		t.Errorf("expected the migrate hook to be running for the 0.0.2 version, got %+v", migrate)
+	}
+
+	// Running hooks are waited for.
+	if pending, err = r.Run(ctx, po, "0.0.2", platformv1alpha1.HookPhasePreApply, hooks); err != nil || pending != "migrate" {
+		t.Fatalf("expected the migrate hook to still be pending, got %q and %v", pending, err)
+	}
+
+	r.finish(t, &migrate, batchv1.JobComplete, "")
+	if pending, err = r.Run(ctx, po, "0.0.2", platformv1alpha1.HookPhasePreApply, hooks); err != nil || pending != "backup" {
+		t.Fatalf("expected the backup hook to be started once the migrate hook succeeded, got %q and %v", pending, err)
+	}
+	migrate = po.Status.Hooks[0]
+	if migrate.State != platformv1alpha1.HookStateSucceeded || migrate.LogsConfigMap != migrate.Job {
+		t.Errorf("expected the migrate hook to have succeeded with its logs kept, got %+v", migrate)
+	}
+	logs := &corev1.ConfigMap{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: "combo-system", Name: migrate.LogsConfigMap}, logs); err != nil {
+		t.Fatalf("expected the migrate hook's logs to be kept: %v", err)
+	}
+	if got := logs.Data[migrate.Job+"-abcde.hook"]; got != "fake logs" {
+		t.Errorf("expected the logs of the migrate hook's pod, got %v", logs.Data)
+	}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: "combo-system", Name: migrate.Job}, &batchv1.Job{}); !apierrors.IsNotFound(err) {
+		t.Errorf("expected the migrate hook's Job to be deleted, got %v", err)
+	}
+
+	backup := po.Status.Hooks[1]
+	r.finish(t, &backup, batchv1.JobFailed, "Job has reached the specified backoff limit")
+	_, err = r.Run(ctx, po, "0.0.2", platformv1alpha1.HookPhasePreApply, hooks)
+	if !errors.Is(err, ErrHookFailed) {
+		t.Fatalf("expected the backup hook to fail, got %v", err)
+	}
+	if want := "hook failed: the backup PreApply hook of the 0.0.2 version: Job has reached the specified backoff limit"; err.Error() != want {
+		t.Errorf("expected %q, got %q", want, err.Error())
+	}
+	// Failed hooks aren't run again until their Job changes.
+	if _, err = r.Run(ctx, po, "0.0.2", platformv1alpha1.HookPhasePreApply, hooks); !errors.Is(err, ErrHookFailed) {
+		t.Fatalf("expected the backup hook to still be failed, got %v", err)
+	}
+	hooks[1] = hook("backup", platformv1alpha1.HookPhasePreApply, "quay.io/combo/backup:v2")
+	if pending, err = r.Run(ctx, po, "0.0.2", platformv1alpha1.HookPhasePreApply, hooks); err != nil || pending != "backup" {
+		t.Fatalf("expected the changed backup hook to be started again, got %q and %v", pending, err)
+	}
+	if backup := po.Status.Hooks[1]; backup.State != platformv1alpha1.HookStateRunning || backup.Message != "" {
+		t.Errorf("expected the backup hook to be running again, got %+v", backup)
+	}
+
+	// The hooks run again for the next version, and the logs of the previous
+	// version are deleted.
+	if pending, err = r.Run(ctx, po, "0.0.3", platformv1alpha1.HookPhasePreApply, hooks); err != nil || pending != "migrate" {
+		t.Fatalf("expected the migrate hook to be started for the 0.0.3 version, got %q and %v", pending, err)
+	}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(logs), &corev1.ConfigMap{}); !apierrors.IsNotFound(err) {
+		t.Errorf("expected the logs of the 0.0.2 migrate hook to be deleted, got %v", err)
+	}
+}
+
+func TestRunInvalidJob(t *testing.T) {
+	r := newTestRunner(t)
+	po := &platformv1alpha1.PlatformOperator{ObjectMeta: metav1.ObjectMeta{Name: "combo"}}
+	h := platformv1alpha1.Hook{
+		Name:  "migrate",
+		Phase: platformv1alpha1.HookPhasePreApply,
+		Job:   runtime.RawExtension{Raw: []byte(`{"apiVersion":"batch/v1","kind":"Job","metadata":{"name":"migrate"}}`)},
+	}
+	_, err := r.Run(context.Background(), po, "0.0.1", platformv1alpha1.HookPhasePreApply, []platformv1alpha1.Hook{h})
+	if want := "the migrate hook's Job must set its namespace"; err == nil || err.Error() != want {
+		t.Errorf("expected %q, got %v", want, err)
+	}
+}
+
+func TestNewJobName(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		po        string
+		hook      string
+		wantLabel string
+	}{
+		{name: "DNS label", po: "combo", hook: "migrate", wantLabel: "migrate"},
+		{name: "dots", po: "combo.example.com", hook: "migrate.v2", wantLabel: "migrate-v2"},
+		{name: "invalid characters", po: "combo", hook: "Migrate_Data.", wantLabel: "migrate-data"},
+		{
+			name:      "long names",
+			po:        "combo",
+			hook:      "migrate.the-data-of-every-combo-resource-to-the-new-storage-version-of-the-crd",
+			wantLabel: "migrate-the-data-of-every-combo-resource-to-the-new-storage-ver",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			po := &platformv1alpha1.PlatformOperator{ObjectMeta: metav1.ObjectMeta{Name: tt.po}}
+			job, err := newJob(po, "0.0.1", hook(tt.hook, platformv1alpha1.HookPhasePreApply, "quay.io/combo/migrate:v0.0.1"))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if errs := validation.IsDNS1123Label(job.Name); len(errs) != 0 {
+				t.Errorf("expected the Job name %q to be a DNS label: %v", job.Name, errs)
+			}
+			if got := job.Labels[HookLabel]; got != tt.wantLabel {
+				t.Errorf("expected the hook label to be %q, got %q", tt.wantLabel, got)
+			}
+			if errs := validation.IsValidLabelValue(job.Labels[HookLabel]); len(errs) != 0 {
+				t.Errorf("expected the hook label to be a valid label value: %v", errs)
+			}
+		})
+	}
+}
+
+func TestCacheSelectors(t *testing.T) {
+	po := &platformv1alpha1.PlatformOperator{ObjectMeta: metav1.ObjectMeta{Name: "combo"}}
+	job, err := newJob(po, "0.0.1", hook("migrate", platformv1alpha1.HookPhasePreApply, "quay.io/combo/migrate:v1"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for obj, selector := range CacheSelectors() {
+		if !selector.Label.Matches(labels.Set(job.Labels)) {
+			t.Errorf("expected the %T cache to hold the objects created for hooks", obj)
+		}
+		if selector.Label.Matches(labels.Set{"app": "combo"}) {
+			t.Errorf("expected the %T cache not to hold the objects that weren't created for hooks", obj)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	platformv1alpha1 "github.com/openshift/platform-operators/api/v1alpha1"
+)
+
+const (
+	namespace = "platform_operator"
+
+	labelName    = "name"
+	labelPackage = "package"
+	labelVersion = "version"
+	labelChannel = "channel"
+	labelCatalog = "catalog"
+	labelType    = "type"
+	labelStatus  = "status"
+)
+
+var (
+	info = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "info",
+		Help:      "Information about the olm.bundle content currently applied for a platform operator.",
+	}, []string{labelName, labelPackage, labelVersion, labelChannel, labelCatalog})
+
+	condition = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "condition",
+		Help:      "The current status of a platform operator condition, set to 1 for the observed status and 0 otherwise.",
+	}, []string{labelName, labelType, labelStatus})
+
+	upgradesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upgrades_total",
+		Help:      "Number of times a platform operator has been upgraded to a new olm.bundle version.",
+	}, []string{labelName, labelPackage})
+
+	upgradeDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "upgrade_duration_seconds",
+		Help:      "Time between a new olm.bundle version first being sourced and that version being successfully applied.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 12),
+	}, []string{labelName, labelPackage})
+
+	catalogQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "catalog_query_duration_seconds",
+		Help:      "Latency of listing olm.bundle content from an individual catalog.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{labelCatalog})
+
+	catalogQueryErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "catalog_query_errors_total",
+		Help:      "Number of failed attempts to list olm.bundle content from an individual catalog.",
+	}, []string{labelCatalog})
+
+	bundlesReclaimed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "bundles_reclaimed_total",
+		Help:      "Number of superseded rukpak Bundles garbage collected for a platform operator.",
+	}, []string{labelName})
+
+	lastSourceDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "seconds_since_last_successful_source"),
+		"Number of seconds since the desired olm.bundle content was last successfully sourced for a platform operator.",
+		[]string{labelName}, nil,
+	)
+
+	conditionStatuses = []string{"True", "False", "Unknown"}
+
+	state = newRecorder()
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		info,
+		condition,
+		upgradesTotal,
+		upgradeDuration,
+		catalogQueryDuration,
+		catalogQueryErrors,
+		bundlesReclaimed,
+		state,
+	)
+}
+
+// recorder tracks the per-PlatformOperator state needed to keep the exported
+// series consistent across reconciliations, and doubles as the collector for
+// the time since the last successful source.
+type recorder struct {
+	mu           sync.Mutex
+	info         map[string][]string
+	conditions   map[string]map[string]struct{}
+	applied      map[string]string
+	upgradeStart map[string]time.Time
+	lastSourced  map[string]time.Time
+}
+
+func newRecorder() *recorder {
+	return &recorder{
+		info:         make(map[string][]string),
+		conditions:   make(map[string]map[string]struct{}),
+		applied:      make(map[string]string),
+		upgradeStart: make(map[string]time.Time),
+		lastSourced:  make(map[string]time.Time),
+	}
+}
+
+func (r *recorder) Describe(ch chan<- *prometheus.Desc) {
+	ch <- lastSourceDesc
+}
+
+func (r *recorder) Collect(ch chan<- prometheus.Metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for name, t := range r.lastSourced {
+		ch <- prometheus.MustNewConstMetric(lastSourceDesc, prometheus.GaugeValue, time.Since(t).Seconds(), name)
+	}
+}
+
+// RecordSourced records that the desired olm.bundle version has been successfully
+// sourced for the PlatformOperator. When that version differs from the version that
+// was last applied, the start of an upgrade is recorded.
+func RecordSourced(po *platformv1alpha1.PlatformOperator, version string) {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	name := po.GetName()
+	now := time.Now()
+	state.lastSourced[name] = now
+
+	applied, ok := state.applied[name]
+	if !ok || applied == version {
+		delete(state.upgradeStart, name)
+		return
+	}
+	if _, ok := state.upgradeStart[name]; !ok {
+		state.upgradeStart[name] = now
+	}
+}
+
+// RecordApplied records that the olm.bundle content has been successfully applied
+// for the PlatformOperator, and completes any upgrade that was in progress.
+//
+// Note: the previously applied version is only tracked in memory, so the first
+// application after the controller starts is never counted as an upgrade.
+func RecordApplied(po *platformv1alpha1.PlatformOperator, version, channel, catalog string) {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	name := po.GetName()
+	pkg := po.Spec.PackageName
+
+	if previous, ok := state.applied[name]; ok && previous != version {
+		upgradesTotal.WithLabelValues(name, pkg).Inc()
+		if start, ok := state.upgradeStart[name]; ok {
+			upgradeDuration.WithLabelValues(name, pkg).Observe(time.Since(start).Seconds())
+		}
+	}
+	delete(state.upgradeStart, name)
+	state.applied[name] = version
+
+	labels := []string{name, pkg, version, channel, catalog}
+	if old, ok := state.info[name]; ok {
+		info.DeleteLabelValues(old...)
+	}
+	info.WithLabelValues(labels...).Set(1)
+	state.info[name] = labels
+}
+
+// RecordConditions exports the current status of each condition present on the
+// PlatformOperator. The series of the conditions that were removed from its
+// status since they were last recorded are deleted.
+func RecordConditions(po *platformv1alpha1.PlatformOperator) {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	name := po.GetName()
+	current := make(map[string]struct{}, len(po.Status.Conditions))
+	for _, c := range po.Status.Conditions {
+		current[c.Type] = struct{}{}
+		for _, status := range conditionStatuses {
+			var value float64
+			if string(c.Status) == status {
+				value = 1
+			}
+			condition.WithLabelValues(name, c.Type, status).Set(value)
+		}
+	}
+	for conditionType := range state.conditions[name] {
+		if _, ok := current[conditionType]; ok {
+			continue
+		}
+		for _, status := range conditionStatuses {
+			condition.DeleteLabelValues(name, conditionType, status)
+		}
+	}
+	state.conditions[name] = current
+}
+
+// RecordCatalogQuery records the latency, and failure if any, of listing the
+// olm.bundle content from an individual catalog.
+func RecordCatalogQuery(catalog string, start time.Time, err error) {
+	catalogQueryDuration.WithLabelValues(catalog).Observe(time.Since(start).Seconds())
+	if err != nil {
+		catalogQueryErrors.WithLabelValues(catalog).Inc()
+	}
+}
+
+// RecordBundlesReclaimed records the number of superseded Bundles that were
+// garbage collected for the PlatformOperator.
+func RecordBundlesReclaimed(name string, count int) {
+	bundlesReclaimed.WithLabelValues(name).Add(float64(count))
+}
+
+// Forget removes any series that were exported for a PlatformOperator that no
+// longer exists.
+func Forget(name string) {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	if labels, ok := state.info[name]; ok {
+		info.DeleteLabelValues(labels...)
+		upgradesTotal.DeleteLabelValues(name, labels[1])
+		upgradeDuration.DeleteLabelValues(name, labels[1])
+	}
+	bundlesReclaimed.DeleteLabelValues(name)
+	for conditionType := range state.conditions[name] {
+		for _, status := range conditionStatuses {
+			condition.DeleteLabelValues(name, conditionType, status)
+		}
+	}
+	delete(state.info, name)
+	delete(state.conditions, name)
+	delete(state.applied, name)
+	delete(state.upgradeStart, name)
+	delete(state.lastSourced, name)
+}
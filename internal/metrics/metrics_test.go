@@ -0,0 +1,114 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	platformv1alpha1 "github.com/openshift/platform-operators/api/v1alpha1"
+)
+
+func newPlatformOperator(t *testing.T, conditions ...metav1.Condition) *platformv1alpha1.PlatformOperator {
+	t.Helper()
+
+	po := &platformv1alpha1.PlatformOperator{
+		ObjectMeta: metav1.ObjectMeta{Name: "combo"},
+		Spec:       platformv1alpha1.PlatformOperatorSpec{PackageName: "combo"},
+		Status:     platformv1alpha1.PlatformOperatorStatus{Conditions: conditions},
+	}
+	// The recorded state is global, so it's reset for the next test.
+	t.Cleanup(func() { Forget(po.GetName()) })
+	return po
+}
+
+func TestRecordConditions(t *testing.T) {
+	po := newPlatformOperator(t,
+		metav1.Condition{Type: platformv1alpha1.TypeApplied, Status: metav1.ConditionTrue},
+		metav1.Condition{Type: platformv1alpha1.TypeDependenciesInstalled, Status: metav1.ConditionFalse},
+	)
+
+	RecordConditions(po)
+	expected := `
+# HELP platform_operator_condition The current status of a platform operator condition, set to 1 for the observed status and 0 otherwise.
+# TYPE platform_operator_condition gauge
+platform_operator_condition{name="combo",status="False",type="Applied"} 0
+platform_operator_condition{name="combo",status="False",type="DependenciesInstalled"} 1
+platform_operator_condition{name="combo",status="True",type="Applied"} 1
+platform_operator_condition{name="combo",status="True",type="DependenciesInstalled"} 0
+platform_operator_condition{name="combo",status="Unknown",type="Applied"} 0
+platform_operator_condition{name="combo",status="Unknown",type="DependenciesInstalled"} 0
+`
+	if err := testutil.CollectAndCompare(condition, strings.NewReader(expected)); err != nil {
+		t.Fatal(err)
+	}
+
+	// The series of removed conditions are deleted.
+	po.Status.Conditions = po.Status.Conditions[:1]
+	RecordConditions(po)
+	expected = `
+# HELP platform_operator_condition The current status of a platform operator condition, set to 1 for the observed status and 0 otherwise.
+# TYPE platform_operator_condition gauge
+platform_operator_condition{name="combo",status="False",type="Applied"} 0
+platform_operator_condition{name="combo",status="True",type="Applied"} 1
+platform_operator_condition{name="combo",status="Unknown",type="Applied"} 0
+`
+	if err := testutil.CollectAndCompare(condition, strings.NewReader(expected)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRecordApplied(t *testing.T) {
+	po := newPlatformOperator(t)
+
+	RecordApplied(po, "1.0.0", "stable", "redhat-operators")
+	RecordSourced(po, "1.1.0")
+	RecordApplied(po, "1.1.0", "stable", "redhat-operators")
+
+	// The info series of the previous version is replaced.
+	expected := `
+# HELP platform_operator_info Information about the olm.bundle content currently applied for a platform operator.
+# TYPE platform_operator_info gauge
+platform_operator_info{catalog="redhat-operators",channel="stable",name="combo",package="combo",version="1.1.0"} 1
+`
+	if err := testutil.CollectAndCompare(info, strings.NewReader(expected)); err != nil {
+		t.Fatal(err)
+	}
+	expected = `
+# HELP platform_operator_upgrades_total Number of times a platform operator has been upgraded to a new olm.bundle version.
+# TYPE platform_operator_upgrades_total counter
+platform_operator_upgrades_total{name="combo",package="combo"} 1
+`
+	if err := testutil.CollectAndCompare(upgradesTotal, strings.NewReader(expected)); err != nil {
+		t.Fatal(err)
+	}
+	if count := testutil.CollectAndCount(upgradeDuration); count != 1 {
+		t.Errorf("expected the upgrade duration to be observed, got %d series", count)
+	}
+}
+
+func TestForget(t *testing.T) {
+	po := newPlatformOperator(t, metav1.Condition{Type: platformv1alpha1.TypeApplied, Status: metav1.ConditionTrue})
+
+	RecordSourced(po, "1.0.0")
+	RecordApplied(po, "1.0.0", "stable", "redhat-operators")
+	RecordConditions(po)
+	RecordBundlesReclaimed(po.GetName(), 2)
+	if count := testutil.CollectAndCount(state); count != 1 {
+		t.Errorf("expected the time since the last successful source to be exported, got %d series", count)
+	}
+
+	Forget(po.GetName())
+	for name, c := range map[string]prometheus.Collector{
+		"info":              info,
+		"condition":         condition,
+		"bundles reclaimed": bundlesReclaimed,
+		"last sourced":      state,
+	} {
+		if count := testutil.CollectAndCount(c); count != 0 {
+			t.Errorf("expected the %s series to be deleted, got %d", name, count)
+		}
+	}
+}
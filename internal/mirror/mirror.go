@@ -0,0 +1,248 @@
+package mirror
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+var (
+	// ImageContentSourcePolicyList is the GVK of the OpenShift
+	// ImageContentSourcePolicy API, whose mirrors are listed under
+	// spec.repositoryDigestMirrors.
+	ImageContentSourcePolicyList = schema.GroupVersionKind{Group: "operator.openshift.io", Version: "v1alpha1", Kind: "ImageContentSourcePolicyList"}
+	// ImageDigestMirrorSetList is the GVK of the OpenShift ImageDigestMirrorSet
+	// API, whose mirrors are listed under spec.imageDigestMirrors.
+	ImageDigestMirrorSetList = schema.GroupVersionKind{Group: "config.openshift.io", Version: "v1", Kind: "ImageDigestMirrorSetList"}
+)
+
+// Mirror maps a source repository, or a registry or namespace containing
+// repositories, to the locations its content is mirrored to.
+type Mirror struct {
+	Source  string   `json:"source"`
+	Mirrors []string `json:"mirrors"`
+}
+
+// Rewriter rewrites an image reference to the location it's mirrored to.
+type Rewriter interface {
+	Rewrite(ctx context.Context, image string) (string, error)
+	// Locations returns the references the image can be fetched from, in the
+	// order they should be tried: its mirrors, followed by the image itself.
+	Locations(ctx context.Context, image string) ([]string, error)
+}
+
+// LoadConfig reads a YAML or JSON encoded list of mirrors from the file at path.
+func LoadConfig(path string) ([]Mirror, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var mirrors []Mirror
+	if err := yaml.UnmarshalStrict(data, &mirrors); err != nil {
+		return nil, fmt.Errorf("failed to parse the %s image mirror configuration: %w", path, err)
+	}
+	return mirrors, nil
+}
+
+type staticRewriter []Mirror
+
+// NewStaticRewriter returns a Rewriter that only honors the given mirrors.
+func NewStaticRewriter(mirrors []Mirror) Rewriter {
+	return staticRewriter(mirrors)
+}
+
+func (r staticRewriter) Rewrite(_ context.Context, image string) (string, error) {
+	return Rewrite(image, r)
+}
+
+func (r staticRewriter) Locations(_ context.Context, image string) ([]string, error) {
+	return Locations(image, r)
+}
+
+type clusterRewriter struct {
+	client.Reader
+	static []Mirror
+}
+
+// NewClusterRewriter returns a Rewriter that honors the static mirrors along with
+// the ImageContentSourcePolicies and ImageDigestMirrorSets in the cluster. The
+// static mirrors take precedence over the cluster's for the same source. The
+// mirror APIs are listed every time an image is rewritten, so c should be a
+// cache, which unlike the manager's client also caches unstructured objects.
+func NewClusterRewriter(c client.Reader, static []Mirror) Rewriter {
+	return &clusterRewriter{
+		Reader: c,
+		static: static,
+	}
+}
+
+func (r clusterRewriter) Rewrite(ctx context.Context, image string) (string, error) {
+	mirrors, err := r.mirrors(ctx)
+	if err != nil {
+		return "", err
+	}
+	return Rewrite(image, mirrors)
+}
+
+func (r clusterRewriter) Locations(ctx context.Context, image string) ([]string, error) {
+	mirrors, err := r.mirrors(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return Locations(image, mirrors)
+}
+
+func (r clusterRewriter) mirrors(ctx context.Context) ([]Mirror, error) {
+	mirrors := append([]Mirror{}, r.static...)
+	for _, src := range []struct {
+		gvk  schema.GroupVersionKind
+		path []string
+	}{
+		{gvk: ImageDigestMirrorSetList, path: []string{"spec", "imageDigestMirrors"}},
+		{gvk: ImageContentSourcePolicyList, path: []string{"spec", "repositoryDigestMirrors"}},
+	} {
+		found, err := r.list(ctx, src.gvk, src.path...)
+		if err != nil {
+			return nil, err
+		}
+		mirrors = append(mirrors, found...)
+	}
+	return mirrors, nil
+}
+
+// list returns the mirrors configured by every instance of an OpenShift mirror
+// API, ignoring APIs that aren't served by the cluster.
+func (r clusterRewriter) list(ctx context.Context, gvk schema.GroupVersionKind, path ...string) ([]Mirror, error) {
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(gvk)
+	if err := r.List(ctx, list); err != nil {
+		if meta.IsNoMatchError(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to list %s: %w", gvk.Kind, err)
+	}
+	var mirrors []Mirror
+	for _, item := range list.Items {
+		entries, _, err := unstructured.NestedSlice(item.Object, path...)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %s: %w", item.GetKind(), item.GetName(), err)
+		}
+		for _, entry := range entries {
+			fields, ok := entry.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			source, _, _ := unstructured.NestedString(fields, "source")
+			locations, _, _ := unstructured.NestedStringSlice(fields, "mirrors")
+			mirrors = append(mirrors, Mirror{Source: source, Mirrors: locations})
+		}
+	}
+	return mirrors, nil
+}
+
+// Rewrite returns the image reference rewritten to the first location of the
+// most specific mirror whose source contains the image. As with the cluster's
+// mirror APIs, only references pinned to a digest are rewritten, and the image is
+// returned unchanged when no mirror applies.
+func Rewrite(image string, mirrors []Mirror) (string, error) {
+	ref, err := name.NewDigest(image)
+	if err != nil {
+		return image, nil
+	}
+	match := mostSpecific(ref.Context(), mirrors)
+	if match == nil {
+		return image, nil
+	}
+	return mirrored(ref, match, match.Mirrors[0])
+}
+
+// Locations returns the image reference rewritten to every location of the most
+// specific mirror whose source contains the image, followed by the image itself.
+// As with Rewrite, only references pinned to a digest are mirrored, so tags are
+// only ever fetched from the image's own registry.
+func Locations(image string, mirrors []Mirror) ([]string, error) {
+	ref, err := name.NewDigest(image)
+	if err != nil {
+		return []string{image}, nil
+	}
+	match := mostSpecific(ref.Context(), mirrors)
+	if match == nil {
+		return []string{image}, nil
+	}
+	locations := make([]string, 0, len(match.Mirrors)+1)
+	for _, location := range match.Mirrors {
+		l, err := mirrored(ref, match, location)
+		if err != nil {
+			return nil, err
+		}
+		locations = append(locations, l)
+	}
+	return append(locations, image), nil
+}
+
+// mostSpecific returns the mirror with the longest source that contains the
+// repository, if any.
+func mostSpecific(repo name.Repository, mirrors []Mirror) *Mirror {
+	full := fullName(repo)
+
+	var match *Mirror
+	for i, m := range mirrors {
+		if len(m.Mirrors) == 0 || !contains(m.Source, full) {
+			continue
+		}
+		if match == nil || len(m.Source) > len(match.Source) {
+			match = &mirrors[i]
+		}
+	}
+	return match
+}
+
+// mirrored returns the reference to the image at the mirror's location.
+func mirrored(ref name.Digest, m *Mirror, location string) (string, error) {
+	target := location + strings.TrimPrefix(fullName(ref.Context()), normalize(m.Source))
+	out, err := name.NewDigest(target + "@" + ref.DigestStr())
+	if err != nil {
+		return "", fmt.Errorf("invalid mirror %q for the %s source: %w", location, m.Source, err)
+	}
+	return out.String(), nil
+}
+
+// contains returns whether the repository is the source, or is nested under the
+// registry or namespace the source refers to.
+func contains(source, repo string) bool {
+	source = normalize(source)
+	return repo == source || strings.HasPrefix(repo, source+"/")
+}
+
+// normalize returns the source in the same form as the repository names it's
+// compared with, e.g. with the implicit docker.io registry expanded.
+func normalize(source string) string {
+	source = strings.TrimSuffix(source, "/")
+	host, path, _ := strings.Cut(source, "/")
+	if !strings.ContainsAny(host, ".:") && host != "localhost" {
+		// Sources without a registry refer to Docker Hub.
+		host, path = name.DefaultRegistry, source
+	}
+	reg, err := name.NewRegistry(host)
+	if err != nil {
+		return source
+	}
+	if path == "" {
+		return reg.RegistryStr()
+	}
+	return reg.RegistryStr() + "/" + path
+}
+
+// fullName returns the repository's name including the registry, which is
+// omitted from name.Repository.Name for the default registry.
+func fullName(repo name.Repository) string {
+	return repo.RegistryStr() + "/" + repo.RepositoryStr()
+}
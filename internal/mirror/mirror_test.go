@@ -0,0 +1,163 @@
+package mirror
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+const digest = "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+
+func TestRewrite(t *testing.T) {
+	mirrors := []Mirror{
+		{Source: "quay.io/combo", Mirrors: []string{"mirror.example.com:5000/combo"}},
+		{Source: "quay.io/combo/bundle", Mirrors: []string{"mirror.example.com:5000/bundles/combo", "backup.example.com/combo"}},
+		{Source: "registry.redhat.io", Mirrors: []string{"mirror.example.com:5000/redhat"}},
+		{Source: "docker.io/library", Mirrors: []string{"mirror.example.com:5000/library"}},
+		{Source: "quay.io/empty"},
+	}
+
+	for _, tt := range []struct {
+		name  string
+		image string
+		want  string
+	}{
+		{
+			name:  "most specific source wins",
+			image: "quay.io/combo/bundle@" + digest,
+			want:  "mirror.example.com:5000/bundles/combo@" + digest,
+		},
+		{
+			name:  "namespace source",
+			image: "quay.io/combo/other@" + digest,
+			want:  "mirror.example.com:5000/combo/other@" + digest,
+		},
+		{
+			name:  "registry source",
+			image: "registry.redhat.io/openshift4/ose-bundle@" + digest,
+			want:  "mirror.example.com:5000/redhat/openshift4/ose-bundle@" + digest,
+		},
+		{
+			name:  "implicit docker.io registry",
+			image: "busybox@" + digest,
+			want:  "mirror.example.com:5000/library/busybox@" + digest,
+		},
+		{
+			name:  "source is only a prefix of the repository name",
+			image: "quay.io/combo-other/bundle@" + digest,
+			want:  "quay.io/combo-other/bundle@" + digest,
+		},
+		{
+			name:  "source without mirrors",
+			image: "quay.io/empty/bundle@" + digest,
+			want:  "quay.io/empty/bundle@" + digest,
+		},
+		{
+			name:  "tags aren't rewritten",
+			image: "quay.io/combo/bundle:v0.0.1",
+			want:  "quay.io/combo/bundle:v0.0.1",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Rewrite(tt.image, mirrors)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestLocations(t *testing.T) {
+	mirrors := []Mirror{
+		{Source: "quay.io/combo", Mirrors: []string{"mirror.example.com:5000/combo", "backup.example.com/combo"}},
+	}
+
+	for _, tt := range []struct {
+		name  string
+		image string
+		want  []string
+	}{
+		{
+			name:  "digest",
+			image: "quay.io/combo/bundle@" + digest,
+			want: []string{
+				"mirror.example.com:5000/combo/bundle@" + digest,
+				"backup.example.com/combo/bundle@" + digest,
+				"quay.io/combo/bundle@" + digest,
+			},
+		},
+		{
+			name:  "tag",
+			image: "quay.io/combo/bundle:v0.0.1",
+			want:  []string{"quay.io/combo/bundle:v0.0.1"},
+		},
+		{
+			name:  "not mirrored",
+			image: "quay.io/other/bundle:v0.0.1",
+			want:  []string{"quay.io/other/bundle:v0.0.1"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Locations(tt.image, mirrors)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func newMirrorObject(kind, apiVersion, field string, mirrors ...Mirror) *unstructured.Unstructured {
+	var entries []interface{}
+	for _, m := range mirrors {
+		locations := make([]interface{}, 0, len(m.Mirrors))
+		for _, l := range m.Mirrors {
+			locations = append(locations, l)
+		}
+		entries = append(entries, map[string]interface{}{"source": m.Source, "mirrors": locations})
+	}
+	u := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{field: entries},
+	}}
+	u.SetAPIVersion(apiVersion)
+	u.SetKind(kind)
+	u.SetName(kind)
+	return u
+}
+
+func TestClusterRewriter(t *testing.T) {
+	icsp := newMirrorObject("ImageContentSourcePolicy", "operator.openshift.io/v1alpha1", "repositoryDigestMirrors",
+		Mirror{Source: "quay.io/combo", Mirrors: []string{"icsp.example.com/combo"}})
+	idms := newMirrorObject("ImageDigestMirrorSet", "config.openshift.io/v1", "imageDigestMirrors",
+		Mirror{Source: "quay.io/prometheus", Mirrors: []string{"idms.example.com/prometheus"}})
+	c := fake.NewClientBuilder().WithScheme(runtime.NewScheme()).WithObjects(icsp, idms).Build()
+
+	r := NewClusterRewriter(c, []Mirror{{Source: "quay.io/combo", Mirrors: []string{"static.example.com/combo"}}})
+	for image, want := range map[string]string{
+		"quay.io/combo/bundle@" + digest:      "static.example.com/combo/bundle@" + digest,
+		"quay.io/prometheus/bundle@" + digest: "idms.example.com/prometheus/bundle@" + digest,
+		"quay.io/other/bundle@" + digest:      "quay.io/other/bundle@" + digest,
+	} {
+		got, err := r.Rewrite(context.Background(), image)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got != want {
+			t.Errorf("expected %s to be rewritten to %s, got %s", image, want, got)
+		}
+	}
+
+	r = NewClusterRewriter(c, nil)
+	if got, err := r.Rewrite(context.Background(), "quay.io/combo/bundle@"+digest); err != nil || got != "icsp.example.com/combo/bundle@"+digest {
+		t.Errorf("expected the ImageContentSourcePolicy mirror to be used, got %s: %v", got, err)
+	}
+}
@@ -0,0 +1,18 @@
+package resolver
+
+import (
+	"context"
+	"fmt"
+)
+
+// Fake is a Resolver that resolves images from a static mapping of image
+// references to digests.
+type Fake map[string]string
+
+func (f Fake) Resolve(_ context.Context, image string) (string, error) {
+	digest, ok := f[image]
+	if !ok {
+		return "", fmt.Errorf("failed to resolve the digest of the %s image: not found", image)
+	}
+	return digest, nil
+}
@@ -0,0 +1,65 @@
+package resolver
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+
+	"github.com/openshift/platform-operators/internal/util"
+)
+
+// Resolver resolves a possibly mutable image reference to the digest it
+// currently points to.
+type Resolver interface {
+	Resolve(ctx context.Context, image string) (string, error)
+}
+
+type registryResolver struct {
+	opts []remote.Option
+}
+
+// NewRegistryResolver returns a Resolver that looks up image digests by querying
+// the image's registry. Tags are always resolved against the image's own
+// registry: mirrors are only trusted to serve the content of a digest, and a
+// mirror lagging behind its source would pin an older image.
+func NewRegistryResolver(opts ...remote.Option) Resolver {
+	return &registryResolver{
+		opts: opts,
+	}
+}
+
+func (r registryResolver) Resolve(ctx context.Context, image string) (string, error) {
+	ref, err := name.ParseReference(image)
+	if err != nil {
+		return "", util.NewPermanentError(fmt.Errorf("invalid image reference %q: %w", image, err))
+	}
+	if digest, ok := ref.(name.Digest); ok {
+		return digest.DigestStr(), nil
+	}
+	desc, err := remote.Head(ref, append([]remote.Option{remote.WithContext(ctx)}, r.opts...)...)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve the digest of the %s image: %w", image, err)
+	}
+	return desc.Digest.String(), nil
+}
+
+// Pin returns the reference to the image's repository at the provided digest.
+func Pin(image, digest string) (string, error) {
+	ref, err := name.ParseReference(image)
+	if err != nil {
+		return "", err
+	}
+	pinned, err := name.NewDigest(ref.Context().Name() + "@" + digest)
+	if err != nil {
+		return "", err
+	}
+	return pinned.String(), nil
+}
+
+// IsDigest returns whether the image reference is pinned to a digest.
+func IsDigest(image string) bool {
+	_, err := name.NewDigest(image)
+	return err == nil
+}
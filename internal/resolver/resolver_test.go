@@ -0,0 +1,63 @@
+package resolver
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+func TestRegistryResolver(t *testing.T) {
+	srv := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	defer srv.Close()
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	image := u.Host + "/combo/bundle:v0.0.1"
+
+	img, err := random.Image(64, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := name.ParseReference(image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(ref, img); err != nil {
+		t.Fatal(err)
+	}
+	want, err := img.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewRegistryResolver()
+	digest, err := r.Resolve(context.Background(), image)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if digest != want.String() {
+		t.Errorf("expected %s, got %s", want, digest)
+	}
+
+	pinned, err := Pin(image, digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsDigest(pinned) || pinned != u.Host+"/combo/bundle@"+want.String() {
+		t.Errorf("unexpected pinned reference %s", pinned)
+	}
+	// Digest references are returned as-is without querying the registry.
+	srv.Close()
+	if digest, err := r.Resolve(context.Background(), pinned); err != nil || digest != want.String() {
+		t.Errorf("expected %s to resolve to its own digest, got %s: %v", pinned, digest, err)
+	}
+}
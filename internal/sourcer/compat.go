@@ -0,0 +1,123 @@
+package sourcer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/blang/semver/v4"
+	"github.com/operator-framework/operator-registry/alpha/property"
+
+	platformv1alpha1 "github.com/openshift/platform-operators/api/v1alpha1"
+	"github.com/openshift/platform-operators/internal/clusterversion"
+)
+
+const (
+	// TypeMaxOpenShiftVersion is the olm.bundle property declaring the newest
+	// minor version of OpenShift the bundle is compatible with.
+	TypeMaxOpenShiftVersion = "olm.maxOpenShiftVersion"
+)
+
+type compatibility struct {
+	versions clusterversion.Getter
+}
+
+// NewCompatibilityFilter returns a Filter that excludes the candidates that
+// aren't compatible with the version of the running cluster, as declared by their
+// olm.maxOpenShiftVersion property and their ClusterServiceVersion's minKubeVersion.
+func NewCompatibilityFilter(versions clusterversion.Getter) Filter {
+	return &compatibility{
+		versions: versions,
+	}
+}
+
+func (c compatibility) Filter(ctx context.Context, _ *platformv1alpha1.PlatformOperator, candidates []Bundle) ([]Bundle, []Exclusion, error) {
+	if len(candidates) == 0 {
+		return nil, nil, nil
+	}
+	versions, err := c.versions.Get(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		kept     []Bundle
+		excluded []Exclusion
+	)
+	for _, b := range candidates {
+		if reason := incompatibility(b, versions); reason != "" {
+			excluded = append(excluded, Exclusion{Bundle: b, Reason: reason})
+			continue
+		}
+		kept = append(kept, b)
+	}
+	return kept, excluded, nil
+}
+
+// incompatibility returns why the bundle can't run on a cluster with the
+// versions, or an empty string when it's compatible.
+func incompatibility(b Bundle, versions *clusterversion.Versions) string {
+	if b.MinKubeVersion != "" {
+		min, err := semver.ParseTolerant(b.MinKubeVersion)
+		if err != nil {
+			return fmt.Sprintf("invalid minKubeVersion %q: %v", b.MinKubeVersion, err)
+		}
+		if versions.Kube.LT(min) {
+			return fmt.Sprintf("requires Kubernetes %s or newer, but the cluster runs %s", min, versions.Kube)
+		}
+	}
+	if versions.OpenShift == nil {
+		return ""
+	}
+	max, err := MaxOpenShiftVersion(b.Properties)
+	if err != nil {
+		return err.Error()
+	}
+	if max != nil && !SupportsOpenShiftVersion(*max, *versions.OpenShift) {
+		return fmt.Sprintf("supports OpenShift %d.%d at most, but the cluster runs %s", max.Major, max.Minor, versions.OpenShift)
+	}
+	return ""
+}
+
+// SupportsOpenShiftVersion returns whether a bundle with the max OpenShift
+// version can run on the cluster version. Only the major and minor versions are
+// compared, so a bundle supporting 4.12 is compatible with every 4.12.z release.
+func SupportsOpenShiftVersion(max, cluster semver.Version) bool {
+	if cluster.Major != max.Major {
+		return cluster.Major < max.Major
+	}
+	return cluster.Minor <= max.Minor
+}
+
+// MaxOpenShiftVersion returns the version declared by the olm.maxOpenShiftVersion
+// property, or nil when the property isn't declared.
+func MaxOpenShiftVersion(props []property.Property) (*semver.Version, error) {
+	var declared []string
+	for _, p := range props {
+		if p.Type != TypeMaxOpenShiftVersion {
+			continue
+		}
+		// The value is typically a string, but is commonly a number as well, which
+		// must not lose trailing zeros, e.g. 4.10.
+		var value interface{}
+		d := json.NewDecoder(bytes.NewReader(p.Value))
+		d.UseNumber()
+		if err := d.Decode(&value); err != nil {
+			return nil, fmt.Errorf("invalid %s property: %w", TypeMaxOpenShiftVersion, err)
+		}
+		declared = append(declared, fmt.Sprint(value))
+	}
+	switch len(declared) {
+	case 0:
+		return nil, nil
+	case 1:
+	default:
+		return nil, fmt.Errorf("expected at most one %s property, found %d", TypeMaxOpenShiftVersion, len(declared))
+	}
+	v, err := semver.ParseTolerant(declared[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s property %q: %w", TypeMaxOpenShiftVersion, declared[0], err)
+	}
+	return &v, nil
+}
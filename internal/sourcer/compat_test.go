@@ -0,0 +1,124 @@
+package sourcer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/blang/semver/v4"
+	"github.com/operator-framework/operator-registry/alpha/property"
+
+	"github.com/openshift/platform-operators/internal/clusterversion"
+	"github.com/openshift/platform-operators/internal/util"
+)
+
+func maxOpenShiftVersionProperty(value string) []property.Property {
+	return []property.Property{{Type: TypeMaxOpenShiftVersion, Value: json.RawMessage(value)}}
+}
+
+func TestCompatibilityFilter(t *testing.T) {
+	ocp := semver.MustParse("4.12.3")
+	openshift := clusterversion.Static{OpenShift: &ocp, Kube: semver.MustParse("1.25.4")}
+	kubernetes := clusterversion.Static{Kube: semver.MustParse("1.25.4")}
+
+	for _, tt := range []struct {
+		name     string
+		versions clusterversion.Getter
+		bundle   Bundle
+		wantKept bool
+	}{
+		{
+			name:     "no compatibility properties",
+			versions: openshift,
+			bundle:   Bundle{Version: "0.0.1"},
+			wantKept: true,
+		},
+		{
+			name:     "max OpenShift version as a string",
+			versions: openshift,
+			bundle:   Bundle{Version: "0.0.1", Properties: maxOpenShiftVersionProperty(`"4.12"`)},
+			wantKept: true,
+		},
+		{
+			name:     "max OpenShift version older than the cluster",
+			versions: openshift,
+			bundle:   Bundle{Version: "0.0.1", Properties: maxOpenShiftVersionProperty(`"4.11"`)},
+		},
+		{
+			name:     "max OpenShift version as a number with a trailing zero",
+			versions: openshift,
+			bundle:   Bundle{Version: "0.0.1", Properties: maxOpenShiftVersionProperty(`4.10`)},
+		},
+		{
+			name:     "max OpenShift version ignored outside of OpenShift",
+			versions: kubernetes,
+			bundle:   Bundle{Version: "0.0.1", Properties: maxOpenShiftVersionProperty(`"4.11"`)},
+			wantKept: true,
+		},
+		{
+			name:     "min Kubernetes version satisfied",
+			versions: kubernetes,
+			bundle:   Bundle{Version: "0.0.1", MinKubeVersion: "1.25.0"},
+			wantKept: true,
+		},
+		{
+			name:     "min Kubernetes version newer than the cluster",
+			versions: kubernetes,
+			bundle:   Bundle{Version: "0.0.1", MinKubeVersion: "1.26.0"},
+		},
+		{
+			name:     "invalid max OpenShift version",
+			versions: openshift,
+			bundle:   Bundle{Version: "0.0.1", Properties: maxOpenShiftVersionProperty(`"latest"`)},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			kept, excluded, err := NewCompatibilityFilter(tt.versions).Filter(context.Background(), nil, []Bundle{tt.bundle})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if gotKept := len(kept) == 1; gotKept != tt.wantKept {
+				t.Errorf("expected kept to be %t, got %t (excluded: %v)", tt.wantKept, gotKept, excluded)
+			}
+			if len(kept)+len(excluded) != 1 {
+				t.Errorf("expected the bundle to be either kept or excluded, got %v and %v", kept, excluded)
+			}
+		})
+	}
+}
+
+func TestFilteredSourcerExplainsExclusions(t *testing.T) {
+	ocp := semver.MustParse("4.13.0")
+	s := NewFilteredSourcer(
+		staticSourcer{bundle: &Bundle{Version: "0.0.1", Image: "quay.io/combo/bundle:v0.0.1", Properties: maxOpenShiftVersionProperty(`"4.12"`)}},
+		NewCompatibilityFilter(clusterversion.Static{OpenShift: &ocp, Kube: semver.MustParse("1.26.0")}),
+	)
+
+	_, err := s.Source(context.Background(), newPlatformOperator("combo"))
+	var notFound *util.PackageNotFoundError
+	if !errors.As(err, &notFound) {
+		t.Fatalf("expected a package not found error, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "supports OpenShift 4.12 at most") {
+		t.Errorf("expected the error to explain the exclusion, got %q", err)
+	}
+}
+
+func TestSupportsOpenShiftVersion(t *testing.T) {
+	for _, tt := range []struct {
+		max, cluster string
+		want         bool
+	}{
+		{max: "4.12.0", cluster: "4.12.9", want: true},
+		{max: "4.12.0", cluster: "4.11.0", want: true},
+		{max: "4.12.0", cluster: "4.13.0", want: false},
+		{max: "4.12.0", cluster: "5.0.0", want: false},
+		{max: "5.0.0", cluster: "4.20.0", want: true},
+	} {
+		if got := SupportsOpenShiftVersion(semver.MustParse(tt.max), semver.MustParse(tt.cluster)); got != tt.want {
+			t.Errorf("expected a bundle supporting %s on %s to be %t, got %t", tt.max, tt.cluster, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package sourcer
+
+import (
+	"context"
+	"fmt"
+
+	utilerror "k8s.io/apimachinery/pkg/util/errors"
+
+	platformv1alpha1 "github.com/openshift/platform-operators/api/v1alpha1"
+)
+
+// MergePolicy determines how the results of chained sourcers are combined.
+type MergePolicy string
+
+const (
+	// MergePolicyFirstWins uses the bundle from the first sourcer, in order, that
+	// successfully sources one. Later sourcers act as fallbacks.
+	MergePolicyFirstWins MergePolicy = "first-wins"
+	// MergePolicyHighestVersion queries every sourcer and uses the bundle with the
+	// highest version. Ties are broken by catalog priority and then bundle name.
+	MergePolicyHighestVersion MergePolicy = "highest-version"
+)
+
+// NamedSourcer is a Sourcer that is identified by the name recorded as the
+// origin of the bundles it sources.
+type NamedSourcer struct {
+	Name string
+	Sourcer
+}
+
+type composite struct {
+	policy   MergePolicy
+	sourcers []NamedSourcer
+}
+
+// NewCompositeSourcer returns a Sourcer that chains the ordered list of sourcers
+// together using the merge policy.
+func NewCompositeSourcer(policy MergePolicy, sourcers ...NamedSourcer) (Sourcer, error) {
+	switch policy {
+	case MergePolicyFirstWins, MergePolicyHighestVersion:
+	default:
+		return nil, fmt.Errorf("unknown merge policy %q", policy)
+	}
+	if len(sourcers) == 0 {
+		return nil, fmt.Errorf("at least one sourcer must be specified")
+	}
+	return &composite{
+		policy:   policy,
+		sourcers: sourcers,
+	}, nil
+}
+
+func (c composite) Source(ctx context.Context, po *platformv1alpha1.PlatformOperator) (*Bundle, error) {
+	candidates, err := c.Candidates(ctx, po)
+	if err != nil {
+		return nil, err
+	}
+	return latest(po, candidates)
+}
+
+func (c composite) Candidates(ctx context.Context, po *platformv1alpha1.PlatformOperator) ([]Bundle, error) {
+	if err := validate(po); err != nil {
+		return nil, err
+	}
+
+	var (
+		errs       []error
+		candidates bundles
+	)
+	for _, s := range c.sourcers {
+		found, err := candidatesOf(ctx, s, po)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", s.Name, err))
+			continue
+		}
+		for i := range found {
+			if found[i].Origin == "" {
+				found[i].Origin = s.Name
+			}
+		}
+		if c.policy == MergePolicyFirstWins && len(found) != 0 {
+			return found, nil
+		}
+		candidates = append(candidates, found...)
+	}
+
+	// A sourcer that failed may have served a higher version, so don't settle for
+	// the candidates of the remaining sourcers when merging by version.
+	if len(errs) != 0 {
+		return nil, utilerror.NewAggregate(errs)
+	}
+	return candidates, nil
+}
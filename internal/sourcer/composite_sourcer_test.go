@@ -0,0 +1,125 @@
+package sourcer
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	platformv1alpha1 "github.com/openshift/platform-operators/api/v1alpha1"
+	"github.com/openshift/platform-operators/internal/util"
+)
+
+type staticSourcer struct {
+	bundle *Bundle
+	err    error
+}
+
+func (s staticSourcer) Source(context.Context, *platformv1alpha1.PlatformOperator) (*Bundle, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	b := *s.bundle
+	return &b, nil
+}
+
+func TestCompositeSource(t *testing.T) {
+	var (
+		notFound    = staticSourcer{err: &util.PackageNotFoundError{Package: "combo"}}
+		unavailable = staticSourcer{err: errors.New("catalog unavailable")}
+		older       = staticSourcer{bundle: &Bundle{Version: "0.0.1", Image: "internal/combo:v0.0.1"}}
+		newer       = staticSourcer{bundle: &Bundle{Version: "0.0.2", Image: "cluster/combo:v0.0.2"}}
+		sameVersion = staticSourcer{bundle: &Bundle{Version: "0.0.1", Image: "cluster/combo:v0.0.1", CatalogPriority: 10}}
+	)
+
+	for _, tt := range []struct {
+		name         string
+		policy       MergePolicy
+		sourcers     []NamedSourcer
+		wantImage    string
+		wantOrigin   string
+		wantNotFound bool
+		wantErr      bool
+	}{
+		{
+			name:       "first wins prefers the first sourcer",
+			policy:     MergePolicyFirstWins,
+			sourcers:   []NamedSourcer{{"internal", older}, {"cluster", newer}},
+			wantImage:  "internal/combo:v0.0.1",
+			wantOrigin: "internal",
+		},
+		{
+			name:       "first wins falls back when the package isn't found",
+			policy:     MergePolicyFirstWins,
+			sourcers:   []NamedSourcer{{"internal", notFound}, {"cluster", newer}},
+			wantImage:  "cluster/combo:v0.0.2",
+			wantOrigin: "cluster",
+		},
+		{
+			name:       "first wins falls back when a sourcer fails",
+			policy:     MergePolicyFirstWins,
+			sourcers:   []NamedSourcer{{"internal", unavailable}, {"cluster", newer}},
+			wantImage:  "cluster/combo:v0.0.2",
+			wantOrigin: "cluster",
+		},
+		{
+			name:       "highest version merges across sourcers",
+			policy:     MergePolicyHighestVersion,
+			sourcers:   []NamedSourcer{{"internal", older}, {"cluster", newer}},
+			wantImage:  "cluster/combo:v0.0.2",
+			wantOrigin: "cluster",
+		},
+		{
+			name:       "highest version breaks ties by catalog priority",
+			policy:     MergePolicyHighestVersion,
+			sourcers:   []NamedSourcer{{"internal", older}, {"cluster", sameVersion}},
+			wantImage:  "cluster/combo:v0.0.1",
+			wantOrigin: "cluster",
+		},
+		{
+			name:       "highest version ignores sourcers without the package",
+			policy:     MergePolicyHighestVersion,
+			sourcers:   []NamedSourcer{{"internal", notFound}, {"cluster", older}},
+			wantImage:  "internal/combo:v0.0.1",
+			wantOrigin: "cluster",
+		},
+		{
+			name:     "highest version fails when a sourcer fails",
+			policy:   MergePolicyHighestVersion,
+			sourcers: []NamedSourcer{{"internal", older}, {"cluster", unavailable}},
+			wantErr:  true,
+		},
+		{
+			name:         "package not found in any sourcer",
+			policy:       MergePolicyFirstWins,
+			sourcers:     []NamedSourcer{{"internal", notFound}, {"cluster", notFound}},
+			wantNotFound: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewCompositeSourcer(tt.policy, tt.sourcers...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := s.Source(context.Background(), newPlatformOperator("combo"))
+			if tt.wantNotFound {
+				var notFoundErr *util.PackageNotFoundError
+				if !errors.As(err, &notFoundErr) {
+					t.Fatalf("expected a package not found error, got %v", err)
+				}
+				return
+			}
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", b)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if b.Image != tt.wantImage || b.Origin != tt.wantOrigin {
+				t.Errorf("expected %s from %s, got %s from %s", tt.wantImage, tt.wantOrigin, b.Image, b.Origin)
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package sourcer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/operator-framework/operator-registry/alpha/declcfg"
+	"github.com/operator-framework/operator-registry/alpha/property"
+
+	platformv1alpha1 "github.com/openshift/platform-operators/api/v1alpha1"
+)
+
+const (
+	// TypeDeprecated is the olm.bundle property that marks a bundle deprecated.
+	TypeDeprecated = "olm.deprecated"
+	// SchemaDeprecations is the file-based catalog schema that lists the
+	// deprecated packages, channels and bundles of a package.
+	SchemaDeprecations = "olm.deprecations"
+
+	schemaPackage = "olm.package"
+	schemaChannel = "olm.channel"
+	schemaBundle  = "olm.bundle"
+)
+
+// Deprecation is a catalog's notice that a package, channel or bundle is
+// deprecated.
+type Deprecation struct {
+	// Schema is the type of content that's deprecated, i.e. olm.package,
+	// olm.channel or olm.bundle.
+	Schema  string
+	Message string
+}
+
+// DeprecationMessage joins the messages of the catalog's deprecation notices for
+// the bundle, and is empty when the bundle isn't deprecated.
+func (b Bundle) DeprecationMessage() string {
+	messages := make([]string, 0, len(b.Deprecations))
+	for _, d := range b.Deprecations {
+		messages = append(messages, d.Message)
+	}
+	return strings.Join(messages, "; ")
+}
+
+type deprecationFilter struct{}
+
+// NewDeprecationFilter returns a Filter that excludes deprecated candidates,
+// unless they're pinned by spec.version or are the version that's already
+// installed, so new installs never land on content the catalog has deprecated.
+func NewDeprecationFilter() Filter {
+	return deprecationFilter{}
+}
+
+func (deprecationFilter) Filter(_ context.Context, po *platformv1alpha1.PlatformOperator, candidates []Bundle) ([]Bundle, []Exclusion, error) {
+	var (
+		kept     []Bundle
+		excluded []Exclusion
+	)
+	for _, b := range candidates {
+		if len(b.Deprecations) == 0 || pinned(po, b.Version) || installed(po, b.Version) {
+			kept = append(kept, b)
+			continue
+		}
+		excluded = append(excluded, Exclusion{
+			Bundle: b,
+			Reason: fmt.Sprintf("deprecated versions are only selected when pinned by spec.version: %s", b.DeprecationMessage()),
+		})
+	}
+	return kept, excluded, nil
+}
+
+func installed(po *platformv1alpha1.PlatformOperator, version string) bool {
+	return po.Status.ActiveBundle != nil && sameVersion(po.Status.ActiveBundle.Version, version)
+}
+
+// deprecationIndex holds the olm.deprecations entries of a single package.
+type deprecationIndex struct {
+	pkg      *Deprecation
+	channels map[string]Deprecation
+	bundles  map[string]Deprecation
+}
+
+type deprecationsBlob struct {
+	Package string `json:"package"`
+	Entries []struct {
+		Reference struct {
+			Schema string `json:"schema"`
+			Name   string `json:"name"`
+		} `json:"reference"`
+		Message string `json:"message"`
+	} `json:"entries"`
+}
+
+// deprecationsFromDeclarativeConfig indexes the olm.deprecations entries that the
+// file-based catalog declares for the package.
+func deprecationsFromDeclarativeConfig(cfg *declcfg.DeclarativeConfig, packageName string) (*deprecationIndex, error) {
+	idx := &deprecationIndex{
+		channels: make(map[string]Deprecation),
+		bundles:  make(map[string]Deprecation),
+	}
+	for _, meta := range cfg.Others {
+		if meta.Schema != SchemaDeprecations || meta.Package != packageName {
+			continue
+		}
+		var blob deprecationsBlob
+		if err := json.Unmarshal(meta.Blob, &blob); err != nil {
+			return nil, fmt.Errorf("failed to parse the %s %s: %w", packageName, SchemaDeprecations, err)
+		}
+		for _, e := range blob.Entries {
+			d := Deprecation{Schema: e.Reference.Schema, Message: e.Message}
+			if d.Message == "" {
+				name := e.Reference.Name
+				if name == "" {
+					name = packageName
+				}
+				d.Message = fmt.Sprintf("%s %s is deprecated", e.Reference.Schema, name)
+			}
+			switch e.Reference.Schema {
+			case schemaPackage:
+				idx.pkg = &d
+			case schemaChannel:
+				idx.channels[e.Reference.Name] = d
+			case schemaBundle:
+				idx.bundles[e.Reference.Name] = d
+			default:
+				return nil, fmt.Errorf("the %s %s references the unknown %q schema", packageName, SchemaDeprecations, e.Reference.Schema)
+			}
+		}
+	}
+	return idx, nil
+}
+
+// For returns the deprecations that apply to the bundle in the channel, starting
+// with the broadest.
+func (idx *deprecationIndex) For(channel, bundle string) []Deprecation {
+	var out []Deprecation
+	if idx.pkg != nil {
+		out = append(out, *idx.pkg)
+	}
+	if d, ok := idx.channels[channel]; ok {
+		out = append(out, d)
+	}
+	if d, ok := idx.bundles[bundle]; ok {
+		out = append(out, d)
+	}
+	return out
+}
+
+// deprecationFromProperties returns the deprecation declared by the bundle's
+// olm.deprecated property, if any. The property doesn't carry a message of its
+// own, so one is made up from the bundle's name.
+func deprecationFromProperties(name string, props []property.Property) *Deprecation {
+	for _, p := range props {
+		if p.Type == TypeDeprecated {
+			return &Deprecation{
+				Schema:  schemaBundle,
+				Message: fmt.Sprintf("olm.bundle %s is deprecated", name),
+			}
+		}
+	}
+	return nil
+}
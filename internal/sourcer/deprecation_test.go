@@ -0,0 +1,141 @@
+package sourcer
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/operator-framework/operator-registry/alpha/declcfg"
+
+	platformv1alpha1 "github.com/openshift/platform-operators/api/v1alpha1"
+)
+
+const testDeprecations = `---
+schema: olm.deprecations
+package: combo
+entries:
+- reference:
+    schema: olm.bundle
+    name: combo.v0.0.2
+  message: combo.v0.0.2 has a critical bug, use combo.v0.0.1 instead
+`
+
+func TestDeprecationsFromDeclarativeConfig(t *testing.T) {
+	for _, tt := range []struct {
+		name         string
+		catalog      string
+		wantMessages map[string]string
+	}{
+		{
+			name:         "no deprecations",
+			catalog:      testCatalog,
+			wantMessages: map[string]string{"combo.v0.0.1": "", "combo.v0.0.2": ""},
+		},
+		{
+			name:    "deprecated bundle",
+			catalog: testCatalog + testDeprecations,
+			wantMessages: map[string]string{
+				"combo.v0.0.1": "",
+				"combo.v0.0.2": "combo.v0.0.2 has a critical bug, use combo.v0.0.1 instead",
+			},
+		},
+		{
+			name: "deprecated package and channel",
+			catalog: testCatalog + `---
+schema: olm.deprecations
+package: combo
+entries:
+- reference:
+    schema: olm.package
+  message: combo is no longer maintained
+- reference:
+    schema: olm.channel
+    name: "4.12"
+`,
+			wantMessages: map[string]string{
+				"combo.v0.0.1": "combo is no longer maintained; olm.channel 4.12 is deprecated",
+				"combo.v0.0.2": "combo is no longer maintained; olm.channel 4.12 is deprecated",
+			},
+		},
+		{
+			name: "deprecated bundle property",
+			catalog: strings.Replace(testCatalog, `properties:
+- type: olm.package
+  value:
+    packageName: combo
+    version: 0.0.1`, `properties:
+- type: olm.deprecated
+  value: {}
+- type: olm.package
+  value:
+    packageName: combo
+    version: 0.0.1`, 1),
+			wantMessages: map[string]string{"combo.v0.0.1": "olm.bundle combo.v0.0.1 is deprecated", "combo.v0.0.2": ""},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := declcfg.LoadFS(fstest.MapFS{"catalog.yaml": &fstest.MapFile{Data: []byte(tt.catalog)}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			candidates, err := candidatesFromDeclarativeConfig(cfg, "combo", "test")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got := make(map[string]string)
+			for _, b := range candidates {
+				got[b.Name] = b.DeprecationMessage()
+			}
+			for name, want := range tt.wantMessages {
+				if got[name] != want {
+					t.Errorf("expected %s to have the %q deprecation message, got %q", name, want, got[name])
+				}
+			}
+		})
+	}
+}
+
+func TestDeprecationFilter(t *testing.T) {
+	deprecated := Bundle{Version: "0.0.2", Deprecations: []Deprecation{{Schema: schemaBundle, Message: "critical bug"}}}
+	candidates := []Bundle{{Version: "0.0.1"}, deprecated}
+
+	for _, tt := range []struct {
+		name        string
+		version     string
+		installed   string
+		wantVersion string
+	}{
+		{name: "new install skips deprecated versions", wantVersion: "0.0.1"},
+		{name: "pinned deprecated version", version: "0.0.2", wantVersion: "0.0.2"},
+		{name: "pinned version tolerates a leading v", version: "v0.0.2", wantVersion: "0.0.2"},
+		{name: "installed deprecated version", installed: "0.0.2", wantVersion: "0.0.2"},
+		{name: "installed version doesn't upgrade onto deprecated versions", installed: "0.0.1", wantVersion: "0.0.1"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			po := newPlatformOperator("combo")
+			po.Spec.Version = tt.version
+			if tt.installed != "" {
+				po.Status.ActiveBundle = &platformv1alpha1.ActiveBundle{Version: tt.installed}
+			}
+			s := NewFilteredSourcer(staticCandidates(candidates), NewDeprecationFilter())
+			b, err := s.Source(context.Background(), po)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if b.Version != tt.wantVersion {
+				t.Errorf("expected version %s to be selected, got %s", tt.wantVersion, b.Version)
+			}
+		})
+	}
+}
+
+type staticCandidates []Bundle
+
+func (s staticCandidates) Source(ctx context.Context, po *platformv1alpha1.PlatformOperator) (*Bundle, error) {
+	return latest(po, bundles(s))
+}
+
+func (s staticCandidates) Candidates(context.Context, *platformv1alpha1.PlatformOperator) ([]Bundle, error) {
+	return s, nil
+}
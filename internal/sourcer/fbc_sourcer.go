@@ -0,0 +1,147 @@
+package sourcer
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"testing/fstest"
+
+	"github.com/operator-framework/operator-registry/alpha/declcfg"
+	"github.com/operator-framework/operator-registry/alpha/property"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	platformv1alpha1 "github.com/openshift/platform-operators/api/v1alpha1"
+)
+
+// fileBasedCatalog sources olm.bundle content directly from file-based catalog
+// (FBC) blobs, without requiring OLM or a CatalogSource registry pod.
+type fileBasedCatalog struct {
+	catalog string
+	load    func(context.Context) (fs.FS, error)
+}
+
+// NewFileBasedCatalogHandler returns a Sourcer that reads the FBC blobs found in
+// the dir directory. The directory is re-read every time content is sourced, so
+// updates to the catalog on disk are picked up on the next reconciliation.
+func NewFileBasedCatalogHandler(dir string) Sourcer {
+	return &fileBasedCatalog{
+		catalog: dir,
+		load: func(context.Context) (fs.FS, error) {
+			return os.DirFS(dir), nil
+		},
+	}
+}
+
+// NewConfigMapCatalogHandler returns a Sourcer that reads the FBC blobs stored in
+// the data keys of the referenced ConfigMap. The ConfigMap is read from the API
+// server every time content is sourced, so c should be an uncached reader, which
+// avoids caching every ConfigMap in the cluster to read a single one.
+func NewConfigMapCatalogHandler(c client.Reader, key types.NamespacedName) Sourcer {
+	return &fileBasedCatalog{
+		catalog: key.String(),
+		load: func(ctx context.Context) (fs.FS, error) {
+			cm := &corev1.ConfigMap{}
+			if err := c.Get(ctx, key, cm); err != nil {
+				return nil, fmt.Errorf("failed to get the %s catalog configmap: %w", key, err)
+			}
+			return configMapFS(cm.Data), nil
+		},
+	}
+}
+
+// configMapFS returns a read-only fs.FS of the data keys of a ConfigMap. ConfigMap
+// keys can't contain slashes, so every key is a file at the root.
+func configMapFS(data map[string]string) fs.FS {
+	fsys := make(fstest.MapFS, len(data))
+	for key, value := range data {
+		fsys[key] = &fstest.MapFile{Data: []byte(value), Mode: 0o444}
+	}
+	return fsys
+}
+
+func (f fileBasedCatalog) Source(ctx context.Context, po *platformv1alpha1.PlatformOperator) (*Bundle, error) {
+	candidates, err := f.Candidates(ctx, po)
+	if err != nil {
+		return nil, err
+	}
+	return latest(po, candidates)
+}
+
+func (f fileBasedCatalog) Candidates(ctx context.Context, po *platformv1alpha1.PlatformOperator) ([]Bundle, error) {
+	if err := validate(po); err != nil {
+		return nil, err
+	}
+	fsys, err := f.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := declcfg.LoadFS(fsys)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the %s file-based catalog: %w", f.catalog, err)
+	}
+	return candidatesFromDeclarativeConfig(cfg, po.Spec.PackageName, f.catalog)
+}
+
+// candidatesFromDeclarativeConfig returns the olm.bundles that are entries of the
+// package's supported channel in the file-based catalog.
+func candidatesFromDeclarativeConfig(cfg *declcfg.DeclarativeConfig, packageName, catalog string) (bundles, error) {
+	bundlesByName := make(map[string]declcfg.Bundle)
+	for _, b := range cfg.Bundles {
+		if b.Package == packageName {
+			bundlesByName[b.Name] = b
+		}
+	}
+
+	deprecations, err := deprecationsFromDeclarativeConfig(cfg, packageName)
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates bundles
+	for _, ch := range cfg.Channels {
+		if ch.Package != packageName || ch.Name != channelName {
+			continue
+		}
+		for _, entry := range ch.Entries {
+			b, ok := bundlesByName[entry.Name]
+			if !ok {
+				return nil, fmt.Errorf("channel %q of the %s package references the unknown %s olm.bundle", ch.Name, packageName, entry.Name)
+			}
+			props, err := property.Parse(b.Properties)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse the properties of the %s olm.bundle: %w", b.Name, err)
+			}
+			if len(props.Packages) != 1 {
+				return nil, fmt.Errorf("expected exactly one olm.package property for the %s olm.bundle, found %d", b.Name, len(props.Packages))
+			}
+			deprecated := deprecations.For(ch.Name, b.Name)
+			if _, ok := deprecations.bundles[b.Name]; !ok {
+				if d := deprecationFromProperties(b.Name, b.Properties); d != nil {
+					deprecated = append(deprecated, *d)
+				}
+			}
+			csv := csvFromObjects(props.BundleObjects)
+			candidates = append(candidates, Bundle{
+				Name:           b.Name,
+				Version:        props.Packages[0].Version,
+				Image:          b.Image,
+				Replaces:       entry.Replaces,
+				Skips:          entry.Skips,
+				Package:        packageName,
+				Channel:        ch.Name,
+				Catalog:        catalog,
+				MinKubeVersion: csv.Spec.MinKubeVersion,
+				Properties:     b.Properties,
+				ProvidedAPIs:   convertGVKs(props.GVKs),
+				RequiredAPIs:   convertGVKsRequired(props.GVKsRequired),
+				RelatedImages:  relatedImagesFromDeclarativeConfig(b, csv),
+				CSV:            csv.metadata(),
+				Deprecations:   deprecated,
+			})
+		}
+	}
+	return candidates, nil
+}
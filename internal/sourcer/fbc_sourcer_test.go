@@ -0,0 +1,105 @@
+package sourcer
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	platformv1alpha1 "github.com/openshift/platform-operators/api/v1alpha1"
+	"github.com/openshift/platform-operators/internal/util"
+)
+
+const testCatalog = `---
+schema: olm.package
+name: combo
+defaultChannel: "4.12"
+---
+schema: olm.channel
+package: combo
+name: "4.12"
+entries:
+- name: combo.v0.0.1
+- name: combo.v0.0.2
+  replaces: combo.v0.0.1
+---
+schema: olm.bundle
+name: combo.v0.0.1
+package: combo
+image: quay.io/combo/bundle:v0.0.1
+properties:
+- type: olm.package
+  value:
+    packageName: combo
+    version: 0.0.1
+---
+schema: olm.bundle
+name: combo.v0.0.2
+package: combo
+image: quay.io/combo/bundle:v0.0.2
+properties:
+- type: olm.package
+  value:
+    packageName: combo
+    version: 0.0.2
+`
+
+func newPlatformOperator(pkg string) *platformv1alpha1.PlatformOperator {
+	return &platformv1alpha1.PlatformOperator{
+		ObjectMeta: metav1.ObjectMeta{Name: pkg},
+		Spec:       platformv1alpha1.PlatformOperatorSpec{PackageName: pkg},
+	}
+}
+
+func TestFileBasedCatalogSourceFromDir(t *testing.T) {
+	s := NewFileBasedCatalogHandler(filepath.Join("..", "..", "config", "samples", "fbc", "sampleCatalog"))
+
+	b, err := s.Source(context.Background(), newPlatformOperator("combo"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if b.Version != "0.0.1" || b.Image != "docker.io/tyslaton/combo-platform-operator-bundle:v0.0.1" {
+		t.Errorf("unexpected bundle: %v", b)
+	}
+}
+
+func TestFileBasedCatalogSourceFromConfigMap(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "catalog", Namespace: "platform-operators-system"},
+		Data:       map[string]string{"catalog.yaml": testCatalog},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(cm).Build()
+	s := NewConfigMapCatalogHandler(c, types.NamespacedName{Name: "catalog", Namespace: "platform-operators-system"})
+
+	b, err := s.Source(context.Background(), newPlatformOperator("combo"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if b.Version != "0.0.2" || b.Replaces != "combo.v0.0.1" || b.Catalog != "platform-operators-system/catalog" {
+		t.Errorf("unexpected bundle: %v", b)
+	}
+
+	_, err = s.Source(context.Background(), newPlatformOperator("missing"))
+	var notFound *util.PackageNotFoundError
+	if !errors.As(err, &notFound) {
+		t.Errorf("expected a package not found error, got %v", err)
+	}
+}
+
+func TestConfigMapFS(t *testing.T) {
+	fsys := configMapFS(map[string]string{"catalog.yaml": testCatalog, ".indexignore": "README.md\n"})
+	if err := fstest.TestFS(fsys, "catalog.yaml", ".indexignore"); err != nil {
+		t.Fatal(err)
+	}
+}
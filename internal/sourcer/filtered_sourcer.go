@@ -0,0 +1,75 @@
+package sourcer
+
+import (
+	"context"
+	"fmt"
+
+	platformv1alpha1 "github.com/openshift/platform-operators/api/v1alpha1"
+)
+
+// Exclusion explains why a candidate olm.bundle was excluded.
+type Exclusion struct {
+	Bundle Bundle
+	Reason string
+}
+
+func (e Exclusion) String() string {
+	name := e.Bundle.Name
+	if name == "" {
+		name = e.Bundle.Version
+	}
+	return fmt.Sprintf("%s was excluded: %s", name, e.Reason)
+}
+
+// Filter narrows down the candidate olm.bundles for a PlatformOperator.
+type Filter interface {
+	Filter(context.Context, *platformv1alpha1.PlatformOperator, []Bundle) (kept []Bundle, excluded []Exclusion, err error)
+}
+
+type filtered struct {
+	Sourcer
+	filters []Filter
+}
+
+// NewFilteredSourcer returns a Sourcer that applies the filters, in order, to the
+// candidates listed by the sourcer before selecting one of them.
+func NewFilteredSourcer(s Sourcer, filters ...Filter) Sourcer {
+	return &filtered{
+		Sourcer: s,
+		filters: filters,
+	}
+}
+
+func (f filtered) Source(ctx context.Context, po *platformv1alpha1.PlatformOperator) (*Bundle, error) {
+	candidates, excluded, err := f.filter(ctx, po)
+	if err != nil {
+		return nil, err
+	}
+	return latest(po, candidates, excluded...)
+}
+
+func (f filtered) Candidates(ctx context.Context, po *platformv1alpha1.PlatformOperator) ([]Bundle, error) {
+	candidates, _, err := f.filter(ctx, po)
+	return candidates, err
+}
+
+func (f filtered) filter(ctx context.Context, po *platformv1alpha1.PlatformOperator) ([]Bundle, []Exclusion, error) {
+	if err := validate(po); err != nil {
+		return nil, nil, err
+	}
+	candidates, err := candidatesOf(ctx, f.Sourcer, po)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var excluded []Exclusion
+	for _, filter := range f.filters {
+		kept, dropped, err := filter.Filter(ctx, po, candidates)
+		if err != nil {
+			return nil, nil, err
+		}
+		candidates = kept
+		excluded = append(excluded, dropped...)
+	}
+	return candidates, excluded, nil
+}
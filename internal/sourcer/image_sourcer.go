@@ -0,0 +1,204 @@
+package sourcer
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/operator-framework/operator-registry/alpha/declcfg"
+	utilerror "k8s.io/apimachinery/pkg/util/errors"
+
+	platformv1alpha1 "github.com/openshift/platform-operators/api/v1alpha1"
+	"github.com/openshift/platform-operators/internal/util"
+)
+
+const (
+	// catalogConfigsDir is the directory that catalog images store their
+	// file-based catalog in, as advertised by the
+	// operators.operatorframework.io.index.configs.v1 label.
+	catalogConfigsDir = "configs"
+)
+
+// catalogImages sources olm.bundle content by pulling the file-based catalog
+// layer directly out of catalog images, without requiring OLM to run a registry
+// pod for each catalog. The extracted catalogs are cached on disk by digest, so
+// an image is only pulled again when its tag moves.
+type catalogImages struct {
+	images   []string
+	cacheDir string
+	opts     []remote.Option
+
+	mu sync.Mutex
+	// loaded holds the parsed catalog for the digest each image last resolved to.
+	loaded map[string]loadedCatalog
+}
+
+type loadedCatalog struct {
+	digest string
+	cfg    *declcfg.DeclarativeConfig
+}
+
+// NewCatalogImageHandler returns a Sourcer that reads the file-based catalogs
+// stored in the provided catalog images, caching their content under cacheDir.
+func NewCatalogImageHandler(images []string, cacheDir string, opts ...remote.Option) Sourcer {
+	return &catalogImages{
+		images:   images,
+		cacheDir: cacheDir,
+		opts:     opts,
+		loaded:   make(map[string]loadedCatalog),
+	}
+}
+
+func (c *catalogImages) Source(ctx context.Context, po *platformv1alpha1.PlatformOperator) (*Bundle, error) {
+	candidates, err := c.Candidates(ctx, po)
+	if err != nil {
+		return nil, err
+	}
+	return latest(po, candidates)
+}
+
+func (c *catalogImages) Candidates(ctx context.Context, po *platformv1alpha1.PlatformOperator) ([]Bundle, error) {
+	if err := validate(po); err != nil {
+		return nil, err
+	}
+
+	var (
+		errors     []error
+		candidates bundles
+	)
+	for _, image := range c.images {
+		cfg, err := c.load(ctx, image)
+		if err != nil {
+			errors = append(errors, fmt.Errorf("failed to load the %s catalog image: %w", image, err))
+			continue
+		}
+		found, err := candidatesFromDeclarativeConfig(cfg, po.Spec.PackageName, image)
+		if err != nil {
+			errors = append(errors, err)
+			continue
+		}
+		candidates = append(candidates, found...)
+	}
+	if len(errors) != 0 {
+		return nil, utilerror.NewAggregate(errors)
+	}
+	return candidates, nil
+}
+
+// load returns the file-based catalog that the image currently points to,
+// extracting it into the on-disk cache when that digest hasn't been seen before.
+func (c *catalogImages) load(ctx context.Context, image string) (*declcfg.DeclarativeConfig, error) {
+	ref, err := name.ParseReference(image)
+	if err != nil {
+		return nil, util.NewPermanentError(err)
+	}
+	opts := append([]remote.Option{remote.WithContext(ctx)}, c.opts...)
+	desc, err := remote.Head(ref, opts...)
+	if err != nil {
+		return nil, err
+	}
+	digest := desc.Digest.String()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if l, ok := c.loaded[image]; ok && l.digest == digest {
+		return l.cfg, nil
+	}
+	dir := filepath.Join(c.cacheDir, desc.Digest.Algorithm, desc.Digest.Hex)
+	if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+		if err := c.pull(ref.Context().Digest(digest), dir, opts); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	cfg, err := declcfg.LoadFS(os.DirFS(dir))
+	if err != nil {
+		return nil, err
+	}
+	c.loaded[image] = loadedCatalog{digest: digest, cfg: cfg}
+	return cfg, nil
+}
+
+// pull extracts the catalog's configs directory from the flattened image
+// filesystem into dir. The content is staged in a temporary directory that's
+// renamed into place, so a partially extracted catalog is never cached.
+func (c *catalogImages) pull(ref name.Digest, dir string, opts []remote.Option) error {
+	img, err := remote.Image(ref, opts...)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dir), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.MkdirTemp(filepath.Dir(dir), ".extract-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	rc := mutate.Extract(img)
+	defer rc.Close()
+
+	found := false
+	tr := tar.NewReader(rc)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		rel, ok := configsPath(hdr.Name)
+		if !ok || hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		found = true
+		if err := writeFile(filepath.Join(tmp, rel), tr); err != nil {
+			return err
+		}
+	}
+	if !found {
+		return fmt.Errorf("image %s doesn't contain a file-based catalog in the /%s directory", ref, catalogConfigsDir)
+	}
+	return os.Rename(tmp, dir)
+}
+
+// configsPath returns the path of a tar entry relative to the configs directory,
+// and whether the entry is located inside that directory at all.
+func configsPath(entry string) (string, bool) {
+	cleaned := path.Clean("/" + entry)
+	prefix := "/" + catalogConfigsDir + "/"
+	if !strings.HasPrefix(cleaned, prefix) {
+		return "", false
+	}
+	return filepath.FromSlash(strings.TrimPrefix(cleaned, prefix)), true
+}
+
+func writeFile(dst string, r io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	f, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
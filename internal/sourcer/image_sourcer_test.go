@@ -0,0 +1,141 @@
+package sourcer
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+)
+
+// pushCatalogImage pushes an image containing the catalog files under /configs
+// to the in-process registry and returns its digest.
+func pushCatalogImage(t *testing.T, ref string, files map[string]string) v1.Hash {
+	t.Helper()
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for path, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: path, Mode: 0o644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	layer, err := tarball.LayerFromReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := mutate.AppendLayers(empty.Image, layer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag, err := name.ParseReference(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(tag, img); err != nil {
+		t.Fatal(err)
+	}
+	digest, err := img.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return digest
+}
+
+func TestCatalogImageSource(t *testing.T) {
+	srv := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	defer srv.Close()
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	image := u.Host + "/catalogs/combo:latest"
+	cacheDir := t.TempDir()
+
+	digest := pushCatalogImage(t, image, map[string]string{
+		"configs/combo/catalog.yaml": testCatalog,
+		"etc/unrelated.yaml":         "not a catalog",
+	})
+	s := NewCatalogImageHandler([]string{image}, cacheDir)
+
+	b, err := s.Source(context.Background(), newPlatformOperator("combo"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if b.Version != "0.0.2" || b.Image != "quay.io/combo/bundle:v0.0.2" || b.Catalog != image {
+		t.Errorf("unexpected bundle: %v", b)
+	}
+	cached := filepath.Join(cacheDir, digest.Algorithm, digest.Hex)
+	if _, err := os.Stat(filepath.Join(cached, "combo", "catalog.yaml")); err != nil {
+		t.Errorf("expected the catalog to be cached by digest: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(cached, "etc")); !os.IsNotExist(err) {
+		t.Errorf("expected content outside of /configs to be ignored, got %v", err)
+	}
+
+	// Moving the tag to a new digest should result in the new catalog content being used.
+	updated := strings.Replace(testCatalog, "replaces: combo.v0.0.1", "replaces: combo.v0.0.1\n- name: combo.v0.0.3\n  replaces: combo.v0.0.2", 1) + `---
+schema: olm.bundle
+name: combo.v0.0.3
+package: combo
+image: quay.io/combo/bundle:v0.0.3
+properties:
+- type: olm.package
+  value:
+    packageName: combo
+    version: 0.0.3
+`
+	pushCatalogImage(t, image, map[string]string{"configs/catalog.yaml": updated})
+
+	b, err = s.Source(context.Background(), newPlatformOperator("combo"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if b.Version != "0.0.3" {
+		t.Errorf("expected the updated catalog to be sourced, got %v", b)
+	}
+}
+
+func TestCatalogImageSourceWithoutConfigs(t *testing.T) {
+	srv := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	defer srv.Close()
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	image := u.Host + "/catalogs/empty:latest"
+	pushCatalogImage(t, image, map[string]string{"etc/unrelated.yaml": "not a catalog"})
+
+	cacheDir := t.TempDir()
+	s := NewCatalogImageHandler([]string{image}, cacheDir)
+	if _, err := s.Source(context.Background(), newPlatformOperator("combo")); err == nil {
+		t.Fatal("expected an error sourcing from an image without a file-based catalog")
+	}
+	entries, err := os.ReadDir(filepath.Join(cacheDir, "sha256"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("expected nothing to be cached, found %d entries", len(entries))
+	}
+}
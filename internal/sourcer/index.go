@@ -0,0 +1,55 @@
+package sourcer
+
+import (
+	"sync"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// PackageIndex tracks the packages that were found in each catalog the last time
+// it was queried, along with the packages it contained before its content last
+// changed. This allows catalog events to be fanned out to the PlatformOperators
+// that reference one of those packages, rather than every PlatformOperator.
+type PackageIndex struct {
+	mu       sync.RWMutex
+	current  map[string]sets.String
+	previous map[string]sets.String
+}
+
+func NewPackageIndex() *PackageIndex {
+	return &PackageIndex{
+		current:  make(map[string]sets.String),
+		previous: make(map[string]sets.String),
+	}
+}
+
+// Record stores the packages that were found while querying the catalog.
+func (i *PackageIndex) Record(catalog string, packages sets.String) {
+	if i == nil {
+		return
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	current, ok := i.current[catalog]
+	if ok && current.Equal(packages) {
+		return
+	}
+	if ok {
+		i.previous[catalog] = current
+	}
+	i.current[catalog] = packages
+}
+
+// Packages returns the packages the catalog contains, or used to contain, and
+// whether the catalog has been queried at all.
+func (i *PackageIndex) Packages(catalog string) (sets.String, bool) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	current, ok := i.current[catalog]
+	if !ok {
+		return nil, false
+	}
+	return current.Union(i.previous[catalog]), true
+}
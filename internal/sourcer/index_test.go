@@ -0,0 +1,27 @@
+package sourcer
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+func TestPackageIndex(t *testing.T) {
+	index := NewPackageIndex()
+	if _, ok := index.Packages("olm/catalog"); ok {
+		t.Fatalf("expected an unqueried catalog to be unknown")
+	}
+
+	index.Record("olm/catalog", sets.NewString("combo", "prometheus-operator"))
+	index.Record("olm/catalog", sets.NewString("combo"))
+	// Recording the same content again must not forget the removed package.
+	index.Record("olm/catalog", sets.NewString("combo"))
+
+	pkgs, ok := index.Packages("olm/catalog")
+	if !ok {
+		t.Fatalf("expected the catalog to be known")
+	}
+	if want := sets.NewString("combo", "prometheus-operator"); !pkgs.Equal(want) {
+		t.Errorf("expected packages %v, got %v", want.List(), pkgs.List())
+	}
+}
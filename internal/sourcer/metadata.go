@@ -0,0 +1,122 @@
+package sourcer
+
+import (
+	"github.com/operator-framework/operator-registry/alpha/declcfg"
+	"github.com/operator-framework/operator-registry/alpha/property"
+	"github.com/operator-framework/operator-registry/pkg/api"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
+)
+
+// RelatedImage is an image that the bundle's operator pulls at runtime.
+type RelatedImage struct {
+	Name  string
+	Image string
+}
+
+// CSVMetadata is the descriptive metadata of the bundle's ClusterServiceVersion.
+type CSVMetadata struct {
+	DisplayName string
+	Provider    string
+	Maturity    string
+}
+
+// clusterServiceVersion holds the fields of a ClusterServiceVersion manifest
+// that are surfaced on bundles.
+type clusterServiceVersion struct {
+	Kind string `json:"kind"`
+	Spec struct {
+		DisplayName    string `json:"displayName"`
+		Maturity       string `json:"maturity"`
+		MinKubeVersion string `json:"minKubeVersion"`
+		Provider       struct {
+			Name string `json:"name"`
+		} `json:"provider"`
+		RelatedImages []struct {
+			Name  string `json:"name"`
+			Image string `json:"image"`
+		} `json:"relatedImages"`
+	} `json:"spec"`
+}
+
+func (csv clusterServiceVersion) metadata() CSVMetadata {
+	return CSVMetadata{
+		DisplayName: csv.Spec.DisplayName,
+		Provider:    csv.Spec.Provider.Name,
+		Maturity:    csv.Spec.Maturity,
+	}
+}
+
+func (csv clusterServiceVersion) relatedImages() []RelatedImage {
+	var out []RelatedImage
+	for _, ri := range csv.Spec.RelatedImages {
+		out = append(out, RelatedImage{Name: ri.Name, Image: ri.Image})
+	}
+	return out
+}
+
+// csvFromJSON parses the ClusterServiceVersion manifest, returning an empty one
+// when the manifest is missing or isn't a ClusterServiceVersion.
+func csvFromJSON(data []byte) clusterServiceVersion {
+	var csv clusterServiceVersion
+	if err := yaml.Unmarshal(data, &csv); err != nil || csv.Kind != "ClusterServiceVersion" {
+		return clusterServiceVersion{}
+	}
+	return csv
+}
+
+// csvFromObjects returns the ClusterServiceVersion embedded in the bundle's
+// olm.bundle.object properties.
+func csvFromObjects(objs []property.BundleObject) clusterServiceVersion {
+	for _, obj := range objs {
+		if obj.IsRef() {
+			continue
+		}
+		data, err := obj.GetData(nil, "")
+		if err != nil {
+			continue
+		}
+		if csv := csvFromJSON(data); csv.Kind != "" {
+			return csv
+		}
+	}
+	return clusterServiceVersion{}
+}
+
+func convertAPIs(in []*api.GroupVersionKind) []schema.GroupVersionKind {
+	var out []schema.GroupVersionKind
+	for _, gvk := range in {
+		out = append(out, schema.GroupVersionKind{Group: gvk.GetGroup(), Version: gvk.GetVersion(), Kind: gvk.GetKind()})
+	}
+	return out
+}
+
+func convertGVKs(in []property.GVK) []schema.GroupVersionKind {
+	var out []schema.GroupVersionKind
+	for _, gvk := range in {
+		out = append(out, schema.GroupVersionKind{Group: gvk.Group, Version: gvk.Version, Kind: gvk.Kind})
+	}
+	return out
+}
+
+func convertGVKsRequired(in []property.GVKRequired) []schema.GroupVersionKind {
+	var out []schema.GroupVersionKind
+	for _, gvk := range in {
+		out = append(out, schema.GroupVersionKind{Group: gvk.Group, Version: gvk.Version, Kind: gvk.Kind})
+	}
+	return out
+}
+
+// relatedImagesFromDeclarativeConfig prefers the related images listed by the
+// file-based catalog, which include the images of the operator's deployments,
+// over those declared by the ClusterServiceVersion.
+func relatedImagesFromDeclarativeConfig(b declcfg.Bundle, csv clusterServiceVersion) []RelatedImage {
+	if len(b.RelatedImages) == 0 {
+		return csv.relatedImages()
+	}
+	var out []RelatedImage
+	for _, ri := range b.RelatedImages {
+		out = append(out, RelatedImage{Name: ri.Name, Image: ri.Image})
+	}
+	return out
+}
@@ -0,0 +1,110 @@
+package sourcer
+
+import (
+	"encoding/base64"
+	"reflect"
+	"testing"
+	"testing/fstest"
+
+	"github.com/operator-framework/operator-registry/alpha/declcfg"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const testCSV = `{
+  "apiVersion": "operators.coreos.com/v1alpha1",
+  "kind": "ClusterServiceVersion",
+  "metadata": {"name": "combo.v0.0.1"},
+  "spec": {
+    "displayName": "Combo",
+    "maturity": "alpha",
+    "minKubeVersion": "1.24.0",
+    "provider": {"name": "Example"},
+    "relatedImages": [{"name": "operator", "image": "quay.io/combo/operator:v0.0.1"}]
+  }
+}`
+
+func TestCandidatesFromDeclarativeConfigMetadata(t *testing.T) {
+	catalog := `---
+schema: olm.channel
+package: combo
+name: "4.12"
+entries:
+- name: combo.v0.0.1
+---
+schema: olm.bundle
+name: combo.v0.0.1
+package: combo
+image: quay.io/combo/bundle:v0.0.1
+properties:
+- type: olm.package
+  value:
+    packageName: combo
+    version: 0.0.1
+- type: olm.gvk
+  value:
+    group: combo.example.com
+    version: v1
+    kind: Combo
+- type: olm.gvk.required
+  value:
+    group: etcd.example.com
+    version: v1beta2
+    kind: Cluster
+- type: olm.bundle.object
+  value:
+    data: ` + base64.StdEncoding.EncodeToString([]byte(testCSV)) + `
+`
+	for _, tt := range []struct {
+		name              string
+		relatedImages     string
+		wantRelatedImages []RelatedImage
+	}{
+		{
+			name:              "related images from the ClusterServiceVersion",
+			wantRelatedImages: []RelatedImage{{Name: "operator", Image: "quay.io/combo/operator:v0.0.1"}},
+		},
+		{
+			name: "related images from the catalog",
+			relatedImages: `relatedImages:
+- image: quay.io/combo/bundle:v0.0.1
+- name: operator
+  image: quay.io/combo/operator@sha256:1111111111111111111111111111111111111111111111111111111111111111
+`,
+			wantRelatedImages: []RelatedImage{
+				{Image: "quay.io/combo/bundle:v0.0.1"},
+				{Name: "operator", Image: "quay.io/combo/operator@sha256:1111111111111111111111111111111111111111111111111111111111111111"},
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := declcfg.LoadFS(fstest.MapFS{"catalog.yaml": &fstest.MapFile{Data: []byte(catalog + tt.relatedImages)}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			candidates, err := candidatesFromDeclarativeConfig(cfg, "combo", "test")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(candidates) != 1 {
+				t.Fatalf("expected a single candidate, got %v", candidates)
+			}
+			b := candidates[0]
+
+			if want := []schema.GroupVersionKind{{Group: "combo.example.com", Version: "v1", Kind: "Combo"}}; !reflect.DeepEqual(b.ProvidedAPIs, want) {
+				t.Errorf("expected the provided APIs to be %v, got %v", want, b.ProvidedAPIs)
+			}
+			if want := []schema.GroupVersionKind{{Group: "etcd.example.com", Version: "v1beta2", Kind: "Cluster"}}; !reflect.DeepEqual(b.RequiredAPIs, want) {
+				t.Errorf("expected the required APIs to be %v, got %v", want, b.RequiredAPIs)
+			}
+			if want := (CSVMetadata{DisplayName: "Combo", Provider: "Example", Maturity: "alpha"}); b.CSV != want {
+				t.Errorf("expected the CSV metadata to be %+v, got %+v", want, b.CSV)
+			}
+			if b.MinKubeVersion != "1.24.0" {
+				t.Errorf("expected the 1.24.0 min Kubernetes version, got %q", b.MinKubeVersion)
+			}
+			if !reflect.DeepEqual(b.RelatedImages, tt.wantRelatedImages) {
+				t.Errorf("expected the related images to be %v, got %v", tt.wantRelatedImages, b.RelatedImages)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package sourcer
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/blang/semver/v4"
+
+	platformv1alpha1 "github.com/openshift/platform-operators/api/v1alpha1"
+)
+
+type bundles []Bundle
+
+type versionedBundle struct {
+	Bundle
+	version semver.Version
+}
+
+// Latest returns the candidate with the highest version, along with the candidates
+// that were excluded from consideration: those whose version can't be parsed, and
+// pre-releases unless they're allowed. Candidates with the same version are ordered
+// by the priority of their catalog, and then by their name, so the same candidate is
+// selected regardless of the order the candidates were listed in.
+func (bundles bundles) Latest(allowPrereleases bool) (*Bundle, []Exclusion) {
+	var (
+		ordered  []versionedBundle
+		excluded []Exclusion
+	)
+	for _, b := range bundles {
+		v, err := semver.Parse(b.Version)
+		if err != nil {
+			excluded = append(excluded, Exclusion{Bundle: b, Reason: fmt.Sprintf("invalid version %q: %v", b.Version, err)})
+			continue
+		}
+		if len(v.Pre) != 0 && !allowPrereleases {
+			excluded = append(excluded, Exclusion{Bundle: b, Reason: "pre-release versions are only selected when spec.allowPrereleases is set"})
+			continue
+		}
+		ordered = append(ordered, versionedBundle{Bundle: b, version: v})
+	}
+	if len(ordered) == 0 {
+		return nil, excluded
+	}
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return compareBundles(ordered[i], ordered[j]) > 0
+	})
+	latest := ordered[0].Bundle
+	return &latest, excluded
+}
+
+// Pinned returns the candidates whose version is pinned by spec.version. The
+// versions that aren't pinned aren't reported as exclusions, as they were never
+// asked for.
+func (bs bundles) Pinned(po *platformv1alpha1.PlatformOperator) bundles {
+	var out bundles
+	for _, b := range bs {
+		if pinned(po, b.Version) {
+			out = append(out, b)
+		}
+	}
+	return out
+}
+
+func pinned(po *platformv1alpha1.PlatformOperator, version string) bool {
+	return po.Spec.Version != "" && sameVersion(po.Spec.Version, version)
+}
+
+// sameVersion compares versions semantically, tolerating a leading "v", and falls
+// back to comparing them verbatim when they can't be parsed.
+func sameVersion(a, b string) bool {
+	va, errA := semver.ParseTolerant(a)
+	vb, errB := semver.ParseTolerant(b)
+	if errA != nil || errB != nil {
+		return a == b
+	}
+	return va.Equals(vb)
+}
+
+// compareBundles orders bundles by version, then by the priority of their
+// catalog, and then by name, with lower names ranked higher. Build metadata is
+// ignored when comparing versions, as mandated by semver.
+func compareBundles(a, b versionedBundle) int {
+	if c := a.version.Compare(b.version); c != 0 {
+		return c
+	}
+	if a.CatalogPriority != b.CatalogPriority {
+		if a.CatalogPriority > b.CatalogPriority {
+			return 1
+		}
+		return -1
+	}
+	for _, pair := range [][2]string{{a.Name, b.Name}, {a.Catalog, b.Catalog}, {a.Image, b.Image}} {
+		if pair[0] != pair[1] {
+			if pair[0] < pair[1] {
+				return 1
+			}
+			return -1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,156 @@
+package sourcer
+
+import (
+	"testing"
+
+	"github.com/blang/semver/v4"
+)
+
+func TestLatest(t *testing.T) {
+	for _, tt := range []struct {
+		name             string
+		candidates       bundles
+		allowPrereleases bool
+		want             string
+		wantExcluded     []string
+	}{
+		{
+			name: "highest version",
+			candidates: bundles{
+				{Name: "combo.v0.0.1", Version: "0.0.1"},
+				{Name: "combo.v0.1.0", Version: "0.1.0"},
+				{Name: "combo.v0.0.2", Version: "0.0.2"},
+			},
+			want: "combo.v0.1.0",
+		},
+		{
+			name: "pre-releases are excluded by default",
+			candidates: bundles{
+				{Name: "combo.v1.0.0-rc.1", Version: "1.0.0-rc.1"},
+				{Name: "combo.v0.9.0", Version: "0.9.0"},
+			},
+			want:         "combo.v0.9.0",
+			wantExcluded: []string{"combo.v1.0.0-rc.1"},
+		},
+		{
+			name: "pre-releases are selected when allowed",
+			candidates: bundles{
+				{Name: "combo.v1.0.0-rc.1", Version: "1.0.0-rc.1"},
+				{Name: "combo.v0.9.0", Version: "0.9.0"},
+			},
+			allowPrereleases: true,
+			want:             "combo.v1.0.0-rc.1",
+		},
+		{
+			name: "GA releases rank higher than their pre-releases",
+			candidates: bundles{
+				{Name: "combo.v1.0.0-rc.2", Version: "1.0.0-rc.2"},
+				{Name: "combo.v1.0.0", Version: "1.0.0"},
+				{Name: "combo.v1.0.0-rc.1", Version: "1.0.0-rc.1"},
+			},
+			allowPrereleases: true,
+			want:             "combo.v1.0.0",
+		},
+		{
+			name: "invalid versions are reported",
+			candidates: bundles{
+				{Name: "combo.latest", Version: "latest"},
+				{Name: "combo.v1", Version: "v1"},
+				{Name: "combo.v0.0.1", Version: "0.0.1"},
+			},
+			want:         "combo.v0.0.1",
+			wantExcluded: []string{"combo.latest", "combo.v1"},
+		},
+		{
+			name: "build metadata ties are broken by catalog priority",
+			candidates: bundles{
+				{Name: "combo.v1.0.0+a", Version: "1.0.0+a", CatalogPriority: 0},
+				{Name: "combo.v1.0.0+b", Version: "1.0.0+b", CatalogPriority: 10},
+			},
+			want: "combo.v1.0.0+b",
+		},
+		{
+			name: "same priority ties are broken by name",
+			candidates: bundles{
+				{Name: "combo-b.v1.0.0", Version: "1.0.0", Catalog: "olm/b"},
+				{Name: "combo-a.v1.0.0", Version: "1.0.0", Catalog: "olm/a"},
+			},
+			want: "combo-a.v1.0.0",
+		},
+		{
+			name: "nothing but invalid versions",
+			candidates: bundles{
+				{Name: "combo.latest", Version: "latest"},
+			},
+			wantExcluded: []string{"combo.latest"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, excluded := tt.candidates.Latest(tt.allowPrereleases)
+			if tt.want == "" {
+				if got != nil {
+					t.Errorf("expected no bundle to be selected, got %s", got.Name)
+				}
+			} else if got == nil || got.Name != tt.want {
+				t.Errorf("expected %s to be selected, got %v", tt.want, got)
+			}
+
+			var names []string
+			for _, e := range excluded {
+				names = append(names, e.Bundle.Name)
+			}
+			if len(names) != len(tt.wantExcluded) {
+				t.Fatalf("expected %v to be excluded, got %v", tt.wantExcluded, names)
+			}
+			for i := range names {
+				if names[i] != tt.wantExcluded[i] {
+					t.Errorf("expected %v to be excluded, got %v", tt.wantExcluded, names)
+				}
+			}
+		})
+	}
+}
+
+func FuzzLatest(f *testing.F) {
+	f.Add("1.0.0", "1.0.0-rc.1", "1.0.0+build", 0, 1, false)
+	f.Add("0.0.1", "latest", "0.0.2", 5, 5, true)
+	f.Add("2.0.0-alpha", "2.0.0-beta", "1.9.9", 0, 0, true)
+
+	f.Fuzz(func(t *testing.T, v1, v2, v3 string, p1, p2 int, allowPrereleases bool) {
+		candidates := bundles{
+			{Name: "a", Version: v1, CatalogPriority: p1},
+			{Name: "b", Version: v2, CatalogPriority: p2},
+			{Name: "c", Version: v3},
+		}
+		got, excluded := candidates.Latest(allowPrereleases)
+		if got == nil && len(excluded) != len(candidates) {
+			t.Fatalf("expected every candidate to be excluded when none is selected, got %v", excluded)
+		}
+
+		// The selection must not depend on the order the candidates were listed in.
+		for _, perm := range [][]int{{0, 2, 1}, {1, 0, 2}, {1, 2, 0}, {2, 0, 1}, {2, 1, 0}} {
+			permuted := bundles{candidates[perm[0]], candidates[perm[1]], candidates[perm[2]]}
+			other, _ := permuted.Latest(allowPrereleases)
+			if (got == nil) != (other == nil) || (got != nil && got.Name != other.Name) {
+				t.Fatalf("expected the same selection for %v and %v, got %v and %v", candidates, permuted, got, other)
+			}
+		}
+		if got == nil {
+			return
+		}
+
+		selected := semver.MustParse(got.Version)
+		if len(selected.Pre) != 0 && !allowPrereleases {
+			t.Fatalf("selected the %s pre-release without allowing pre-releases", got.Version)
+		}
+		for _, b := range candidates {
+			v, err := semver.Parse(b.Version)
+			if err != nil || (len(v.Pre) != 0 && !allowPrereleases) {
+				continue
+			}
+			if v.GT(selected) {
+				t.Fatalf("selected %s over the higher %s version", got.Version, b.Version)
+			}
+		}
+	})
+}
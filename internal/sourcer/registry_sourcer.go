@@ -2,14 +2,26 @@ package sourcer
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"time"
 
 	operatorsv1alpha1 "github.com/operator-framework/api/pkg/operators/v1alpha1"
+	"github.com/operator-framework/operator-registry/alpha/property"
+	"github.com/operator-framework/operator-registry/pkg/api"
 	registryClient "github.com/operator-framework/operator-registry/pkg/client"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
 	utilerror "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	platformv1alpha1 "github.com/openshift/platform-operators/api/v1alpha1"
+	"github.com/openshift/platform-operators/internal/metrics"
+	"github.com/openshift/platform-operators/internal/tracing"
 )
 
 const (
@@ -18,15 +30,31 @@ const (
 
 type catalogSource struct {
 	client.Client
+	index *PackageIndex
 }
 
-func NewCatalogSourceHandler(c client.Client) Sourcer {
+// NewCatalogSourceHandler returns a Sourcer that queries the olm.bundle content
+// served by the CatalogSources in the cluster. The packages found in each catalog
+// are recorded in the index, which may be nil.
+func NewCatalogSourceHandler(c client.Client, index *PackageIndex) Sourcer {
 	return &catalogSource{
 		Client: c,
+		index:  index,
 	}
 }
 
 func (cs catalogSource) Source(ctx context.Context, po *platformv1alpha1.PlatformOperator) (*Bundle, error) {
+	candidates, err := cs.Candidates(ctx, po)
+	if err != nil {
+		return nil, err
+	}
+	return latest(po, candidates)
+}
+
+func (cs catalogSource) Candidates(ctx context.Context, po *platformv1alpha1.PlatformOperator) ([]Bundle, error) {
+	if err := validate(po); err != nil {
+		return nil, err
+	}
 	css := &operatorsv1alpha1.CatalogSourceList{}
 	if err := cs.List(ctx, css); err != nil {
 		return nil, err
@@ -36,22 +64,10 @@ func (cs catalogSource) Source(ctx context.Context, po *platformv1alpha1.Platfor
 	}
 	sources := sources(css.Items)
 
-	candidates, err := sources.Filter(byConnectionReadiness).GetCandidates(ctx, po)
-	if err != nil {
-		return nil, err
-	}
-	if len(candidates) == 0 {
-		return nil, fmt.Errorf("failed to find candidate olm.bundles from the %s package", po.Spec.PackageName)
-	}
-	latestBundle, err := candidates.Latest()
-	if err != nil {
-		return nil, err
-	}
-
-	return latestBundle, nil
+	return sources.Filter(byConnectionReadiness).GetCandidates(ctx, po, cs.index)
 }
 
-func (s sources) GetCandidates(ctx context.Context, po *platformv1alpha1.PlatformOperator) (bundles, error) {
+func (s sources) GetCandidates(ctx context.Context, po *platformv1alpha1.PlatformOperator, index *PackageIndex) (bundles, error) {
 	var (
 		errors     []error
 		candidates bundles
@@ -61,30 +77,104 @@ func (s sources) GetCandidates(ctx context.Context, po *platformv1alpha1.Platfor
 		// Note(tflannag): Need to account for grpc-based CatalogSource(s) that
 		// specify a spec.Address or a spec.Image, so ensure this field exists, and
 		// it's not empty before creating a registry client.
-		rc, err := registryClient.NewClient(cs.Status.GRPCConnectionState.Address)
+		rc, err := newRegistryClient(cs.Status.GRPCConnectionState.Address)
 		if err != nil {
 			errors = append(errors, fmt.Errorf("failed to register client from the %s/%s grpc connection: %w", cs.GetName(), cs.GetNamespace(), err))
 			continue
 		}
-		it, err := rc.ListBundles(ctx)
+		found, err := listBundles(ctx, rc, cs, po, index)
+		rc.Close()
 		if err != nil {
 			errors = append(errors, fmt.Errorf("failed to list bundles from the %s/%s catalog: %w", cs.GetName(), cs.GetNamespace(), err))
 			continue
 		}
-		for b := it.Next(); b != nil; b = it.Next() {
-			if b.PackageName != po.Spec.PackageName || b.ChannelName != channelName {
-				continue
-			}
-			candidates = append(candidates, Bundle{
-				Version:  b.GetVersion(),
-				Image:    b.GetBundlePath(),
-				Skips:    b.GetSkips(),
-				Replaces: b.GetReplaces(),
-			})
-		}
+		candidates = append(candidates, found...)
 	}
 	if len(errors) != 0 {
 		return nil, utilerror.NewAggregate(errors)
 	}
 	return candidates, nil
 }
+
+// listBundles returns the olm.bundles from an individual catalog that match the
+// PlatformOperator's package and the supported channel, and records every package
+// the catalog contains in the index.
+func listBundles(ctx context.Context, rc *registryClient.Client, cs operatorsv1alpha1.CatalogSource, po *platformv1alpha1.PlatformOperator, index *PackageIndex) (candidates bundles, err error) {
+	catalog := catalogKey(cs)
+	ctx, span := tracing.StartSpan(ctx, "ListBundles", trace.WithAttributes(attribute.String("catalog", catalog)))
+	defer func(start time.Time) {
+		metrics.RecordCatalogQuery(catalog, start, err)
+		tracing.RecordError(span, err)
+		span.End()
+	}(time.Now())
+
+	it, err := rc.ListBundles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	packages := sets.NewString()
+	for b := it.Next(); b != nil; b = it.Next() {
+		packages.Insert(b.GetPackageName())
+		if b.PackageName != po.Spec.PackageName || b.ChannelName != channelName {
+			continue
+		}
+		props := convertProperties(b.GetProperties())
+		var deprecations []Deprecation
+		// The registry API only exposes bundle deprecations, by way of the
+		// olm.deprecated property.
+		if d := deprecationFromProperties(b.GetCsvName(), props); d != nil {
+			deprecations = append(deprecations, *d)
+		}
+		csv := csvFromJSON([]byte(b.GetCsvJson()))
+		candidates = append(candidates, Bundle{
+			Name:            b.GetCsvName(),
+			Version:         b.GetVersion(),
+			Image:           b.GetBundlePath(),
+			Skips:           b.GetSkips(),
+			Replaces:        b.GetReplaces(),
+			Package:         b.GetPackageName(),
+			Channel:         b.GetChannelName(),
+			Catalog:         catalog,
+			CatalogPriority: cs.Spec.Priority,
+			MinKubeVersion:  csv.Spec.MinKubeVersion,
+			Properties:      props,
+			ProvidedAPIs:    convertAPIs(b.GetProvidedApis()),
+			RequiredAPIs:    convertAPIs(b.GetRequiredApis()),
+			RelatedImages:   csv.relatedImages(),
+			CSV:             csv.metadata(),
+			Deprecations:    deprecations,
+		})
+	}
+	if err := it.Error(); err != nil {
+		return nil, err
+	}
+	index.Record(catalog, packages)
+
+	return candidates, nil
+}
+
+func convertProperties(in []*api.Property) []property.Property {
+	var out []property.Property
+	for _, p := range in {
+		out = append(out, property.Property{Type: p.GetType(), Value: json.RawMessage(p.GetValue())})
+	}
+	return out
+}
+
+func catalogKey(cs operatorsv1alpha1.CatalogSource) string {
+	return client.ObjectKeyFromObject(&cs).String()
+}
+
+// newRegistryClient creates a registry client whose gRPC connection propagates
+// the trace context of each call to the catalog.
+func newRegistryClient(address string) (*registryClient.Client, error) {
+	conn, err := grpc.Dial(address,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(otelgrpc.UnaryClientInterceptor()),
+		grpc.WithStreamInterceptor(otelgrpc.StreamClientInterceptor()),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return registryClient.NewClientFromConn(conn), nil
+}
@@ -0,0 +1,110 @@
+package sourcer
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	operatorsv1alpha1 "github.com/operator-framework/api/pkg/operators/v1alpha1"
+	"github.com/operator-framework/operator-registry/pkg/api"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	platformv1alpha1 "github.com/openshift/platform-operators/api/v1alpha1"
+)
+
+type fakeRegistry struct {
+	api.UnimplementedRegistryServer
+	bundles  []*api.Bundle
+	metadata chan metadata.MD
+}
+
+func (f *fakeRegistry) ListBundles(_ *api.ListBundlesRequest, stream api.Registry_ListBundlesServer) error {
+	md, _ := metadata.FromIncomingContext(stream.Context())
+	f.metadata <- md
+	for _, b := range f.bundles {
+		if err := stream.Send(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func startFakeRegistry(t *testing.T, registry *fakeRegistry) string {
+	t.Helper()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	s := grpc.NewServer()
+	api.RegisterRegistryServer(s, registry)
+	go func() {
+		_ = s.Serve(lis)
+	}()
+	t.Cleanup(s.Stop)
+
+	return lis.Addr().String()
+}
+
+func TestGetCandidatesPropagatesTraceContext(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	registry := &fakeRegistry{
+		bundles: []*api.Bundle{
+			{CsvName: "combo.v0.0.1", PackageName: "combo", ChannelName: channelName, Version: "0.0.1", BundlePath: "quay.io/combo/bundle:v0.0.1"},
+			{CsvName: "other.v0.0.1", PackageName: "other", ChannelName: channelName, Version: "0.0.1", BundlePath: "quay.io/other/bundle:v0.0.1"},
+		},
+		metadata: make(chan metadata.MD, 1),
+	}
+	cs := operatorsv1alpha1.CatalogSource{
+		ObjectMeta: metav1.ObjectMeta{Name: "catalog", Namespace: "olm"},
+		Status: operatorsv1alpha1.CatalogSourceStatus{
+			GRPCConnectionState: &operatorsv1alpha1.GRPCConnectionState{
+				Address:           startFakeRegistry(t, registry),
+				LastObservedState: "READY",
+			},
+		},
+	}
+	po := &platformv1alpha1.PlatformOperator{
+		ObjectMeta: metav1.ObjectMeta{Name: "combo"},
+		Spec:       platformv1alpha1.PlatformOperatorSpec{PackageName: "combo"},
+	}
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "parent")
+	candidates, err := sources{cs}.GetCandidates(ctx, po, nil)
+	parent.End()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(candidates) != 1 || candidates[0].Image != "quay.io/combo/bundle:v0.0.1" {
+		t.Fatalf("unexpected candidates: %v", candidates)
+	}
+
+	md := <-registry.metadata
+	if len(md.Get("traceparent")) == 0 {
+		t.Fatalf("expected the trace context to be propagated to the registry, got metadata %v", md)
+	}
+
+	var listBundles *tracetest.SpanStub
+	spans := exporter.GetSpans()
+	for i := range spans {
+		if spans[i].Name == "ListBundles" {
+			listBundles = &spans[i]
+		}
+	}
+	if listBundles == nil {
+		t.Fatalf("expected a ListBundles span, got %v", spans)
+	}
+	if listBundles.Parent.SpanID() != parent.SpanContext().SpanID() {
+		t.Errorf("expected the ListBundles span to be a child of the caller's span")
+	}
+}
@@ -2,16 +2,50 @@ package sourcer
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
+	"github.com/operator-framework/operator-registry/alpha/property"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
 	platformv1alpha1 "github.com/openshift/platform-operators/api/v1alpha1"
+	"github.com/openshift/platform-operators/internal/util"
 )
 
 type Bundle struct {
+	// Name is the name of the olm.bundle, e.g. the name of its ClusterServiceVersion.
+	Name     string
 	Version  string
 	Image    string
 	Replaces string
 	Skips    []string
+	Package  string
+	Channel  string
+	// Catalog identifies the catalog the bundle was sourced from.
+	Catalog string
+	// CatalogPriority is the priority of the catalog, which ranks bundles that
+	// share the same version. Higher priorities are preferred.
+	CatalogPriority int
+	// Origin is the name of the sourcer that produced the bundle when multiple
+	// sourcers are chained together.
+	Origin string
+	// MinKubeVersion is the minimum Kubernetes version the bundle supports, as
+	// declared by its ClusterServiceVersion.
+	MinKubeVersion string
+	// Properties are the olm.bundle properties declared in the catalog.
+	Properties []property.Property
+	// ProvidedAPIs and RequiredAPIs are the APIs the bundle serves and depends on.
+	ProvidedAPIs []schema.GroupVersionKind
+	RequiredAPIs []schema.GroupVersionKind
+	// RelatedImages are the images the bundle's operator pulls at runtime.
+	RelatedImages []RelatedImage
+	// CSV is the descriptive metadata of the bundle's ClusterServiceVersion.
+	CSV CSVMetadata
+	// Deprecations are the catalog's notices that the bundle, its channel or its
+	// package are deprecated.
+	Deprecations []Deprecation
+	// Excluded are the candidates that were excluded when the bundle was selected.
+	Excluded []Exclusion
 }
 
 func (b Bundle) String() string {
@@ -21,3 +55,60 @@ func (b Bundle) String() string {
 type Sourcer interface {
 	Source(context.Context, *platformv1alpha1.PlatformOperator) (*Bundle, error)
 }
+
+// CandidateSourcer is a Sourcer that's able to list every olm.bundle that's a
+// candidate for the PlatformOperator, rather than only the one it selects.
+type CandidateSourcer interface {
+	Sourcer
+	Candidates(context.Context, *platformv1alpha1.PlatformOperator) ([]Bundle, error)
+}
+
+// candidatesOf returns the candidates listed by the sourcer, falling back to the
+// single bundle it selects for sourcers that can't list their candidates.
+func candidatesOf(ctx context.Context, s Sourcer, po *platformv1alpha1.PlatformOperator) ([]Bundle, error) {
+	var (
+		candidates []Bundle
+		err        error
+	)
+	if cs, ok := s.(CandidateSourcer); ok {
+		candidates, err = cs.Candidates(ctx, po)
+	} else {
+		var b *Bundle
+		if b, err = s.Source(ctx, po); err == nil {
+			candidates = []Bundle{*b}
+		}
+	}
+	var notFound *util.PackageNotFoundError
+	if errors.As(err, &notFound) {
+		return nil, nil
+	}
+	return candidates, err
+}
+
+// latest selects the highest version from the candidates, recording every
+// candidate that was excluded along the way.
+func latest(po *platformv1alpha1.PlatformOperator, candidates bundles, excluded ...Exclusion) (*Bundle, error) {
+	allowPrereleases := po.Spec.AllowPrereleases
+	if po.Spec.Version != "" {
+		candidates = candidates.Pinned(po)
+		allowPrereleases = true
+	}
+	b, dropped := candidates.Latest(allowPrereleases)
+	excluded = append(excluded, dropped...)
+	if b == nil {
+		notFound := &util.PackageNotFoundError{Package: po.Spec.PackageName}
+		for _, e := range excluded {
+			notFound.Excluded = append(notFound.Excluded, e.String())
+		}
+		return nil, notFound
+	}
+	b.Excluded = excluded
+	return b, nil
+}
+
+func validate(po *platformv1alpha1.PlatformOperator) error {
+	if po.Spec.PackageName == "" {
+		return util.NewPermanentError(fmt.Errorf("invalid spec.packageName: a package name must be specified"))
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package tracing
+
+import (
+	"context"
+	"flag"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	tracerName  = "github.com/openshift/platform-operators"
+	serviceName = "platform-operators"
+)
+
+// Options configures the export of OpenTelemetry traces. Tracing is disabled
+// by default, and is enabled either through the --tracing-enabled flag or when
+// an OTLP endpoint has been configured through the standard OTEL_EXPORTER_OTLP_*
+// environment variables.
+type Options struct {
+	Enabled       bool
+	Endpoint      string
+	Insecure      bool
+	SamplingRatio float64
+}
+
+// BindFlags registers the tracing flags with the provided flag set.
+func (o *Options) BindFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&o.Enabled, "tracing-enabled", false, "Enable exporting OpenTelemetry traces over OTLP/gRPC.")
+	fs.StringVar(&o.Endpoint, "tracing-endpoint", "", "The host:port of the OTLP/gRPC trace collector. Defaults to the OTEL_EXPORTER_OTLP_ENDPOINT environment variable.")
+	fs.BoolVar(&o.Insecure, "tracing-insecure", false, "Disable TLS when connecting to the OTLP/gRPC trace collector.")
+	fs.Float64Var(&o.SamplingRatio, "tracing-sampling-ratio", 1, "The ratio of root traces to sample, between 0 and 1.")
+}
+
+func (o *Options) enabled() bool {
+	if o.Enabled || o.Endpoint != "" {
+		return true
+	}
+	for _, env := range []string{"OTEL_EXPORTER_OTLP_ENDPOINT", "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"} {
+		if os.Getenv(env) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Setup configures the global tracer provider and text map propagator based on the
+// provided options. The returned function flushes and stops the exporter, and must
+// be called before the process exits.
+func Setup(ctx context.Context, o Options) (func(context.Context) error, error) {
+	// Always propagate trace context so that incoming traces are preserved across
+	// the registry gRPC client, even when this process doesn't export spans itself.
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	if !o.enabled() {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	var exporterOpts []otlptracegrpc.Option
+	if o.Endpoint != "" {
+		exporterOpts = append(exporterOpts, otlptracegrpc.WithEndpoint(o.Endpoint))
+	}
+	if o.Insecure {
+		exporterOpts = append(exporterOpts, otlptracegrpc.WithInsecure())
+	}
+	exporter, err := otlptracegrpc.New(ctx, exporterOpts...)
+	if err != nil {
+		return nil, err
+	}
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceNameKey.String(serviceName)),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(o.SamplingRatio))),
+	)
+	otel.SetTracerProvider(tp)
+
+	return tp.Shutdown, nil
+}
+
+// StartSpan starts a span using the global tracer provider.
+func StartSpan(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, opts...)
+}
+
+// RecordError marks the span as failed when err is non-nil.
+func RecordError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
@@ -0,0 +1,41 @@
+package util
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PermanentError wraps an error that will not be resolved by retrying the
+// reconciliation, e.g. a PlatformOperator that fails validation.
+type PermanentError struct {
+	Err error
+}
+
+func NewPermanentError(err error) error {
+	return &PermanentError{Err: err}
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// PackageNotFoundError is returned when none of the available catalogs contain
+// olm.bundle content for the requested package.
+type PackageNotFoundError struct {
+	Package string
+	// Excluded explains why each of the package's olm.bundles was excluded from
+	// the candidates, when the package itself was found.
+	Excluded []string
+}
+
+func (e *PackageNotFoundError) Error() string {
+	msg := fmt.Sprintf("failed to find candidate olm.bundles from the %s package", e.Package)
+	if len(e.Excluded) != 0 {
+		msg += ": " + strings.Join(e.Excluded, "; ")
+	}
+	return msg
+}
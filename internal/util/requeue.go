@@ -0,0 +1,90 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// RequeuePolicy determines when a PlatformOperator is reconciled again based on
+// the outcome of the previous reconciliation.
+type RequeuePolicy struct {
+	// ResyncPeriod is the interval at which successfully reconciled PlatformOperators
+	// are re-checked against their catalogs. A zero value disables periodic resyncs.
+	ResyncPeriod time.Duration
+	// TransientBackoff is the delay before retrying after a transient failure, e.g.
+	// an unavailable catalog gRPC connection.
+	TransientBackoff time.Duration
+	// PackageNotFoundBackoff is the delay before retrying after none of the catalogs
+	// contained the requested package.
+	PackageNotFoundBackoff time.Duration
+}
+
+func DefaultRequeuePolicy() RequeuePolicy {
+	return RequeuePolicy{
+		ResyncPeriod:           10 * time.Minute,
+		TransientBackoff:       ShortRequeue.RequeueAfter,
+		PackageNotFoundBackoff: 5 * time.Minute,
+	}
+}
+
+// Result classifies the error a reconciliation finished with, and returns the
+// result and error that should be handed back to controller-runtime:
+//   - successful reconciliations are resynced after the ResyncPeriod
+//   - transient errors are retried after the TransientBackoff
+//   - missing packages are retried after the PackageNotFoundBackoff
+//   - permanent errors are not retried until the PlatformOperator changes
+//   - any other error is returned, deferring to the default exponential backoff
+func (p RequeuePolicy) Result(err error) (ctrl.Result, error) {
+	var (
+		permanentErr *PermanentError
+		notFoundErr  *PackageNotFoundError
+	)
+	switch {
+	case err == nil:
+		return ctrl.Result{RequeueAfter: p.ResyncPeriod}, nil
+	case errors.As(err, &permanentErr), apierrors.IsInvalid(err):
+		return ctrl.Result{}, nil
+	case errors.As(err, &notFoundErr):
+		return ctrl.Result{RequeueAfter: p.PackageNotFoundBackoff}, nil
+	case IsTransient(err):
+		if p.TransientBackoff == 0 {
+			return ShortRequeue, nil
+		}
+		return ctrl.Result{RequeueAfter: p.TransientBackoff}, nil
+	}
+	return ctrl.Result{}, err
+}
+
+// IsTransient returns true when err, or any of the errors it aggregates, is
+// expected to resolve itself shortly.
+func IsTransient(err error) bool {
+	var agg utilerrors.Aggregate
+	if errors.As(err, &agg) {
+		for _, err := range agg.Errors() {
+			if IsTransient(err) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var grpcErr interface{ GRPCStatus() *status.Status }
+	if errors.As(err, &grpcErr) {
+		switch grpcErr.GRPCStatus().Code() {
+		case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted:
+			return true
+		}
+	}
+	return errors.Is(err, context.DeadlineExceeded) ||
+		apierrors.IsConflict(err) ||
+		apierrors.IsServerTimeout(err) ||
+		apierrors.IsTimeout(err) ||
+		apierrors.IsTooManyRequests(err)
+}
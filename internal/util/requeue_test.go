@@ -0,0 +1,74 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+func TestRequeuePolicyResult(t *testing.T) {
+	policy := RequeuePolicy{
+		ResyncPeriod:           10 * time.Minute,
+		TransientBackoff:       5 * time.Second,
+		PackageNotFoundBackoff: 5 * time.Minute,
+	}
+	unavailable := status.Error(codes.Unavailable, "connection refused")
+
+	for _, tt := range []struct {
+		name             string
+		err              error
+		wantRequeueAfter time.Duration
+		wantErr          bool
+	}{
+		{
+			name:             "success resyncs periodically",
+			wantRequeueAfter: 10 * time.Minute,
+		},
+		{
+			name:             "unavailable catalog retries quickly",
+			err:              fmt.Errorf("failed to list bundles: %w", unavailable),
+			wantRequeueAfter: 5 * time.Second,
+		},
+		{
+			name:             "aggregated unavailable catalog retries quickly",
+			err:              utilerrors.NewAggregate([]error{errors.New("boom"), fmt.Errorf("wrapped: %w", unavailable)}),
+			wantRequeueAfter: 5 * time.Second,
+		},
+		{
+			name:             "missing package backs off",
+			err:              &PackageNotFoundError{Package: "combo"},
+			wantRequeueAfter: 5 * time.Minute,
+		},
+		{
+			name: "permanent error is not requeued",
+			err:  NewPermanentError(errors.New("invalid")),
+		},
+		{
+			name: "invalid object is not requeued",
+			err:  apierrors.NewInvalid(schema.GroupKind{Group: "core.rukpak.io", Kind: "BundleDeployment"}, "combo", field.ErrorList{}),
+		},
+		{
+			name:    "unknown error uses the default backoff",
+			err:     errors.New("boom"),
+			wantErr: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := policy.Result(tt.err)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if res.RequeueAfter != tt.wantRequeueAfter {
+				t.Errorf("expected requeue after %s, got %s", tt.wantRequeueAfter, res.RequeueAfter)
+			}
+		})
+	}
+}
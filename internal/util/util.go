@@ -2,13 +2,25 @@ package util
 
 import (
 	"context"
+	"crypto/sha256"
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
+	operatorsv1alpha1 "github.com/operator-framework/api/pkg/operators/v1alpha1"
 	rukpakv1alpha1 "github.com/operator-framework/rukpak/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	platformv1alpha1 "github.com/openshift/platform-operators/api/v1alpha1"
@@ -18,44 +30,226 @@ var (
 	ShortRequeue = ctrl.Result{RequeueAfter: time.Second * 5}
 )
 
-func RequeuePlatformOperators(cl client.Client) handler.MapFunc {
+const (
+	// PackageNameIndexKey is the field index key that PlatformOperators are indexed
+	// under by their spec.packageName.
+	PackageNameIndexKey = "spec.packageName"
+	// SourcedIndexKey is the field index key that PlatformOperators are indexed under
+	// by whether their desired olm.bundle content has been successfully sourced.
+	SourcedIndexKey = "status.sourced"
+	// DependsOnIndexKey is the field index key that PlatformOperators are indexed
+	// under by the names of the PlatformOperators they depend on.
+	DependsOnIndexKey = "spec.dependsOn"
+
+	// maxReleaseNameLength is the longest name of the helm releases rukpak
+	// installs BundleDeployments as.
+	maxReleaseNameLength       = 53
+	bundleDeploymentHashLength = 10
+)
+
+// PackageLister returns the packages a catalog contains, or used to contain, and
+// whether the catalog's content is known at all.
+type PackageLister interface {
+	Packages(catalog string) (sets.String, bool)
+}
+
+// IndexPackageName is the field indexer func for the PackageNameIndexKey.
+func IndexPackageName(obj client.Object) []string {
+	po, ok := obj.(*platformv1alpha1.PlatformOperator)
+	if !ok || po.Spec.PackageName == "" {
+		return nil
+	}
+	return []string{po.Spec.PackageName}
+}
+
+// IndexSourced is the field indexer func for the SourcedIndexKey.
+func IndexSourced(obj client.Object) []string {
+	po, ok := obj.(*platformv1alpha1.PlatformOperator)
+	if !ok {
+		return nil
+	}
+	return []string{strconv.FormatBool(meta.IsStatusConditionTrue(po.Status.Conditions, platformv1alpha1.TypeSourced))}
+}
+
+// IndexDependsOn is the field indexer func for the DependsOnIndexKey.
+func IndexDependsOn(obj client.Object) []string {
+	po, ok := obj.(*platformv1alpha1.PlatformOperator)
+	if !ok {
+		return nil
+	}
+	names := make([]string, 0, len(po.Spec.DependsOn))
+	for _, d := range po.Spec.DependsOn {
+		names = append(names, d.Name)
+	}
+	return names
+}
+
+// RequeueDependents maps a PlatformOperator event to the PlatformOperators that
+// depend on it, directly or through others, so their held rollouts proceed once
+// it's installed. The transitive dependents are requeued as well, as a change to
+// its spec.dependsOn can introduce or break a cycle they're part of.
+func RequeueDependents(cl client.Reader) handler.MapFunc {
 	return func(object client.Object) []reconcile.Request {
-		poList := &platformv1alpha1.PlatformOperatorList{}
-		if err := cl.List(context.Background(), poList); err != nil {
-			return nil
+		var (
+			requests []reconcile.Request
+			seen     = sets.NewString(object.GetName())
+			queue    = []string{object.GetName()}
+		)
+		for len(queue) > 0 {
+			name := queue[0]
+			queue = queue[1:]
+			poList := &platformv1alpha1.PlatformOperatorList{}
+			if err := cl.List(context.Background(), poList, client.MatchingFields{DependsOnIndexKey: name}); err != nil {
+				return nil
+			}
+			for _, po := range poList.Items {
+				if seen.Has(po.Name) {
+					continue
+				}
+				seen.Insert(po.Name)
+				queue = append(queue, po.Name)
+				requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: po.Name}})
+			}
+		}
+		return requests
+	}
+}
+
+// RequeuePlatformOperators maps a CatalogSource event to the PlatformOperators whose
+// package that catalog contains, or used to contain, along with any PlatformOperator
+// that is still waiting for its package to be sourced. Every PlatformOperator is
+// requeued when the catalog's content isn't known yet.
+func RequeuePlatformOperators(cl client.Reader, packages PackageLister) handler.MapFunc {
+	return func(object client.Object) []reconcile.Request {
+		pkgs, ok := packages.Packages(client.ObjectKeyFromObject(object).String())
+		if !ok {
+			poList := &platformv1alpha1.PlatformOperatorList{}
+			if err := cl.List(context.Background(), poList); err != nil {
+				return nil
+			}
+			return requestsFor(poList.Items)
 		}
 
+		selectors := []client.MatchingFields{{SourcedIndexKey: "false"}}
+		for _, pkg := range pkgs.List() {
+			selectors = append(selectors, client.MatchingFields{PackageNameIndexKey: pkg})
+		}
 		var requests []reconcile.Request
-		for _, po := range poList.Items {
-			requests = append(requests, reconcile.Request{
-				NamespacedName: types.NamespacedName{
-					Name: po.GetName(),
-				},
-			})
+		for _, selector := range selectors {
+			poList := &platformv1alpha1.PlatformOperatorList{}
+			if err := cl.List(context.Background(), poList, selector); err != nil {
+				return nil
+			}
+			requests = append(requests, requestsFor(poList.Items)...)
 		}
 		return requests
 	}
 }
 
-func RequeueBundleDeployment(c client.Client) handler.MapFunc {
-	return func(obj client.Object) []reconcile.Request {
-		bi := obj.(*rukpakv1alpha1.BundleDeployment)
+func requestsFor(pos []platformv1alpha1.PlatformOperator) []reconcile.Request {
+	requests := make([]reconcile.Request, 0, len(pos))
+	for _, po := range pos {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Name: po.GetName(),
+			},
+		})
+	}
+	return requests
+}
+
+// CatalogSourceChanged filters out CatalogSource updates that changed neither the
+// spec, the connection to the catalog, nor the catalog's content, e.g. the periodic
+// heartbeat updates of the gRPC connection's last connect time.
+func CatalogSourceChanged() predicate.Predicate {
+	return predicate.Or(
+		predicate.GenerationChangedPredicate{},
+		predicate.Funcs{
+			UpdateFunc: func(e event.UpdateEvent) bool {
+				oldCS, ok := e.ObjectOld.(*operatorsv1alpha1.CatalogSource)
+				if !ok {
+					return false
+				}
+				newCS, ok := e.ObjectNew.(*operatorsv1alpha1.CatalogSource)
+				if !ok {
+					return false
+				}
+				return connectionChanged(oldCS.Status.GRPCConnectionState, newCS.Status.GRPCConnectionState) ||
+					!equality.Semantic.DeepEqual(oldCS.Status.LatestImageRegistryPoll, newCS.Status.LatestImageRegistryPoll) ||
+					!equality.Semantic.DeepEqual(oldCS.Status.RegistryServiceStatus, newCS.Status.RegistryServiceStatus)
+			},
+		},
+	)
+}
 
-		poList := &platformv1alpha1.PlatformOperatorList{}
-		if err := c.List(context.Background(), poList); err != nil {
+func connectionChanged(oldState, newState *operatorsv1alpha1.GRPCConnectionState) bool {
+	if oldState == nil || newState == nil {
+		return oldState != newState
+	}
+	return oldState.Address != newState.Address || oldState.LastObservedState != newState.LastObservedState
+}
+
+// BundleDeploymentName returns the name of the BundleDeployment that installs the
+// PlatformOperator. The name is prefixed with the PlatformOperator's name, which
+// is truncated to fit the helm release names rukpak installs BundleDeployments
+// as, and suffixed with a hash of it, so it's unique and doesn't collide with
+// the BundleDeployments that are named after a PlatformOperator.
+func BundleDeploymentName(po *platformv1alpha1.PlatformOperator) string {
+	hash := fmt.Sprintf("%x", sha256.Sum256([]byte(po.GetName())))[:bundleDeploymentHashLength]
+	prefix := po.GetName()
+	if max := maxReleaseNameLength - bundleDeploymentHashLength - 1; len(prefix) > max {
+		prefix = strings.TrimRight(prefix[:max], ".-")
+	}
+	return prefix + "-" + hash
+}
+
+// RequeueBundleDeployment maps a BundleDeployment event to the PlatformOperator that
+// controls it. Only a controller owner reference with the PlatformOperator kind is
+// considered, and the referenced PlatformOperator is fetched directly and its UID
+// compared against the reference, so unrelated owners that happen to share a name
+// never trigger a reconciliation.
+func RequeueBundleDeployment(c client.Reader) handler.MapFunc {
+	return func(obj client.Object) []reconcile.Request {
+		ref := metav1.GetControllerOf(obj)
+		if ref == nil {
+			return nil
+		}
+		gv, err := schema.ParseGroupVersion(ref.APIVersion)
+		if err != nil {
+			return nil
+		}
+		if gv.Group != platformv1alpha1.GroupVersion.Group || ref.Kind != platformv1alpha1.PlatformOperatorKind {
 			return nil
 		}
 
-		var requests []reconcile.Request
-		for _, po := range poList.Items {
-			po := po
-
-			for _, ref := range bi.GetOwnerReferences() {
-				if ref.Name == po.GetName() {
-					requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&po)})
-				}
-			}
+		po := &platformv1alpha1.PlatformOperator{}
+		if err := c.Get(context.Background(), types.NamespacedName{Name: ref.Name}, po); err != nil {
+			return nil
 		}
-		return requests
+		if po.GetUID() != ref.UID {
+			return nil
+		}
+		return []reconcile.Request{{NamespacedName: client.ObjectKeyFromObject(po)}}
 	}
 }
+
+// BundleDeploymentChanged filters out BundleDeployment updates that changed neither
+// the generation nor the status, e.g. label, annotation and managedFields updates.
+func BundleDeploymentChanged() predicate.Predicate {
+	return predicate.Or(
+		predicate.GenerationChangedPredicate{},
+		predicate.Funcs{
+			UpdateFunc: func(e event.UpdateEvent) bool {
+				oldBD, ok := e.ObjectOld.(*rukpakv1alpha1.BundleDeployment)
+				if !ok {
+					return false
+				}
+				newBD, ok := e.ObjectNew.(*rukpakv1alpha1.BundleDeployment)
+				if !ok {
+					return false
+				}
+				return !equality.Semantic.DeepEqual(oldBD.Status, newBD.Status)
+			},
+		},
+	)
+}
@@ -0,0 +1,381 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	operatorsv1alpha1 "github.com/operator-framework/api/pkg/operators/v1alpha1"
+	rukpakv1alpha1 "github.com/operator-framework/rukpak/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	platformv1alpha1 "github.com/openshift/platform-operators/api/v1alpha1"
+)
+
+func newPlatformOperator(name string) *platformv1alpha1.PlatformOperator {
+	return &platformv1alpha1.PlatformOperator{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+			UID:  types.UID(name + "-uid"),
+		},
+	}
+}
+
+func newBundleDeployment(name string, owner metav1.OwnerReference) *rukpakv1alpha1.BundleDeployment {
+	return &rukpakv1alpha1.BundleDeployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			OwnerReferences: []metav1.OwnerReference{owner},
+		},
+	}
+}
+
+func controllerRef(po *platformv1alpha1.PlatformOperator) metav1.OwnerReference {
+	return *metav1.NewControllerRef(po, platformv1alpha1.GroupVersion.WithKind(platformv1alpha1.PlatformOperatorKind))
+}
+
+func newFakeClient(tb testing.TB, objs ...client.Object) client.Client {
+	tb.Helper()
+
+	scheme := runtime.NewScheme()
+	if err := platformv1alpha1.AddToScheme(scheme); err != nil {
+		tb.Fatal(err)
+	}
+	return fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
+}
+
+func TestBundleDeploymentName(t *testing.T) {
+	name := BundleDeploymentName(newPlatformOperator("combo"))
+	if !strings.HasPrefix(name, "combo-") || name == "combo" {
+		t.Errorf("expected a name prefixed with the platform operator's name, got %q", name)
+	}
+	if again := BundleDeploymentName(newPlatformOperator("combo")); again != name {
+		t.Errorf("expected the name to be deterministic, got %q and %q", name, again)
+	}
+
+	long := strings.Repeat("a", 60)
+	truncated := BundleDeploymentName(newPlatformOperator(long))
+	if len(truncated) > maxReleaseNameLength {
+		t.Errorf("expected the name to fit in %d characters, got %q", maxReleaseNameLength, truncated)
+	}
+	if other := BundleDeploymentName(newPlatformOperator(long + "b")); other == truncated {
+		t.Errorf("expected platform operators sharing a prefix to get different names, got %q", other)
+	}
+}
+
+func TestRequeueBundleDeployment(t *testing.T) {
+	po := newPlatformOperator("combo")
+	c := newFakeClient(t, po)
+	mapFn := RequeueBundleDeployment(c)
+
+	stale := newPlatformOperator("combo")
+	stale.SetUID("stale-uid")
+
+	for _, tt := range []struct {
+		name  string
+		owner metav1.OwnerReference
+		want  int
+	}{
+		{
+			name:  "controlled by the platform operator",
+			owner: controllerRef(po),
+			want:  1,
+		},
+		{
+			name: "owned by a different kind with the same name",
+			owner: metav1.OwnerReference{
+				APIVersion: "v1",
+				Kind:       "ConfigMap",
+				Name:       po.GetName(),
+				UID:        po.GetUID(),
+				Controller: func() *bool { b := true; return &b }(),
+			},
+		},
+		{
+			name:  "controlled by a previous platform operator with the same name",
+			owner: controllerRef(stale),
+		},
+		{
+			name:  "controlled by a platform operator that no longer exists",
+			owner: controllerRef(newPlatformOperator("missing")),
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := mapFn(newBundleDeployment("combo", tt.owner))
+			if len(requests) != tt.want {
+				t.Fatalf("expected %d requests, got %v", tt.want, requests)
+			}
+			if tt.want == 1 && requests[0].Name != po.GetName() {
+				t.Errorf("expected a request for %s, got %v", po.GetName(), requests[0])
+			}
+		})
+	}
+}
+
+// listRequeueBundleDeployment is the previous list-based mapping implementation,
+// kept around to benchmark against.
+func listRequeueBundleDeployment(c client.Client) handler.MapFunc {
+	return func(obj client.Object) []reconcile.Request {
+		poList := &platformv1alpha1.PlatformOperatorList{}
+		if err := c.List(context.Background(), poList); err != nil {
+			return nil
+		}
+		var requests []reconcile.Request
+		for _, po := range poList.Items {
+			po := po
+			for _, ref := range obj.GetOwnerReferences() {
+				if ref.Name == po.GetName() {
+					requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&po)})
+				}
+			}
+		}
+		return requests
+	}
+}
+
+func BenchmarkRequeueBundleDeployment(b *testing.B) {
+	for _, n := range []int{100, 1000, 5000} {
+		objs := make([]client.Object, 0, n)
+		for i := 0; i < n; i++ {
+			objs = append(objs, newPlatformOperator(fmt.Sprintf("po-%d", i)))
+		}
+		c := newFakeClient(b, objs...)
+		bd := newBundleDeployment("po-0", controllerRef(objs[0].(*platformv1alpha1.PlatformOperator)))
+
+		for _, impl := range []struct {
+			name  string
+			mapFn handler.MapFunc
+		}{
+			{name: "list", mapFn: listRequeueBundleDeployment(c)},
+			{name: "owner", mapFn: RequeueBundleDeployment(c)},
+		} {
+			b.Run(fmt.Sprintf("%s/%d", impl.name, n), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					if requests := impl.mapFn(bd); len(requests) != 1 {
+						b.Fatalf("expected a single request, got %v", requests)
+					}
+				}
+			})
+		}
+	}
+}
+
+// indexedReader serves PlatformOperator lists that honor the field indexes
+// registered by the controller, which the fake client doesn't support.
+type indexedReader struct {
+	client.Reader
+	pos []platformv1alpha1.PlatformOperator
+}
+
+func (r indexedReader) List(_ context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	listOpts := &client.ListOptions{}
+	listOpts.ApplyOptions(opts)
+
+	poList := list.(*platformv1alpha1.PlatformOperatorList)
+	for _, po := range r.pos {
+		po := po
+		set := fields.Set{SourcedIndexKey: IndexSourced(&po)[0]}
+		if pkgs := IndexPackageName(&po); len(pkgs) != 0 {
+			set[PackageNameIndexKey] = pkgs[0]
+		}
+		// Objects indexed under several values match a selector for any of them.
+		candidates := []fields.Set{set}
+		for _, name := range IndexDependsOn(&po) {
+			s := fields.Set{DependsOnIndexKey: name}
+			for k, v := range set {
+				s[k] = v
+			}
+			candidates = append(candidates, s)
+		}
+		for _, set := range candidates {
+			if listOpts.FieldSelector == nil || listOpts.FieldSelector.Matches(set) {
+				poList.Items = append(poList.Items, po)
+				break
+			}
+		}
+	}
+	return nil
+}
+
+type staticPackages map[string]sets.String
+
+func (s staticPackages) Packages(catalog string) (sets.String, bool) {
+	pkgs, ok := s[catalog]
+	return pkgs, ok
+}
+
+func newSourcedPlatformOperator(name, pkg string, sourced bool) platformv1alpha1.PlatformOperator {
+	po := newPlatformOperator(name)
+	po.Spec.PackageName = pkg
+	status := metav1.ConditionFalse
+	if sourced {
+		status = metav1.ConditionTrue
+	}
+	meta.SetStatusCondition(&po.Status.Conditions, metav1.Condition{Type: platformv1alpha1.TypeSourced, Status: status})
+	return *po
+}
+
+func TestRequeuePlatformOperators(t *testing.T) {
+	reader := indexedReader{pos: []platformv1alpha1.PlatformOperator{
+		newSourcedPlatformOperator("combo", "combo", true),
+		newSourcedPlatformOperator("prometheus", "prometheus-operator", true),
+		newSourcedPlatformOperator("pending", "missing", false),
+	}}
+	packages := staticPackages{"olm/catalog": sets.NewString("combo")}
+
+	for _, tt := range []struct {
+		name    string
+		catalog string
+		want    sets.String
+	}{
+		{
+			name:    "known catalog requeues matching and unsourced platform operators",
+			catalog: "catalog",
+			want:    sets.NewString("combo", "pending"),
+		},
+		{
+			name:    "unknown catalog requeues every platform operator",
+			catalog: "unknown",
+			want:    sets.NewString("combo", "prometheus", "pending"),
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cs := &operatorsv1alpha1.CatalogSource{ObjectMeta: metav1.ObjectMeta{Name: tt.catalog, Namespace: "olm"}}
+
+			got := sets.NewString()
+			for _, req := range RequeuePlatformOperators(reader, packages)(cs) {
+				got.Insert(req.Name)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("expected requests for %v, got %v", tt.want.List(), got.List())
+			}
+		})
+	}
+}
+
+func TestRequeueDependents(t *testing.T) {
+	dependent := func(name string, deps ...string) platformv1alpha1.PlatformOperator {
+		po := newPlatformOperator(name)
+		for _, d := range deps {
+			po.Spec.DependsOn = append(po.Spec.DependsOn, platformv1alpha1.Dependency{Name: d})
+		}
+		return *po
+	}
+	reader := indexedReader{pos: []platformv1alpha1.PlatformOperator{
+		dependent("networking"),
+		dependent("monitoring", "networking"),
+		dependent("logging", "storage", "networking"),
+		dependent("storage"),
+		dependent("tracing", "logging"),
+		// A cycle through the PlatformOperator that changed.
+		dependent("alerting", "monitoring"),
+		dependent("networking-policy", "alerting"),
+	}}
+	reader.pos[0] = dependent("networking", "networking-policy")
+
+	for _, tt := range []struct {
+		name string
+		want sets.String
+	}{
+		{name: "networking", want: sets.NewString("monitoring", "logging", "tracing", "alerting", "networking-policy")},
+		{name: "storage", want: sets.NewString("logging", "tracing")},
+		{name: "tracing", want: sets.NewString()},
+	} {
+		got := sets.NewString()
+		for _, req := range RequeueDependents(reader)(newPlatformOperator(tt.name)) {
+			if got.Has(req.Name) {
+				t.Errorf("expected a single request for %s", req.Name)
+			}
+			got.Insert(req.Name)
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("expected the %s changes to request %v, got %v", tt.name, tt.want.List(), got.List())
+		}
+	}
+}
+
+func TestCatalogSourceChanged(t *testing.T) {
+	now := metav1.Now()
+	newCatalogSource := func(state string, lastConnect metav1.Time) *operatorsv1alpha1.CatalogSource {
+		return &operatorsv1alpha1.CatalogSource{
+			ObjectMeta: metav1.ObjectMeta{Name: "catalog", Namespace: "olm", Generation: 1},
+			Status: operatorsv1alpha1.CatalogSourceStatus{
+				GRPCConnectionState: &operatorsv1alpha1.GRPCConnectionState{
+					Address:           "catalog.olm.svc:50051",
+					LastObservedState: state,
+					LastConnectTime:   lastConnect,
+				},
+			},
+		}
+	}
+
+	p := CatalogSourceChanged()
+	heartbeat := event.UpdateEvent{
+		ObjectOld: newCatalogSource("READY", metav1.Time{}),
+		ObjectNew: newCatalogSource("READY", now),
+	}
+	if p.Update(heartbeat) {
+		t.Errorf("expected a heartbeat update to be filtered out")
+	}
+	transition := event.UpdateEvent{
+		ObjectOld: newCatalogSource("CONNECTING", metav1.Time{}),
+		ObjectNew: newCatalogSource("READY", now),
+	}
+	if !p.Update(transition) {
+		t.Errorf("expected a connection state transition to be let through")
+	}
+}
+
+func TestBundleDeploymentChanged(t *testing.T) {
+	newBD := func(generation int64, labels map[string]string, activeBundle string) *rukpakv1alpha1.BundleDeployment {
+		return &rukpakv1alpha1.BundleDeployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "combo", Generation: generation, Labels: labels},
+			Status:     rukpakv1alpha1.BundleDeploymentStatus{ActiveBundle: activeBundle},
+		}
+	}
+
+	p := BundleDeploymentChanged()
+	for _, tt := range []struct {
+		name     string
+		old, new *rukpakv1alpha1.BundleDeployment
+		want     bool
+	}{
+		{
+			name: "metadata update",
+			old:  newBD(1, nil, "combo-1"),
+			new:  newBD(1, map[string]string{"example.com/team": "combo"}, "combo-1"),
+		},
+		{
+			name: "spec update",
+			old:  newBD(1, nil, "combo-1"),
+			new:  newBD(2, nil, "combo-1"),
+			want: true,
+		},
+		{
+			name: "status update",
+			old:  newBD(2, nil, "combo-1"),
+			new:  newBD(2, nil, "combo-2"),
+			want: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := p.Update(event.UpdateEvent{ObjectOld: tt.old, ObjectNew: tt.new}); got != tt.want {
+				t.Errorf("expected the predicate to return %t, got %t", tt.want, got)
+			}
+		})
+	}
+	if !p.Delete(event.DeleteEvent{Object: newBD(1, nil, "combo-1")}) {
+		t.Errorf("expected deletions to be let through")
+	}
+}
@@ -0,0 +1,248 @@
+package verifier
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"sigs.k8s.io/yaml"
+
+	platformv1alpha1 "github.com/openshift/platform-operators/api/v1alpha1"
+	"github.com/openshift/platform-operators/internal/mirror"
+	"github.com/openshift/platform-operators/internal/sourcer"
+)
+
+const (
+	// SignatureAnnotation is the layer annotation cosign stores the base64
+	// encoded signature of the layer's simple signing payload in.
+	SignatureAnnotation = "dev.cosignproject.cosign/signature"
+	// SignatureTagSuffix is the suffix of the tag cosign stores an image's
+	// signatures under, next to the image in the same repository.
+	SignatureTagSuffix = ".sig"
+)
+
+var (
+	// ErrUnsigned is returned when a bundle image has no signatures.
+	ErrUnsigned = errors.New("image is not signed")
+	// ErrUntrusted is returned when none of a bundle image's signatures were
+	// produced by a trusted key.
+	ErrUntrusted = errors.New("image is not signed by a trusted key")
+)
+
+// Verifier verifies that the bundle content was published by a trusted party
+// before it's applied to the cluster.
+type Verifier interface {
+	Verify(context.Context, *platformv1alpha1.PlatformOperator, *sourcer.Bundle) error
+}
+
+// Policy configures the public keys that are trusted to sign bundle images.
+type Policy struct {
+	// Keys are the PEM encoded public keys trusted to sign bundles from any catalog.
+	Keys []string `json:"keys,omitempty"`
+	// Catalogs maps a catalog to the PEM encoded public keys that are trusted to
+	// sign the bundles it serves, in addition to the global keys.
+	Catalogs map[string][]string `json:"catalogs,omitempty"`
+}
+
+// LoadPolicy reads a YAML or JSON encoded Policy from the file at path.
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p := &Policy{}
+	if err := yaml.UnmarshalStrict(data, p); err != nil {
+		return nil, fmt.Errorf("failed to parse the %s signature policy: %w", path, err)
+	}
+	return p, nil
+}
+
+type cosignVerifier struct {
+	keys     []crypto.PublicKey
+	catalogs map[string][]crypto.PublicKey
+	mirrors  mirror.Rewriter
+	opts     []remote.Option
+}
+
+// NewCosignVerifier returns a Verifier that checks the cosign signatures stored
+// alongside bundle images against the keys trusted by the policy. When mirrors
+// is set, the signatures are fetched from the locations the image is mirrored to
+// first, as mirroring an image along with its signatures keeps them next to it.
+func NewCosignVerifier(p *Policy, mirrors mirror.Rewriter, opts ...remote.Option) (Verifier, error) {
+	keys, err := parsePublicKeys(p.Keys)
+	if err != nil {
+		return nil, err
+	}
+	catalogs := make(map[string][]crypto.PublicKey, len(p.Catalogs))
+	for catalog, pems := range p.Catalogs {
+		if catalogs[catalog], err = parsePublicKeys(pems); err != nil {
+			return nil, fmt.Errorf("invalid keys for the %s catalog: %w", catalog, err)
+		}
+	}
+	return &cosignVerifier{
+		keys:     keys,
+		catalogs: catalogs,
+		mirrors:  mirrors,
+		opts:     opts,
+	}, nil
+}
+
+func (v cosignVerifier) Verify(ctx context.Context, _ *platformv1alpha1.PlatformOperator, b *sourcer.Bundle) error {
+	ref, err := name.NewDigest(b.Image)
+	if err != nil {
+		return fmt.Errorf("only images pinned to a digest can be verified: %w", err)
+	}
+	keys := append(append([]crypto.PublicKey{}, v.keys...), v.catalogs[b.Catalog]...)
+	if len(keys) == 0 {
+		return fmt.Errorf("%w: no keys are trusted for the %q catalog", ErrUntrusted, b.Catalog)
+	}
+
+	sigs, err := v.signatures(ctx, ref)
+	if err != nil {
+		return err
+	}
+	manifest, err := sigs.Manifest()
+	if err != nil {
+		return err
+	}
+	if len(manifest.Layers) == 0 {
+		return ErrUnsigned
+	}
+	for _, desc := range manifest.Layers {
+		sig, err := base64.StdEncoding.DecodeString(desc.Annotations[SignatureAnnotation])
+		if err != nil || len(sig) == 0 {
+			continue
+		}
+		layer, err := sigs.LayerByDigest(desc.Digest)
+		if err != nil {
+			return err
+		}
+		payload, err := readPayload(layer.Compressed)
+		if err != nil {
+			return err
+		}
+		if !verifySignature(keys, payload, sig) {
+			continue
+		}
+		if err := checkPayload(payload, ref); err != nil {
+			continue
+		}
+		return nil
+	}
+	return ErrUntrusted
+}
+
+// signatures fetches the signatures of the image from the first of its locations
+// that has them. The image is unsigned when none of its locations have them.
+func (v cosignVerifier) signatures(ctx context.Context, ref name.Digest) (v1.Image, error) {
+	locations := []string{ref.String()}
+	if v.mirrors != nil {
+		var err error
+		if locations, err = v.mirrors.Locations(ctx, ref.String()); err != nil {
+			return nil, fmt.Errorf("failed to look up the mirrors of the %s image: %w", ref, err)
+		}
+	}
+	var errs []error
+	for _, location := range locations {
+		mirrored, err := name.NewDigest(location)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		sigs, err := remote.Image(signatureRef(mirrored), append([]remote.Option{remote.WithContext(ctx)}, v.opts...)...)
+		if err != nil {
+			var terr *transport.Error
+			if !errors.As(err, &terr) || terr.StatusCode != http.StatusNotFound {
+				errs = append(errs, fmt.Errorf("%s: %w", location, err))
+			}
+			continue
+		}
+		return sigs, nil
+	}
+	if len(errs) != 0 {
+		return nil, fmt.Errorf("failed to fetch the signatures of the %s image: %w", ref, utilerrors.NewAggregate(errs))
+	}
+	return nil, ErrUnsigned
+}
+
+// signatureRef returns the reference to the tag cosign stores the signatures
+// of the image under, e.g. sha256-<hex>.sig.
+func signatureRef(ref name.Digest) name.Tag {
+	return ref.Context().Tag(strings.Replace(ref.DigestStr(), ":", "-", 1) + SignatureTagSuffix)
+}
+
+func readPayload(open func() (io.ReadCloser, error)) ([]byte, error) {
+	rc, err := open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+func verifySignature(keys []crypto.PublicKey, payload, sig []byte) bool {
+	digest := sha256.Sum256(payload)
+	for _, key := range keys {
+		if ecdsaKey, ok := key.(*ecdsa.PublicKey); ok && ecdsa.VerifyASN1(ecdsaKey, digest[:], sig) {
+			return true
+		}
+	}
+	return false
+}
+
+// simpleSigning is the payload format cosign signs, which binds the signature to
+// the digest of the signed image.
+type simpleSigning struct {
+	Critical struct {
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+		Type string `json:"type"`
+	} `json:"critical"`
+}
+
+func checkPayload(payload []byte, ref name.Digest) error {
+	var ss simpleSigning
+	if err := json.Unmarshal(payload, &ss); err != nil {
+		return err
+	}
+	if got := ss.Critical.Image.DockerManifestDigest; got != ref.DigestStr() {
+		return fmt.Errorf("signature is for the %s digest, not %s", got, ref.DigestStr())
+	}
+	return nil
+}
+
+func parsePublicKeys(pems []string) ([]crypto.PublicKey, error) {
+	var keys []crypto.PublicKey
+	for _, p := range pems {
+		block, _ := pem.Decode([]byte(p))
+		if block == nil {
+			return nil, fmt.Errorf("failed to decode PEM encoded public key")
+		}
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := key.(*ecdsa.PublicKey); !ok {
+			return nil, fmt.Errorf("unsupported %T public key: only ECDSA keys are supported", key)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
@@ -0,0 +1,215 @@
+package verifier
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+
+	"github.com/openshift/platform-operators/internal/mirror"
+	"github.com/openshift/platform-operators/internal/sourcer"
+)
+
+type testKey struct {
+	*ecdsa.PrivateKey
+	pem string
+}
+
+func newTestKey(t *testing.T) testKey {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testKey{
+		PrivateKey: key,
+		pem:        string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})),
+	}
+}
+
+// pushImage pushes a random image to the in-process registry and returns its
+// digest reference.
+func pushImage(t *testing.T, repo string) name.Digest {
+	t.Helper()
+
+	img, err := random.Image(64, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag, err := name.NewTag(repo + ":v0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(tag, img); err != nil {
+		t.Fatal(err)
+	}
+	digest, err := img.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tag.Context().Digest(digest.String())
+}
+
+// sign pushes a cosign signature of the signed digest, made with the key, to the
+// signature tag of ref.
+func sign(t *testing.T, ref name.Digest, signed string, key testKey) {
+	t.Helper()
+
+	payload := []byte(fmt.Sprintf(`{"critical":{"identity":{"docker-reference":%q},"image":{"docker-manifest-digest":%q},"type":"cosign container image signature"},"optional":null}`,
+		ref.Context().Name(), signed))
+	digest := sha256.Sum256(payload)
+	sig, err := ecdsa.SignASN1(rand.Reader, key.PrivateKey, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := mutate.Append(empty.Image, mutate.Addendum{
+		Layer:       static.NewLayer(payload, types.MediaType("application/vnd.dev.cosign.simplesigning.v1+json")),
+		Annotations: map[string]string{SignatureAnnotation: base64.StdEncoding.EncodeToString(sig)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(signatureRef(ref), img); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCosignVerifier(t *testing.T) {
+	srv := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	defer srv.Close()
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		trusted = newTestKey(t)
+		catalog = newTestKey(t)
+		other   = newTestKey(t)
+
+		signed        = pushImage(t, u.Host+"/signed")
+		unsigned      = pushImage(t, u.Host+"/unsigned")
+		untrusted     = pushImage(t, u.Host+"/untrusted")
+		catalogSigned = pushImage(t, u.Host+"/catalog")
+		replayed      = pushImage(t, u.Host+"/replayed")
+	)
+	sign(t, signed, signed.DigestStr(), trusted)
+	sign(t, untrusted, untrusted.DigestStr(), other)
+	sign(t, catalogSigned, catalogSigned.DigestStr(), catalog)
+	// A valid signature of a different image shouldn't be accepted for this one.
+	sign(t, replayed, signed.DigestStr(), trusted)
+
+	v, err := NewCosignVerifier(&Policy{
+		Keys:     []string{trusted.pem},
+		Catalogs: map[string][]string{"olm/trusted-catalog": {catalog.pem}},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name    string
+		image   name.Digest
+		catalog string
+		want    error
+	}{
+		{name: "signed by a global key", image: signed, catalog: "olm/catalog"},
+		{name: "unsigned", image: unsigned, catalog: "olm/catalog", want: ErrUnsigned},
+		{name: "signed by an untrusted key", image: untrusted, catalog: "olm/catalog", want: ErrUntrusted},
+		{name: "signed by the catalog's key", image: catalogSigned, catalog: "olm/trusted-catalog"},
+		{name: "signed by another catalog's key", image: catalogSigned, catalog: "olm/catalog", want: ErrUntrusted},
+		{name: "signature of a different digest", image: replayed, catalog: "olm/catalog", want: ErrUntrusted},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := v.Verify(context.Background(), nil, &sourcer.Bundle{Image: tt.image.String(), Catalog: tt.catalog})
+			if !errors.Is(err, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestCosignVerifierMirrors(t *testing.T) {
+	srv := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	defer srv.Close()
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := newTestKey(t)
+	signed := pushImage(t, u.Host+"/mirror/combo/signed")
+	sign(t, signed, signed.DigestStr(), key)
+	unsigned := pushImage(t, u.Host+"/mirror/combo/unsigned")
+
+	// Only the mirror can be reached, as on disconnected clusters.
+	v, err := NewCosignVerifier(&Policy{Keys: []string{key.pem}}, mirror.NewStaticRewriter([]mirror.Mirror{
+		{Source: "127.0.0.1:1/combo", Mirrors: []string{u.Host + "/mirror/combo"}},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Verify(context.Background(), nil, &sourcer.Bundle{Image: "127.0.0.1:1/combo/signed@" + signed.DigestStr()}); err != nil {
+		t.Errorf("expected the signatures to be fetched from the mirror, got %v", err)
+	}
+	err = v.Verify(context.Background(), nil, &sourcer.Bundle{Image: "127.0.0.1:1/combo/unsigned@" + unsigned.DigestStr()})
+	if err == nil || errors.Is(err, ErrUnsigned) {
+		t.Errorf("expected the unreachable source to fail verification rather than report the image as unsigned, got %v", err)
+	}
+}
+
+func TestLoadPolicy(t *testing.T) {
+	key := newTestKey(t)
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	policy := fmt.Sprintf("catalogs:\n  olm/catalog:\n  - |\n%s", indent(key.pem))
+	if err := os.WriteFile(path, []byte(policy), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := LoadPolicy(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := NewCosignVerifier(p, nil); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := NewCosignVerifier(&Policy{Keys: []string{"not a key"}}, nil); err == nil {
+		t.Error("expected an error for an invalid key")
+	}
+}
+
+func indent(s string) string {
+	var b strings.Builder
+	for _, line := range strings.Split(strings.TrimSpace(s), "\n") {
+		b.WriteString("    " + line + "\n")
+	}
+	return b.String()
+}
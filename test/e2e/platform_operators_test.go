@@ -15,6 +15,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	platformv1alpha1 "github.com/openshift/platform-operators/api/v1alpha1"
+	"github.com/openshift/platform-operators/internal/util"
 )
 
 const (
@@ -72,7 +73,7 @@ var _ = Describe("platform operators controller", func() {
 			It("should initially select the v0.1.0 package", func() {
 				Eventually(func() bool {
 					bi := &rukpakv1alpha1.BundleDeployment{}
-					if err := c.Get(ctx, types.NamespacedName{Name: po.GetName()}, bi); err != nil {
+					if err := c.Get(ctx, types.NamespacedName{Name: util.BundleDeploymentName(po)}, bi); err != nil {
 						return false
 					}
 					return bi.Spec.Template.Spec.Source.Image.Ref == "quay.io/operatorhubio/prometheus:v0.47.0"
@@ -88,7 +89,7 @@ var _ = Describe("platform operators controller", func() {
 				It("should result in the v0.2.0 package being installed", func() {
 					Eventually(func() bool {
 						bi := &rukpakv1alpha1.BundleDeployment{}
-						if err := c.Get(ctx, types.NamespacedName{Name: po.GetName()}, bi); err != nil {
+						if err := c.Get(ctx, types.NamespacedName{Name: util.BundleDeploymentName(po)}, bi); err != nil {
 							return false
 						}
 						return bi.Spec.Template.Spec.Source.Image.Ref == "quay.io/operatorhubio/prometheus:v0.47.0--20220413T184225"
@@ -115,16 +116,16 @@ var _ = Describe("platform operators controller", func() {
 			AfterEach(func() {
 				Expect(c.Delete(ctx, po)).To(BeNil())
 			})
-			It("should generate a Bundle Deployment with a metadata.Name that matches the platformoperator's metadata.Name", func() {
+			It("should generate a Bundle Deployment named after a hash of the platformoperator's metadata.Name", func() {
 				Eventually(func() error {
 					bi := &rukpakv1alpha1.BundleDeployment{}
-					return c.Get(ctx, types.NamespacedName{Name: po.GetName()}, bi)
+					return c.Get(ctx, types.NamespacedName{Name: util.BundleDeploymentName(po)}, bi)
 				}).Should(Succeed())
 			})
 			It("should generate a Bundle Deployment that contains the different unique provisioner ID", func() {
 				Eventually(func() bool {
 					bi := &rukpakv1alpha1.BundleDeployment{}
-					if err := c.Get(ctx, types.NamespacedName{Name: po.GetName()}, bi); err != nil {
+					if err := c.Get(ctx, types.NamespacedName{Name: util.BundleDeploymentName(po)}, bi); err != nil {
 						return false
 					}
 					return bi.Spec.Template.Spec.ProvisionerClassName != bi.Spec.ProvisionerClassName
@@ -133,7 +134,7 @@ var _ = Describe("platform operators controller", func() {
 			It("should choose the highest olm.bundle semver available in the catalog", func() {
 				Eventually(func() bool {
 					bi := &rukpakv1alpha1.BundleDeployment{}
-					if err := c.Get(ctx, types.NamespacedName{Name: po.GetName()}, bi); err != nil {
+					if err := c.Get(ctx, types.NamespacedName{Name: util.BundleDeploymentName(po)}, bi); err != nil {
 						return false
 					}
 					return bi.Spec.Template.Spec.Source.Image.Ref == "quay.io/operatorhubio/prometheus:v0.47.0"
@@ -156,7 +157,7 @@ var _ = Describe("platform operators controller", func() {
 			It("should result in a successful installation", func() {
 				Eventually(func() (*metav1.Condition, error) {
 					bi := &rukpakv1alpha1.BundleDeployment{}
-					if err := c.Get(ctx, types.NamespacedName{Name: po.GetName()}, bi); err != nil {
+					if err := c.Get(ctx, types.NamespacedName{Name: util.BundleDeploymentName(po)}, bi); err != nil {
 						return nil, err
 					}
 					if bi.Status.InstalledBundleName == "" {